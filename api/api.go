@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -12,13 +13,16 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/hashicorp/go-multierror"
 	"github.com/mlowicki/rhythm/api/auth"
-	"github.com/mlowicki/rhythm/api/auth/gitlab"
-	"github.com/mlowicki/rhythm/api/auth/ldap"
 	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
+	"github.com/mlowicki/rhythm/logging"
 	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/tracing"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"github.com/tevino/abool"
 	"github.com/xeipuuv/gojsonschema"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -26,6 +30,10 @@ var (
 	errUnauthorized     = errors.New("Unauthorized")
 	errJobAlreadyExists = errors.New("Job already exists")
 	errJobNotFound      = errors.New("Job not found")
+	errShuttingDown     = errors.New("Server is shutting down")
+	errTaskNotFound     = errors.New("Task not found")
+	errTaskLogsNotFound = errors.New("Task logs not found")
+	errJobNotRunning    = errors.New("Job is not running")
 )
 
 type authorizer interface {
@@ -49,7 +57,16 @@ type storage interface {
 	GetTasks(group, project, id string) ([]*model.Task, error)
 	GetJobConf(group, project, id string) (*model.JobConf, error)
 	SaveJobConf(state *model.JobConf) error
-	QueueJob(group, project, id string) error
+	QueueJob(group, project, id string, traceContext map[string]string) error
+	RequestKill(group, project, id string) error
+	GetAPIToken(id string) (*model.APIToken, error)
+	GetAPITokens() ([]*model.APIToken, error)
+	SaveAPIToken(token *model.APIToken) error
+	DeleteAPIToken(id string) error
+}
+
+type secrets interface {
+	Read(path string, version int) (map[string]string, error)
 }
 
 type handler struct {
@@ -59,9 +76,33 @@ type handler struct {
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := h.h(h.a, h.s, w, r)
+	name := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			name = tpl
+		}
+	}
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+name, trace.WithSpanKind(trace.SpanKindServer))
+	r = r.WithContext(ctx)
+	err := h.h(h.a, &tracedStorage{ctx, h.s}, w, r)
+	tracing.End(span, err)
 	if err != nil {
-		log.Errorf("API handler error: %s", err)
+		fields := log.Fields{"method": r.Method, "path": r.URL.Path}
+		vars := mux.Vars(r)
+		if group, ok := vars["group"]; ok {
+			fields[logging.FieldGroup] = group
+		}
+		if project, ok := vars["project"]; ok {
+			fields[logging.FieldProject] = project
+		}
+		if id, ok := vars["id"]; ok {
+			jid := model.JobID{Group: vars["group"], Project: vars["project"], ID: id}
+			fields[logging.FieldJob] = jid.String()
+		}
+		if taskID, ok := vars["taskID"]; ok {
+			fields[logging.FieldTaskID] = taskID
+		}
+		log.WithFields(fields).Errorf("API handler error: %s", err)
 		errs := make([]string, 0, 1)
 		if merr, ok := err.(*multierror.Error); ok {
 			for _, err := range merr.Errors {
@@ -88,7 +129,7 @@ func filterReadableJobs(a authorizer, r *http.Request, jobs []*model.Job) ([]*mo
 			}
 			lvls[key] = lvl
 		}
-		if lvl != auth.NoAccess {
+		if lvl.Has(auth.Read) {
 			readable = append(readable, job)
 		}
 	}
@@ -119,7 +160,7 @@ func getTasks(a authorizer, s storage, w http.ResponseWriter, r *http.Request) e
 		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
-	if lvl == auth.NoAccess {
+	if !lvl.Has(auth.Read) {
 		w.WriteHeader(http.StatusForbidden)
 		return errForbidden
 	}
@@ -129,10 +170,47 @@ func getTasks(a authorizer, s storage, w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 	sort.Slice(tasks, func(i, j int) bool { return tasks[i].End.Before(tasks[j].End) })
+	// Logs are available through separate endpoint to keep response small.
+	for _, task := range tasks {
+		task.Logs = nil
+	}
 	encoder(w).Encode(tasks)
 	return nil
 }
 
+func getTaskLogs(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	group := vars["group"]
+	project := vars["project"]
+	lvl, err := a.GetProjectAccessLevel(r, group, project)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	if !lvl.Has(auth.Read) {
+		w.WriteHeader(http.StatusForbidden)
+		return errForbidden
+	}
+	tasks, err := s.GetTasks(group, project, vars["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	for _, task := range tasks {
+		if task.TaskID != vars["taskID"] {
+			continue
+		}
+		if task.Logs == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return errTaskLogsNotFound
+		}
+		encoder(w).Encode(task.Logs)
+		return nil
+	}
+	w.WriteHeader(http.StatusNotFound)
+	return errTaskNotFound
+}
+
 func getGroupJobs(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
 	jobs, err := s.GetGroupJobs(mux.Vars(r)["group"])
 	if err != nil {
@@ -157,7 +235,7 @@ func getProjectJobs(a authorizer, s storage, w http.ResponseWriter, r *http.Requ
 		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
-	if lvl == auth.NoAccess {
+	if !lvl.Has(auth.Read) {
 		w.WriteHeader(http.StatusForbidden)
 		return errForbidden
 	}
@@ -179,7 +257,7 @@ func getJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request) err
 		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
-	if lvl == auth.NoAccess {
+	if !lvl.Has(auth.Read) {
 		w.WriteHeader(http.StatusForbidden)
 		return errForbidden
 	}
@@ -205,7 +283,7 @@ func deleteJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
-	if lvl != auth.ReadWrite {
+	if !lvl.Has(auth.Delete) {
 		w.WriteHeader(http.StatusForbidden)
 		return errForbidden
 	}
@@ -227,11 +305,11 @@ func runJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request) err
 		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
-	if lvl != auth.ReadWrite {
+	if !lvl.Has(auth.Run) {
 		w.WriteHeader(http.StatusForbidden)
 		return errForbidden
 	}
-	err = s.QueueJob(group, project, vars["id"])
+	err = s.QueueJob(group, project, vars["id"], tracing.Inject(r.Context()))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return err
@@ -239,6 +317,43 @@ func runJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request) err
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
+
+func killJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	group := vars["group"]
+	project := vars["project"]
+	lvl, err := a.GetProjectAccessLevel(r, group, project)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	if !lvl.Has(auth.Kill) {
+		w.WriteHeader(http.StatusForbidden)
+		return errForbidden
+	}
+	job, err := s.GetJob(group, project, vars["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	if job == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return errJobNotFound
+	}
+	if job.CurrentTaskID == "" {
+		w.WriteHeader(http.StatusConflict)
+		return errJobNotRunning
+	}
+	// Task is killed by scheduler asynchronously.
+	err = s.RequestKill(group, project, job.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
 func validateSchema(payload gojsonschema.JSONLoader, schema gojsonschema.JSONLoader) error {
 	res, err := gojsonschema.Validate(schema, payload)
 	if err != nil {
@@ -254,7 +369,83 @@ func validateSchema(payload gojsonschema.JSONLoader, schema gojsonschema.JSONLoa
 	return nil
 }
 
-func createJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
+// validateSecretFiles checks constraints of secret files which can't be
+// expressed by JSON schema.
+func validateSecretFiles(job *model.JobConf) error {
+	if len(job.SecretFiles) == 0 {
+		return nil
+	}
+	if job.Container.Type == model.Docker {
+		return errors.New("secretfiles aren't supported by Docker containerizer")
+	}
+	paths := make(map[string]struct{}, len(job.SecretFiles))
+	for _, f := range job.SecretFiles {
+		if _, ok := paths[f.Path]; ok {
+			return fmt.Errorf("secretfiles: duplicated path %s", f.Path)
+		}
+		paths[f.Path] = struct{}{}
+		if _, err := f.FileMode(); err != nil {
+			return fmt.Errorf("secretfiles: %s", err)
+		}
+	}
+	return nil
+}
+
+// validateTaskRetention checks that job's task retention settings don't
+// contradict each other. Zero means that server's default is used.
+func validateTaskRetention(job *model.JobConf) error {
+	r := &job.TaskRetention
+	if r.MaxCount > 0 && r.MaxCount < r.MinCount {
+		return fmt.Errorf("TaskRetention: MaxCount (%d) must not be lower than MinCount (%d)", r.MaxCount, r.MinCount)
+	}
+	return nil
+}
+
+// checkSecrets verifies that secrets referenced by job can be read so typo in
+// path is reported immediately instead of on launch. Values are never
+// returned.
+func checkSecrets(ctx context.Context, secr secrets, job *model.JobConf) error {
+	_, span := tracing.Start(ctx, "secrets.Check")
+	var errs *multierror.Error
+	check := func(name string, s *model.JobSecret) {
+		path, err := s.BackendPath(job.Group, job.Project)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %s", name, err))
+			return
+		}
+		values, err := secr.Read(path, s.Version)
+		if err == nil && !s.Expand {
+			_, err = s.Value(values)
+		}
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: secret %s can't be read: %s", name, s, err))
+		}
+	}
+	names := make([]string, 0, len(job.Secrets))
+	for name := range job.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := job.Secrets[name]
+		check("secrets."+name, &s)
+	}
+	for i := range job.SecretFiles {
+		f := &job.SecretFiles[i]
+		check("secretfiles."+f.Path, &f.Secret)
+	}
+	err := errs.ErrorOrNil()
+	tracing.End(span, err)
+	return err
+}
+
+// jobWriter groups handlers modifying jobs which validate referenced
+// secrets.
+type jobWriter struct {
+	secr secrets
+}
+
+func (jw *jobWriter) createJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
 	var payload newJobPayload
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&payload)
@@ -272,7 +463,7 @@ func createJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 		payload.Env = make(map[string]string)
 	}
 	if payload.Secrets == nil {
-		payload.Secrets = make(map[string]string)
+		payload.Secrets = make(map[string]model.JobSecret)
 	}
 	if payload.Arguments == nil {
 		payload.Arguments = make([]string, 0)
@@ -285,7 +476,7 @@ func createJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
-	if lvl != auth.ReadWrite {
+	if !lvl.Has(auth.Edit) {
 		w.WriteHeader(http.StatusForbidden)
 		return errForbidden
 	}
@@ -299,17 +490,24 @@ func createJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 			Type: model.Cron,
 			Cron: payload.Schedule.Cron,
 		},
-		Env:        payload.Env,
-		Secrets:    payload.Secrets,
-		Container:  model.JobContainer{},
-		CPUs:       payload.CPUs,
-		Mem:        payload.Mem,
-		Disk:       payload.Disk,
-		Cmd:        payload.Cmd,
-		User:       payload.User,
-		Arguments:  payload.Arguments,
-		Labels:     payload.Labels,
-		MaxRetries: payload.MaxRetries,
+		Env:         payload.Env,
+		Secrets:     payload.Secrets,
+		SecretFiles: payload.SecretFiles,
+		Container:   model.JobContainer{},
+		CPUs:        payload.CPUs,
+		Mem:         payload.Mem,
+		Disk:        payload.Disk,
+		Cmd:         payload.Cmd,
+		User:        payload.User,
+		Arguments:   payload.Arguments,
+		Labels:      payload.Labels,
+		MaxRetries:  payload.MaxRetries,
+		TaskRetention: model.TaskRetention{
+			MinCount: payload.TaskRetention.MinCount,
+			MaxCount: payload.TaskRetention.MaxCount,
+			MaxAge:   payload.TaskRetention.MaxAge,
+		},
+		RestartOnSecretsRotation: payload.RestartOnSecretsRotation,
 	}
 	jobRuntime := &model.JobRuntime{}
 	job := &model.Job{JobConf: *jobConf, JobRuntime: *jobRuntime}
@@ -330,6 +528,21 @@ func createJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 	} else {
 		job.Shell = *payload.Shell
 	}
+	err = validateSecretFiles(&job.JobConf)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+	err = validateTaskRetention(&job.JobConf)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+	err = checkSecrets(r.Context(), jw.secr, &job.JobConf)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
 	storedJob, err := s.GetJob(payload.Group, payload.Project, payload.ID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -349,7 +562,7 @@ func createJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
-func updateJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
+func (jw *jobWriter) updateJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	var payload updateJobPayload
 	group := vars["group"]
@@ -371,7 +584,7 @@ func updateJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
-	if lvl != auth.ReadWrite {
+	if !lvl.Has(auth.Edit) {
 		w.WriteHeader(http.StatusForbidden)
 		return errForbidden
 	}
@@ -398,6 +611,9 @@ func updateJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 	if payload.Secrets != nil {
 		job.Secrets = *payload.Secrets
 	}
+	if payload.SecretFiles != nil {
+		job.SecretFiles = *payload.SecretFiles
+	}
 	if payload.Container != nil {
 		container := job.Container
 		if payload.Container.Docker != nil {
@@ -453,6 +669,37 @@ func updateJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 	if payload.MaxRetries != nil {
 		job.MaxRetries = *payload.MaxRetries
 	}
+	if payload.TaskRetention != nil {
+		if payload.TaskRetention.MinCount != nil {
+			job.TaskRetention.MinCount = *payload.TaskRetention.MinCount
+		}
+		if payload.TaskRetention.MaxCount != nil {
+			job.TaskRetention.MaxCount = *payload.TaskRetention.MaxCount
+		}
+		if payload.TaskRetention.MaxAge != nil {
+			job.TaskRetention.MaxAge = *payload.TaskRetention.MaxAge
+		}
+	}
+	if payload.RestartOnSecretsRotation != nil {
+		job.RestartOnSecretsRotation = *payload.RestartOnSecretsRotation
+	}
+	err = validateSecretFiles(job)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+	err = validateTaskRetention(job)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+	if payload.Secrets != nil || payload.SecretFiles != nil {
+		err = checkSecrets(r.Context(), jw.secr, job)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return err
+		}
+	}
 	err = s.SaveJobConf(job)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -466,51 +713,78 @@ func updateJob(a authorizer, s storage, w http.ResponseWriter, r *http.Request)
 type State struct {
 	IsLeader func() bool
 	Version  string
+	// Dependencies checked by readiness endpoint.
+	Checks map[string]health.Checker
+}
+
+// Server is an API server running in background.
+type Server struct {
+	srv      *http.Server
+	readOnly *abool.AtomicBool
+	auth     *reloadableAuthorizer
+	cert     *certificate
+	storage  storage
+	tokens   *tokenAdmin
+}
+
+// StopWrites makes server reject requests modifying state. Readiness endpoint
+// starts failing so load balancers stop sending traffic to this instance.
+func (s *Server) StopWrites() {
+	s.readOnly.Set()
+}
+
+// Shutdown stops server gracefully waiting for in-flight requests.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+func rejectWrites(readOnly *abool.AtomicBool, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if readOnly.IsSet() && r.Method != "GET" && r.Method != "HEAD" && r.Method != "OPTIONS" {
+			enc := encoder(w)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			enc.Encode(struct{ Errors []string }{[]string{errShuttingDown.Error()}})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
 }
 
 // New creates instance of API server and runs it in separate goroutine.
-func New(c *conf.API, s storage, state State) {
+func New(c *conf.API, s storage, secr secrets, state State) *Server {
 	r := mux.NewRouter()
 	v1 := r.PathPrefix("/api/v1").Subrouter().StrictSlash(true)
-	var (
-		a   authorizer
-		err error
-	)
-	switch c.Auth.Backend {
-	case conf.APIAuthBackendGitLab:
-		a, err = gitlab.New(&c.Auth.GitLab)
-	case conf.APIAuthBackendNone:
-		a = &auth.NoneAuthorizer{}
-	case conf.APIAuthBackendLDAP:
-		ldap.SetTimeout(c.Auth.LDAP.Timeout)
-		a, err = ldap.New(&c.Auth.LDAP)
-	default:
-		log.Fatalf("Unknown authorization backend: %s", c.Auth.Backend)
+	roles, err := auth.NewRoles(c.Auth.Roles)
+	if err != nil {
+		log.Fatal(err)
 	}
+	inner, cache, err := newAuthorizer(&c.Auth, s, roles)
 	if err != nil {
 		log.Fatal(err)
 	}
+	setLDAPTimeout(&c.Auth)
+	a := &reloadableAuthorizer{a: inner, cache: cache}
 	log.Printf("Authorization backend: %s", c.Auth.Backend)
-	v1.Handle("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		encoder(w).Encode(struct {
-			ServerTime string
-			Version    string
-			Leader     bool
-		}{
-			time.Now().Format(time.UnixDate),
-			state.Version,
-			state.IsLeader(),
-		})
-	}))
+	readOnly := abool.New()
+	jw := &jobWriter{secr: secr}
+	ta := &tokenAdmin{conf: c.Auth.Tokens, roles: roles}
+	v1.Handle("/health", getHealth(&state))
+	v1.Handle("/health/live", getLiveness(&state))
+	v1.Handle("/health/ready", getReadiness(&state, readOnly))
 	v1.Handle("/jobs", &handler{a, s, getJobs}).Methods("GET")
-	v1.Handle("/jobs", &handler{a, s, createJob}).Methods("POST")
+	v1.Handle("/jobs", &handler{a, s, jw.createJob}).Methods("POST")
 	v1.Handle("/jobs/{group}", &handler{a, s, getGroupJobs}).Methods("GET")
 	v1.Handle("/jobs/{group}/{project}", &handler{a, s, getProjectJobs}).Methods("GET")
 	v1.Handle("/jobs/{group}/{project}/{id}", &handler{a, s, getJob}).Methods("GET")
 	v1.Handle("/jobs/{group}/{project}/{id}", &handler{a, s, deleteJob}).Methods("DELETE")
-	v1.Handle("/jobs/{group}/{project}/{id}", &handler{a, s, updateJob}).Methods("PUT")
+	v1.Handle("/jobs/{group}/{project}/{id}", &handler{a, s, jw.updateJob}).Methods("PUT")
 	v1.Handle("/jobs/{group}/{project}/{id}/tasks", &handler{a, s, getTasks}).Methods("GET")
+	v1.Handle("/jobs/{group}/{project}/{id}/tasks/{taskID}/logs", &handler{a, s, getTaskLogs}).Methods("GET")
 	v1.Handle("/jobs/{group}/{project}/{id}/run", &handler{a, s, runJob}).Methods("POST")
+	v1.Handle("/jobs/{group}/{project}/{id}/kill", &handler{a, s, killJob}).Methods("POST")
+	v1.Handle("/tokens", &handler{a, s, ta.getTokens}).Methods("GET")
+	v1.Handle("/tokens", &handler{a, s, ta.createToken}).Methods("POST")
+	v1.Handle("/tokens/{id}", &handler{a, s, ta.revokeToken}).Methods("DELETE")
 	v1.Handle("/metrics", promhttp.Handler())
 	tlsConf := &tls.Config{
 		MinVersion:               tls.VersionTLS12,
@@ -523,8 +797,17 @@ func New(c *conf.API, s storage, state State) {
 			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
 		},
 	}
+	var cert certificate
+	if isTLS(c) {
+		crt, err := loadCertificate(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cert.set(crt)
+		tlsConf.GetCertificate = cert.get
+	}
 	srv := &http.Server{
-		Handler:      r,
+		Handler:      rejectWrites(readOnly, r),
 		Addr:         c.Addr,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
@@ -533,10 +816,16 @@ func New(c *conf.API, s storage, state State) {
 		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
 	}
 	go func() {
-		if c.CertFile != "" || c.KeyFile != "" {
-			log.Fatal(srv.ListenAndServeTLS(c.CertFile, c.KeyFile))
+		var err error
+		if isTLS(c) {
+			// Certificate is provided by tls.Config.GetCertificate.
+			err = srv.ListenAndServeTLS("", "")
 		} else {
-			log.Fatal(srv.ListenAndServe())
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
 		}
 	}()
+	return &Server{srv: srv, readOnly: readOnly, auth: a, cert: &cert, storage: s, tokens: ta}
 }
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/model"
+)
+
+type jobsStorage struct {
+	storage
+	job   *model.JobConf
+	saved *model.JobConf
+}
+
+func (s *jobsStorage) GetJobConf(group, project, id string) (*model.JobConf, error) {
+	job := *s.job
+	return &job, nil
+}
+
+func (s *jobsStorage) SaveJobConf(job *model.JobConf) error {
+	s.saved = job
+	return nil
+}
+
+func TestUpdateJobValidatesTaskRetention(t *testing.T) {
+	tests := []struct {
+		stored model.TaskRetention
+		body   string
+		status int
+	}{
+		{model.TaskRetention{}, `{"TaskRetention": {"MinCount": 5, "MaxCount": 10}}`, http.StatusNoContent},
+		{model.TaskRetention{}, `{"TaskRetention": {"MinCount": 5, "MaxCount": 5}}`, http.StatusNoContent},
+		{model.TaskRetention{}, `{"TaskRetention": {"MinCount": 10}}`, http.StatusNoContent},
+		{model.TaskRetention{}, `{"TaskRetention": {"MinCount": 10, "MaxCount": 5}}`, http.StatusBadRequest},
+		{model.TaskRetention{MaxCount: 5}, `{"TaskRetention": {"MinCount": 10}}`, http.StatusBadRequest},
+		{model.TaskRetention{MinCount: 10}, `{"TaskRetention": {"MaxCount": 5}}`, http.StatusBadRequest},
+	}
+	a := projectsAuthorizer{"group/project": auth.ReadWrite}
+	jw := &jobWriter{}
+	for _, test := range tests {
+		s := &jobsStorage{job: &model.JobConf{
+			JobID:         model.JobID{Group: "group", Project: "project", ID: "id"},
+			TaskRetention: test.stored,
+		}}
+		r := httptest.NewRequest("PUT", "/api/v1/jobs/group/project/id", strings.NewReader(test.body))
+		r = mux.SetURLVars(r, map[string]string{"group": "group", "project": "project", "id": "id"})
+		w := httptest.NewRecorder()
+		err := jw.updateJob(a, s, w, r)
+		if w.Code != test.status {
+			t.Errorf("%+v %s: got status %d (%v), want %d", test.stored, test.body, w.Code, err, test.status)
+		}
+		if saved := s.saved != nil; saved != (test.status == http.StatusNoContent) {
+			t.Errorf("%+v %s: job saved: %v", test.stored, test.body, saved)
+		}
+	}
+}
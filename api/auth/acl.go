@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Built-in roles used in ACLs.
+const (
+	ACLReadOnly  = "readonly"
+	ACLReadWrite = "readwrite"
+	ACLAdmin     = "admin"
+)
+
+// Verbs maps names of permissions used in role definitions to permissions.
+var Verbs = map[string]AccessLevel{
+	"read":   Read,
+	"run":    Run,
+	"kill":   Kill,
+	"edit":   Edit,
+	"delete": Delete,
+	"admin":  Admin,
+}
+
+// Roles maps role name to permissions it grants.
+type Roles map[string]AccessLevel
+
+// BuiltinRoles returns names of roles which are always defined.
+func BuiltinRoles() []string {
+	return []string{ACLAdmin, ACLReadOnly, ACLReadWrite}
+}
+
+// NewRoles returns built-in roles ("readonly", "readwrite" and "admin") along
+// with custom ones defined as lists of verbs (e.g. "oncall": ["read", "run"]).
+func NewRoles(defs map[string][]string) (Roles, error) {
+	roles := Roles{
+		ACLReadOnly:  ReadOnly,
+		ACLReadWrite: ReadWrite,
+		ACLAdmin:     All,
+	}
+	for name, verbs := range defs {
+		if _, ok := roles[name]; ok {
+			return nil, fmt.Errorf("built-in role can't be redefined: %s", name)
+		}
+		var lvl AccessLevel
+		for _, verb := range verbs {
+			p, ok := Verbs[verb]
+			if !ok {
+				return nil, fmt.Errorf("unknown verb in role %s: %s", name, verb)
+			}
+			lvl |= p
+		}
+		roles[name] = lvl
+	}
+	return roles, nil
+}
+
+// VerbNames returns sorted names of permissions from l.
+func VerbNames(l AccessLevel) []string {
+	var names []string
+	for name, p := range Verbs {
+		if l.Has(p) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ACL maps name (e.g. user or group) to roles per project ("group/project"),
+// the whole group ("group") or all projects ("*").
+type ACL map[string]map[string]string
+
+// Level returns access level granted to name. The most specific rule
+// (project, then group, then "*") is used.
+func (acl ACL) Level(roles Roles, name, group, project string) AccessLevel {
+	rules, ok := acl[name]
+	if !ok {
+		return NoAccess
+	}
+	keys := [...]string{
+		fmt.Sprintf("%s/%s", group, project),
+		group,
+		"*",
+	}
+	for _, key := range keys {
+		role, ok := rules[key]
+		if !ok {
+			continue
+		}
+		return roles[role]
+	}
+	return NoAccess
+}
+
+// Validate checks if ACL uses only known roles.
+func (acl ACL) Validate(roles Roles) error {
+	for outerKey, rules := range acl {
+		for innerKey, role := range rules {
+			if _, ok := roles[role]; !ok {
+				return fmt.Errorf("unknown role [%s][%s]: %s", outerKey, innerKey, role)
+			}
+		}
+	}
+	return nil
+}
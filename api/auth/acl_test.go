@@ -0,0 +1,27 @@
+package auth
+
+import "testing"
+
+func TestNewRolesAdminIsExplicit(t *testing.T) {
+	roles, err := NewRoles(map[string][]string{"tokens": {"read", "admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles[ACLReadWrite].Has(Admin) {
+		t.Errorf("readwrite grants admin")
+	}
+	if !roles[ACLAdmin].Has(All) {
+		t.Errorf("admin doesn't grant all permissions: %v", VerbNames(roles[ACLAdmin]))
+	}
+	if roles["tokens"] != Read|Admin {
+		t.Errorf("custom role: got %v", VerbNames(roles["tokens"]))
+	}
+}
+
+func TestNewRolesBuiltinCantBeRedefined(t *testing.T) {
+	for _, name := range BuiltinRoles() {
+		if _, err := NewRoles(map[string][]string{name: {"read"}}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -1,24 +1,69 @@
 package auth
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+	"time"
+)
 
-// AccessLevel defines type of access.
+// AccessLevel defines type of access as a set of permissions (verbs).
 type AccessLevel int
 
+// Permissions which can be granted for project.
+const (
+	// Read allows to list jobs, their tasks and logs.
+	Read AccessLevel = 1 << iota
+	// Run allows to schedule job for immediate run.
+	Run
+	// Kill allows to kill job's running task.
+	Kill
+	// Edit allows to create and modify jobs.
+	Edit
+	// Delete allows to remove jobs.
+	Delete
+	// Admin allows to manage API tokens (if granted for admin project).
+	Admin
+)
+
 const (
 	// NoAccess means on access at all (read or write).
-	NoAccess AccessLevel = iota
+	NoAccess AccessLevel = 0
 	// ReadOnly means access only for reading.
-	ReadOnly
-	// ReadWrite means access both for reading and writing.
-	ReadWrite
+	ReadOnly = Read
+	// ReadWrite means access both for reading and writing. It doesn't
+	// include Admin which must be granted explicitly.
+	ReadWrite = Read | Run | Kill | Edit | Delete
+	// All means all permissions (Admin included).
+	All = ReadWrite | Admin
 )
 
-// NoneAuthorizer implements dummy authorizer which always grants read and write access.
+// Has tells if all permissions from p are granted.
+func (l AccessLevel) Has(p AccessLevel) bool {
+	return l&p == p
+}
+
+// NoneAuthorizer implements dummy authorizer which always grants all permissions.
 type NoneAuthorizer struct {
 }
 
 // GetProjectAccessLevel returns type of access to project for request sent by client.
 func (*NoneAuthorizer) GetProjectAccessLevel(*http.Request, string, string) (AccessLevel, error) {
-	return ReadWrite, nil
+	return All, nil
+}
+
+// CredentialsExpirer is implemented by authorizers which can tell when
+// credentials sent with request stop being valid (e.g. JWT's exp claim) so
+// access level isn't cached for longer.
+type CredentialsExpirer interface {
+	CredentialsExpiry(r *http.Request) (time.Time, bool)
+}
+
+// BearerToken returns token passed in "Authorization: Bearer" header or
+// empty string if there is no such header.
+func BearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[7:])
 }
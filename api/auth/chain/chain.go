@@ -0,0 +1,108 @@
+package chain
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/conf"
+	log "github.com/sirupsen/logrus"
+)
+
+type authorizer interface {
+	GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error)
+}
+
+// Member is an authorizer used by chain.
+type Member struct {
+	// Name of backend (e.g. "ldap") telling which credentials it accepts.
+	Backend    string
+	Authorizer authorizer
+}
+
+// accepts tells if request carries credentials backend can check. Backends
+// not relying on credentials accept every request.
+func (m *Member) accepts(r *http.Request) bool {
+	switch m.Backend {
+	case conf.APIAuthBackendLDAP:
+		_, _, ok := r.BasicAuth()
+		return ok
+	case conf.APIAuthBackendGitLab:
+		return r.Header.Get("X-Token") != ""
+	case conf.APIAuthBackendJWT:
+		return auth.BearerToken(r) != ""
+	default:
+		return true
+	}
+}
+
+// Authorizer tries authorizers in order, skipping ones which can't check
+// credentials sent with request (e.g. LDAP if there is no Basic auth).
+//
+// With "first" policy access level returned by the first authorizer granting
+// any access is used. With "max" policy permissions granted by all
+// authorizers are combined.
+// Errors are returned only if no authorizer granted access.
+type Authorizer struct {
+	members []Member
+	policy  string
+}
+
+// GetProjectAccessLevel returns type of access to project for request sent by client.
+func (a *Authorizer) GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error) {
+	lvl := auth.NoAccess
+	var errs *multierror.Error
+	for i := range a.members {
+		m := &a.members[i]
+		if !m.accepts(r) {
+			continue
+		}
+		memberLvl, err := m.Authorizer.GetProjectAccessLevel(r, group, project)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %s", m.Backend, err))
+			continue
+		}
+		log.Debugf("Permissions from %s backend: %v", m.Backend, auth.VerbNames(memberLvl))
+		lvl |= memberLvl
+		if lvl == auth.All || (lvl != auth.NoAccess && a.policy == conf.APIAuthChainPolicyFirst) {
+			return lvl, nil
+		}
+	}
+	if lvl != auth.NoAccess {
+		return lvl, nil
+	}
+	return auth.NoAccess, errs.ErrorOrNil()
+}
+
+// CredentialsExpiry returns the earliest expiration time of credentials
+// checked by members accepting request.
+func (a *Authorizer) CredentialsExpiry(r *http.Request) (time.Time, bool) {
+	var earliest time.Time
+	found := false
+	for i := range a.members {
+		m := &a.members[i]
+		e, ok := m.Authorizer.(auth.CredentialsExpirer)
+		if !ok || !m.accepts(r) {
+			continue
+		}
+		exp, ok := e.CredentialsExpiry(r)
+		if ok && (!found || exp.Before(earliest)) {
+			earliest = exp
+			found = true
+		}
+	}
+	return earliest, found
+}
+
+// New returns authorizer combining members according to policy.
+func New(members []Member, policy string) (*Authorizer, error) {
+	if len(members) == 0 {
+		return nil, fmt.Errorf("No backends in chain")
+	}
+	if policy != conf.APIAuthChainPolicyFirst && policy != conf.APIAuthChainPolicyMax {
+		return nil, fmt.Errorf("Unknown chain policy: %s", policy)
+	}
+	return &Authorizer{members: members, policy: policy}, nil
+}
@@ -18,10 +18,20 @@ import (
 type Authorizer struct {
 	addr       string
 	httpClient *http.Client
+	levels     map[gitlab.AccessLevelValue]auth.AccessLevel
 }
 
-// New creates GitLab authorizer.
-func New(c *conf.APIAuthGitLab) (*Authorizer, error) {
+var gitlabLevels = map[string]gitlab.AccessLevelValue{
+	conf.APIAuthGitLabGuest:      gitlab.GuestPermissions,
+	conf.APIAuthGitLabReporter:   gitlab.ReporterPermissions,
+	conf.APIAuthGitLabDeveloper:  gitlab.DeveloperPermissions,
+	conf.APIAuthGitLabMaintainer: gitlab.MaintainerPermissions,
+	conf.APIAuthGitLabOwner:      gitlab.OwnerPermissions,
+}
+
+// New creates GitLab authorizer. GitLab access levels are mapped to roles
+// as configured. Levels without role don't grant any access.
+func New(c *conf.APIAuthGitLab, roles auth.Roles) (*Authorizer, error) {
 	var httpClient *http.Client
 	if c.CACert != "" {
 		pool, err := tlsutils.BuildCertPool(c.CACert)
@@ -37,9 +47,22 @@ func New(c *conf.APIAuthGitLab) (*Authorizer, error) {
 	if c.Addr == "" {
 		return nil, errors.New("GitLab address not set")
 	}
+	levels := make(map[gitlab.AccessLevelValue]auth.AccessLevel)
+	for name, role := range c.Roles {
+		lvl, ok := gitlabLevels[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown GitLab access level: %s", name)
+		}
+		perms, ok := roles[role]
+		if !ok {
+			return nil, fmt.Errorf("Unknown role for GitLab access level %s: %s", name, role)
+		}
+		levels[lvl] = perms
+	}
 	a := Authorizer{
 		addr:       c.Addr,
 		httpClient: httpClient,
+		levels:     levels,
 	}
 	return &a, nil
 }
@@ -98,11 +121,5 @@ func (a *Authorizer) GetProjectAccessLevel(r *http.Request, group string, projec
 			}
 		}
 	}
-	if lvl >= gitlab.DeveloperPermissions {
-		return auth.ReadWrite, nil
-	} else if lvl == gitlab.ReporterPermissions {
-		return auth.ReadOnly, nil
-	} else {
-		return auth.NoAccess, nil
-	}
+	return a.levels[lvl], nil
 }
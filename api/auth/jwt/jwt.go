@@ -0,0 +1,357 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/conf"
+	tlsutils "github.com/mlowicki/rhythm/tls"
+	log "github.com/sirupsen/logrus"
+)
+
+// Authorizer provides access control level for requests carrying JWT (e.g.
+// ID token issued by OpenID Connect provider) in "Authorization: Bearer"
+// header. Access is granted according to ACLs matched against claims.
+type Authorizer struct {
+	keys               *keySet
+	issuer             string
+	audience           string
+	algorithms         map[string]bool
+	leeway             time.Duration
+	usernameClaim      string
+	groupsClaim        string
+	userACL            auth.ACL
+	groupACL           auth.ACL
+	roles              auth.Roles
+	caseSensitiveNames bool
+}
+
+// Supported signing algorithms. Symmetric ones (HS*) aren't supported as
+// server would need to share secret with identity provider.
+var supportedAlgorithms = [...]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type token struct {
+	header    header
+	claims    map[string]interface{}
+	signed    string
+	signature []byte
+}
+
+func parse(raw string) (*token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed token")
+	}
+	var t token
+	if err := decodeSegment(parts[0], &t.header); err != nil {
+		return nil, fmt.Errorf("Invalid header: %s", err)
+	}
+	if err := decodeSegment(parts[1], &t.claims); err != nil {
+		return nil, fmt.Errorf("Invalid claims: %s", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signature: %s", err)
+	}
+	t.signed = parts[0] + "." + parts[1]
+	t.signature = sig
+	return &t, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func hashFor(alg string) crypto.Hash {
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256
+	case "384":
+		return crypto.SHA384
+	default:
+		return crypto.SHA512
+	}
+}
+
+func verifySignature(t *token, key crypto.PublicKey) bool {
+	h := hashFor(t.header.Alg)
+	hasher := h.New()
+	hasher.Write([]byte(t.signed))
+	digest := hasher.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(t.header.Alg, "RS") {
+			return false
+		}
+		return rsa.VerifyPKCS1v15(k, h, digest, t.signature) == nil
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(t.header.Alg, "ES") || curveFor(t.header.Alg) != k.Curve.Params().Name {
+			return false
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
+
+// curveFor returns name of curve which must be used with ECDSA algorithm.
+func curveFor(alg string) string {
+	switch alg {
+	case "ES256":
+		return "P-256"
+	case "ES384":
+		return "P-384"
+	default:
+		return "P-521"
+	}
+}
+
+// verify checks token's signature and registered claims.
+func (a *Authorizer) verify(t *token, keys []crypto.PublicKey) error {
+	if !a.algorithms[t.header.Alg] {
+		return fmt.Errorf("Unsupported signing algorithm: %s", t.header.Alg)
+	}
+	verified := false
+	for _, key := range keys {
+		if verifySignature(t, key) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return errors.New("Invalid signature")
+	}
+	now := time.Now()
+	exp, ok := t.claims["exp"].(float64)
+	if !ok {
+		return errors.New("Missing exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.leeway)) {
+		return errors.New("Token expired")
+	}
+	if nbf, ok := t.claims["nbf"].(float64); ok {
+		if now.Add(a.leeway).Before(time.Unix(int64(nbf), 0)) {
+			return errors.New("Token not valid yet")
+		}
+	}
+	if a.issuer != "" {
+		iss, _ := t.claims["iss"].(string)
+		if strings.TrimSuffix(iss, "/") != strings.TrimSuffix(a.issuer, "/") {
+			return fmt.Errorf("Invalid issuer: %s", iss)
+		}
+	}
+	// Audience is always checked as otherwise tokens issued for other
+	// applications (clients) of identity provider would be accepted.
+	found := false
+	for _, aud := range stringValues(t.claims["aud"]) {
+		if aud == a.audience {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.New("Invalid audience")
+	}
+	// Unverified email can't be trusted as anyone could claim it.
+	if a.usernameClaim == "email" {
+		switch v := t.claims["email_verified"].(type) {
+		case bool:
+			if !v {
+				return errors.New("Email not verified")
+			}
+		case string:
+			if v == "false" {
+				return errors.New("Email not verified")
+			}
+		}
+	}
+	return nil
+}
+
+// claim returns value of claim. Nested claims are accessed using dots
+// (e.g. "realm_access.roles").
+func claim(claims map[string]interface{}, name string) interface{} {
+	var v interface{} = claims
+	for _, part := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	return v
+}
+
+// stringValues returns value as list of strings. Claim can be either single
+// string or array of strings (e.g. "aud").
+func stringValues(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// GetProjectAccessLevel returns type of access to project for request sent by client.
+func (a *Authorizer) GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error) {
+	raw := auth.BearerToken(r)
+	if raw == "" {
+		log.Debug("Bearer token not found")
+		return auth.NoAccess, nil
+	}
+	t, err := parse(raw)
+	if err != nil {
+		log.Debugf("Error parsing JWT: %s", err)
+		return auth.NoAccess, nil
+	}
+	keys, err := a.keys.get(t.header.Kid)
+	if err != nil {
+		return auth.NoAccess, fmt.Errorf("Error getting JWT verification keys: %s", err)
+	}
+	if err := a.verify(t, keys); err != nil {
+		log.Debugf("Error verifying JWT: %s", err)
+		return auth.NoAccess, nil
+	}
+	if username, ok := claim(t.claims, a.usernameClaim).(string); ok && username != "" {
+		userLevel := a.userACL.Level(a.roles, a.normalize(username), group, project)
+		if userLevel != auth.NoAccess {
+			return userLevel, nil
+		}
+	}
+	if a.groupsClaim == "" {
+		return auth.NoAccess, nil
+	}
+	groups := stringValues(claim(t.claims, a.groupsClaim))
+	log.Debugf("Found groups: %v", groups)
+	// Permissions granted to all user's groups are combined.
+	lvl := auth.NoAccess
+	for _, g := range groups {
+		lvl |= a.groupACL.Level(a.roles, a.normalize(g), group, project)
+		if lvl == auth.All {
+			break
+		}
+	}
+	return lvl, nil
+}
+
+// CredentialsExpiry returns time set by exp claim of token sent with request.
+// Token isn't verified so it must be called only for requests already
+// authorized by GetProjectAccessLevel.
+func (a *Authorizer) CredentialsExpiry(r *http.Request) (time.Time, bool) {
+	t, err := parse(auth.BearerToken(r))
+	if err != nil {
+		return time.Time{}, false
+	}
+	exp, ok := t.claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
+func (a *Authorizer) normalize(name string) string {
+	if a.caseSensitiveNames {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// New returns fresh instance of JWT authorizer.
+func New(c *conf.APIAuthJWT, roles auth.Roles) (*Authorizer, error) {
+	if c.Issuer == "" && c.JWKSURL == "" && len(c.Keys) == 0 {
+		return nil, errors.New("one of issuer, jwksurl or keys must be set")
+	}
+	if c.Audience == "" {
+		return nil, errors.New("audience is empty")
+	}
+	if c.UsernameClaim == "" {
+		return nil, errors.New("usernameclaim is empty")
+	}
+	err := auth.ACL(c.UserACL).Validate(roles)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid useracl: %s", err)
+	}
+	err = auth.ACL(c.GroupACL).Validate(roles)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid groupacl: %s", err)
+	}
+	algs := make(map[string]bool)
+	for _, alg := range supportedAlgorithms {
+		algs[alg] = len(c.Algorithms) == 0
+	}
+	for _, alg := range c.Algorithms {
+		if _, ok := algs[alg]; !ok {
+			return nil, fmt.Errorf("Unsupported algorithm: %s", alg)
+		}
+		algs[alg] = true
+	}
+	tc := &tls.Config{}
+	if c.CACert != "" {
+		pool, err := tlsutils.BuildCertPool(c.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = pool
+	}
+	ks := &keySet{
+		client: &http.Client{
+			Timeout:   c.Timeout,
+			Transport: &http.Transport{TLSClientConfig: tc},
+		},
+		issuer:  c.Issuer,
+		jwksURL: c.JWKSURL,
+	}
+	for _, path := range c.Keys {
+		keys, err := readKeys(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading keys: %s", err)
+		}
+		ks.static = append(ks.static, keys...)
+	}
+	return &Authorizer{
+		keys:               ks,
+		issuer:             c.Issuer,
+		audience:           c.Audience,
+		algorithms:         algs,
+		leeway:             c.Leeway,
+		usernameClaim:      c.UsernameClaim,
+		groupsClaim:        c.GroupsClaim,
+		userACL:            c.UserACL,
+		groupACL:           c.GroupACL,
+		roles:              roles,
+		caseSensitiveNames: c.CaseSensitiveNames,
+	}, nil
+}
@@ -0,0 +1,267 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/conf"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "rhythm"
+	testUser     = "alice@example.com"
+)
+
+type testIDP struct {
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	srv     *httptest.Server
+	fetches int32
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newTestIDP(t *testing.T) *testIDP {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIDP{rsaKey: rsaKey, ecKey: ecKey}
+	idp.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&idp.fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "rsa",
+					"use": "sig",
+					"n":   b64(rsaKey.N.Bytes()),
+					"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC",
+					"kid": "ec",
+					"crv": "P-256",
+					"x":   b64(ecKey.X.Bytes()),
+					"y":   b64(ecKey.Y.Bytes()),
+				},
+			},
+		})
+	}))
+	return idp
+}
+
+func (idp *testIDP) authorizer(t *testing.T) *Authorizer {
+	roles, err := auth.NewRoles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(&conf.APIAuthJWT{
+		Issuer:        testIssuer,
+		Audience:      testAudience,
+		JWKSURL:       idp.srv.URL,
+		Timeout:       time.Second,
+		UsernameClaim: "email",
+		GroupsClaim:   "groups",
+		UserACL: map[string]map[string]string{
+			testUser: {"*": auth.ACLReadWrite},
+		},
+	}, roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"email": testUser,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func unsigned(alg, kid string, c map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	p, _ := json.Marshal(c)
+	return b64(h) + "." + b64(p)
+}
+
+func (idp *testIDP) signRSA(alg, kid string, c map[string]interface{}) string {
+	signed := unsigned(alg, kid, c)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func (idp *testIDP) signEC(alg, kid string, c map[string]interface{}) string {
+	signed := unsigned(alg, kid, c)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	sig := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(sig[32-len(rb):32], rb)
+	copy(sig[64-len(sb):], sb)
+	return signed + "." + b64(sig)
+}
+
+func level(t *testing.T, a *Authorizer, token string) auth.AccessLevel {
+	r := httptest.NewRequest("GET", "/api/v1/jobs", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	lvl, err := a.GetProjectAccessLevel(r, "group", "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lvl
+}
+
+func TestGetProjectAccessLevel(t *testing.T) {
+	idp := newTestIDP(t)
+	defer idp.srv.Close()
+	a := idp.authorizer(t)
+	pubDER, err := x509.MarshalPKIXPublicKey(&idp.rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256 := func() string {
+		signed := unsigned("HS256", "rsa", claims(nil))
+		mac := hmac.New(sha256.New, pubDER)
+		mac.Write([]byte(signed))
+		return signed + "." + b64(mac.Sum(nil))
+	}
+	truncatedEC := func() string {
+		token := idp.signEC("ES256", "ec", claims(nil))
+		return token[:len(token)-4]
+	}
+	garbageEC := func() string {
+		signed := unsigned("ES256", "ec", claims(nil))
+		sig := make([]byte, 64)
+		for i := range sig {
+			sig[i] = 0xff
+		}
+		return signed + "." + b64(sig)
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  auth.AccessLevel
+	}{
+		{"valid RS256", idp.signRSA("RS256", "rsa", claims(nil)), auth.ReadWrite},
+		{"valid ES256", idp.signEC("ES256", "ec", claims(nil)), auth.ReadWrite},
+		{"RS256 header with EC key", idp.signEC("RS256", "ec", claims(nil)), auth.NoAccess},
+		{"ES256 header with RSA key", idp.signRSA("ES256", "rsa", claims(nil)), auth.NoAccess},
+		{"ES384 header with P-256 key", idp.signEC("ES384", "ec", claims(nil)), auth.NoAccess},
+		{"alg none", unsigned("none", "rsa", claims(nil)) + ".", auth.NoAccess},
+		{"HS256 with public key as secret", hs256(), auth.NoAccess},
+		{"expired", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})), auth.NoAccess},
+		{"without exp", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"exp": nil})), auth.NoAccess},
+		{"not valid yet", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"nbf": time.Now().Add(time.Minute).Unix()})), auth.NoAccess},
+		{"wrong issuer", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"iss": "https://evil.example.com"})), auth.NoAccess},
+		{"wrong audience", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"aud": "other"})), auth.NoAccess},
+		{"audience in list", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"aud": []string{"other", testAudience}})), auth.ReadWrite},
+		{"without audience", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"aud": nil})), auth.NoAccess},
+		{"unverified email", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"email_verified": false})), auth.NoAccess},
+		{"verified email", idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"email_verified": true})), auth.ReadWrite},
+		{"truncated ECDSA signature", truncatedEC(), auth.NoAccess},
+		{"invalid ECDSA signature", garbageEC(), auth.NoAccess},
+		{"tampered claims", idp.signRSA("RS256", "rsa", claims(nil))[:10] + "x" + idp.signRSA("RS256", "rsa", claims(nil))[11:], auth.NoAccess},
+		{"malformed", "not-a-jwt", auth.NoAccess},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := level(t, a, tt.token); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownKidRefetchIsRateLimited(t *testing.T) {
+	idp := newTestIDP(t)
+	defer idp.srv.Close()
+	a := idp.authorizer(t)
+	if got := level(t, a, idp.signRSA("RS256", "rsa", claims(nil))); got != auth.ReadWrite {
+		t.Fatalf("got %v, want %v", got, auth.ReadWrite)
+	}
+	if n := atomic.LoadInt32(&idp.fetches); n != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", n)
+	}
+	unknown := idp.signRSA("RS256", "unknown", claims(nil))
+	for i := 0; i < 5; i++ {
+		if got := level(t, a, unknown); got != auth.NoAccess {
+			t.Fatalf("got %v, want %v", got, auth.NoAccess)
+		}
+	}
+	if n := atomic.LoadInt32(&idp.fetches); n != 1 {
+		t.Fatalf("JWKS fetched %d times within refetch interval, want 1", n)
+	}
+	a.keys.mut.Lock()
+	a.keys.fetched = time.Now().Add(-jwksMinRefetchInterval - time.Second)
+	a.keys.mut.Unlock()
+	level(t, a, unknown)
+	if n := atomic.LoadInt32(&idp.fetches); n != 2 {
+		t.Fatalf("JWKS fetched %d times after refetch interval, want 2", n)
+	}
+}
+
+func TestNewRequiresAudience(t *testing.T) {
+	roles, _ := auth.NewRoles(nil)
+	_, err := New(&conf.APIAuthJWT{JWKSURL: "https://idp.example.com/jwks", UsernameClaim: "email"}, roles)
+	if err == nil {
+		t.Fatal("expected error for missing audience")
+	}
+}
+
+func TestCredentialsExpiry(t *testing.T) {
+	idp := newTestIDP(t)
+	defer idp.srv.Close()
+	a := idp.authorizer(t)
+	exp := time.Now().Add(time.Minute).Unix()
+	r := httptest.NewRequest("GET", "/api/v1/jobs", nil)
+	r.Header.Set("Authorization", "Bearer "+idp.signRSA("RS256", "rsa", claims(map[string]interface{}{"exp": exp})))
+	got, ok := a.CredentialsExpiry(r)
+	if !ok || got.Unix() != exp {
+		t.Errorf("got %v (%v), want %v", got, ok, time.Unix(exp, 0))
+	}
+	r.Header.Set("Authorization", "Bearer malformed")
+	if _, ok := a.CredentialsExpiry(r); ok {
+		t.Error("expiry returned for malformed token")
+	}
+}
@@ -0,0 +1,248 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// jwksTTL tells how long keys fetched from JWKS URL are used before
+	// being fetched again.
+	jwksTTL = time.Hour
+	// jwksMinRefetchInterval limits how often keys are fetched when token
+	// is signed with unknown key (e.g. after rotation) so clients can't
+	// flood identity provider.
+	jwksMinRefetchInterval = 10 * time.Second
+)
+
+// keySet provides public keys used to verify tokens' signatures. Keys are
+// either static (read from PEM files) or fetched from JWKS URL (possibly
+// discovered using OpenID Connect discovery document of issuer).
+type keySet struct {
+	client  *http.Client
+	issuer  string
+	jwksURL string
+	static  []crypto.PublicKey
+	mut     sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	err     error
+}
+
+// get returns keys which can verify token signed with key identified by kid.
+// If kid is empty then all known keys are returned.
+func (ks *keySet) get(kid string) ([]crypto.PublicKey, error) {
+	if !ks.remote() {
+		return ks.static, nil
+	}
+	ks.mut.Lock()
+	defer ks.mut.Unlock()
+	_, known := ks.keys[kid]
+	missing := ks.keys == nil || (kid != "" && !known)
+	age := time.Since(ks.fetched)
+	if age > jwksTTL || (missing && age > jwksMinRefetchInterval) {
+		ks.err = ks.fetch()
+		if ks.err != nil {
+			// Keep using previously fetched keys if identity provider is
+			// temporarily unavailable.
+			log.Errorf("Error fetching JWKS: %s", ks.err)
+		}
+	}
+	if ks.keys == nil {
+		return nil, ks.err
+	}
+	keys := append([]crypto.PublicKey{}, ks.static...)
+	if kid != "" {
+		if key, ok := ks.keys[kid]; ok {
+			keys = append(keys, key)
+		}
+		return keys, nil
+	}
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (ks *keySet) remote() bool {
+	return ks.jwksURL != "" || (ks.issuer != "" && len(ks.static) == 0)
+}
+
+// fetch replaces remote keys with ones from JWKS. Must be called with mutex
+// held.
+func (ks *keySet) fetch() error {
+	ks.fetched = time.Now()
+	if ks.jwksURL == "" {
+		u, err := discoverJWKSURL(ks.client, ks.issuer)
+		if err != nil {
+			return err
+		}
+		ks.jwksURL = u
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ks.client, ks.jwksURL, &jwks); err != nil {
+		return fmt.Errorf("Fetching JWKS failed: %s", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warnf("Skipping JWK %q: %s", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	ks.keys = keys
+	log.Debugf("JWKS fetched from %s (%d keys)", ks.jwksURL, len(keys))
+	return nil
+}
+
+func discoverJWKSURL(client *http.Client, issuer string) (string, error) {
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	u := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(client, u, &doc); err != nil {
+		return "", fmt.Errorf("OpenID Connect discovery failed: %s", err)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("OpenID Connect discovery document without jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+func getJSON(client *http.Client, u string, v interface{}) error {
+	res, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response: %s", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// jwk describes single JSON Web Key (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid modulus: %s", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid exponent: %s", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid x coordinate: %s", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid y coordinate: %s", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("Point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported key type: %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// readKeys reads public keys (or certificates) from PEM encoded file.
+func readKeys(path string) ([]crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var key crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Parsing %s failed: %s", block.Type, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No public keys found in %s", path)
+	}
+	return keys, nil
+}
@@ -33,8 +33,9 @@ type Authorizer struct {
 	userDN             string
 	userAttr           string
 	caCert             *x509.CertPool
-	userACL            map[string]map[string]string
-	groupACL           map[string]map[string]string
+	userACL            auth.ACL
+	groupACL           auth.ACL
+	roles              auth.Roles
 	bindDN             string
 	bindPassword       string
 	groupFilter        string
@@ -43,11 +44,6 @@ type Authorizer struct {
 	caseSensitiveNames bool
 }
 
-const (
-	readonly  = "readonly"
-	readwrite = "readwrite"
-)
-
 var timeoutMut sync.Mutex
 
 // SetTimeout changes timeout used by `ldap` package by setting package-level variable.
@@ -238,7 +234,7 @@ func (a *Authorizer) GetProjectAccessLevel(r *http.Request, group string, projec
 	if err != nil {
 		return auth.NoAccess, err
 	}
-	userLevel := a.getLevelFromACL(&a.userACL, username, group, project)
+	userLevel := a.getLevelFromACL(a.userACL, username, group, project)
 	if userLevel != auth.NoAccess {
 		return userLevel, nil
 	}
@@ -247,63 +243,26 @@ func (a *Authorizer) GetProjectAccessLevel(r *http.Request, group string, projec
 	if err != nil {
 		return auth.NoAccess, err
 	}
-	readOnlyAccess := false
+	// Permissions granted to all user's groups are combined.
+	lvl := auth.NoAccess
 	for _, ldapGroup := range ldapGroups {
-		groupLevel := a.getLevelFromACL(&a.groupACL, ldapGroup, group, project)
-		if groupLevel == auth.ReadWrite {
-			return auth.ReadWrite, nil
-		}
-		if groupLevel == auth.ReadOnly {
-			readOnlyAccess = true
+		lvl |= a.getLevelFromACL(a.groupACL, ldapGroup, group, project)
+		if lvl == auth.All {
+			break
 		}
 	}
-	if readOnlyAccess {
-		return auth.ReadOnly, nil
-	}
-	return auth.NoAccess, nil
+	return lvl, nil
 }
 
-func (a *Authorizer) getLevelFromACL(acl *map[string]map[string]string, name, group, project string) auth.AccessLevel {
+func (a *Authorizer) getLevelFromACL(acl auth.ACL, name, group, project string) auth.AccessLevel {
 	if !a.caseSensitiveNames {
 		name = strings.ToLower(name)
 	}
-	rules, ok := (*acl)[name]
-	if !ok {
-		return auth.NoAccess
-	}
-	keys := [...]string{
-		fmt.Sprintf("%s/%s", group, project),
-		group,
-		"*",
-	}
-	for _, key := range keys {
-		level, ok := rules[key]
-		if !ok {
-			continue
-		}
-		switch level {
-		case readonly:
-			return auth.ReadOnly
-		case readwrite:
-			return auth.ReadWrite
-		}
-	}
-	return auth.NoAccess
-}
-
-func validateACL(acl *map[string]map[string]string) error {
-	for outerKey, rules := range *acl {
-		for innerKey, level := range rules {
-			if level != readonly && level != readwrite {
-				return fmt.Errorf("invalid access level [%s][%s]: %s", outerKey, innerKey, level)
-			}
-		}
-	}
-	return nil
+	return acl.Level(a.roles, name, group, project)
 }
 
 // New returns fresh instance of LDAP authorizer.
-func New(c *conf.APIAuthLDAP) (*Authorizer, error) {
+func New(c *conf.APIAuthLDAP, roles auth.Roles) (*Authorizer, error) {
 	if len(c.Addrs) == 0 {
 		return nil, errors.New("addrs is empty")
 	}
@@ -322,11 +281,11 @@ func New(c *conf.APIAuthLDAP) (*Authorizer, error) {
 	if c.GroupFilter == "" {
 		return nil, errors.New("groupfilter is empty")
 	}
-	err := validateACL(&c.UserACL)
+	err := auth.ACL(c.UserACL).Validate(roles)
 	if err != nil {
 		return nil, fmt.Errorf("Invalid useracl: %s", err)
 	}
-	err = validateACL(&c.GroupACL)
+	err = auth.ACL(c.GroupACL).Validate(roles)
 	if err != nil {
 		return nil, fmt.Errorf("Invalid groupacl: %s", err)
 	}
@@ -336,6 +295,7 @@ func New(c *conf.APIAuthLDAP) (*Authorizer, error) {
 		userAttr:           c.UserAttr,
 		userACL:            c.UserACL,
 		groupACL:           c.GroupACL,
+		roles:              roles,
 		bindDN:             c.BindDN,
 		bindPassword:       c.BindPassword,
 		groupFilter:        c.GroupFilter,
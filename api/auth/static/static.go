@@ -0,0 +1,48 @@
+package static
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/conf"
+)
+
+// everyone is the only name in ACL as rules apply to all requests.
+const everyone = "*"
+
+// Authorizer grants access defined in ACL file to every request regardless
+// of credentials. It's useful as a baseline (e.g. read-only access to all
+// projects) in chain of authorizers.
+type Authorizer struct {
+	acl   auth.ACL
+	roles auth.Roles
+}
+
+// GetProjectAccessLevel returns type of access to project for request sent by client.
+func (a *Authorizer) GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error) {
+	return a.acl.Level(a.roles, everyone, group, project), nil
+}
+
+// New returns authorizer using rules read from file. File contains JSON
+// object mapping project ("group/project"), group ("group") or all projects
+// ("*") to role (e.g. "readonly" or "readwrite").
+func New(c *conf.APIAuthStatic, roles auth.Roles) (*Authorizer, error) {
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading ACL file: %s", err)
+	}
+	var rules map[string]string
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding ACL file: %s", err)
+	}
+	acl := auth.ACL{everyone: rules}
+	err = acl.Validate(roles)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid ACL file: %s", err)
+	}
+	return &Authorizer{acl: acl, roles: roles}, nil
+}
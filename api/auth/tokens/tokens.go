@@ -0,0 +1,62 @@
+package tokens
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/model"
+	log "github.com/sirupsen/logrus"
+)
+
+type storage interface {
+	GetAPIToken(id string) (*model.APIToken, error)
+}
+
+type authorizer interface {
+	GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error)
+}
+
+// Authorizer provides access control level for requests with API tokens
+// issued by Rhythm. Requests without such token are passed to next
+// authorizer.
+type Authorizer struct {
+	storage storage
+	next    authorizer
+	roles   auth.Roles
+}
+
+// GetProjectAccessLevel returns type of access to project for request sent by client.
+func (a *Authorizer) GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error) {
+	id, secret, ok := model.ParseAPIToken(auth.BearerToken(r))
+	if !ok {
+		return a.next.GetProjectAccessLevel(r, group, project)
+	}
+	if !model.ValidAPITokenID(id) {
+		log.Debug("Malformed API token ID")
+		return auth.NoAccess, nil
+	}
+	token, err := a.storage.GetAPIToken(id)
+	if err != nil {
+		return auth.NoAccess, err
+	}
+	if token == nil || !token.Verify(secret) {
+		log.Debugf("Invalid API token: %s", id)
+		return auth.NoAccess, nil
+	}
+	if token.Expired(time.Now()) {
+		log.Debugf("API token expired: %s", id)
+		return auth.NoAccess, nil
+	}
+	if !token.Covers(group, project) {
+		return auth.NoAccess, nil
+	}
+	// Tokens with role which isn't defined anymore don't grant any access.
+	return a.roles[token.Access], nil
+}
+
+// New creates authorizer accepting API tokens stored in s. Other requests
+// are authorized by next. Token's access is resolved using roles.
+func New(s storage, next authorizer, roles auth.Roles) *Authorizer {
+	return &Authorizer{storage: s, next: next, roles: roles}
+}
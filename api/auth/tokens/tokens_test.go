@@ -0,0 +1,79 @@
+package tokens
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/model"
+)
+
+type fakeStorage struct {
+	tokens map[string]*model.APIToken
+}
+
+func (s *fakeStorage) GetAPIToken(id string) (*model.APIToken, error) {
+	// ZooKeeper rejects paths with e.g. slashes or dots.
+	if strings.ContainsAny(id, "/.") {
+		return nil, errors.New("invalid path")
+	}
+	return s.tokens[id], nil
+}
+
+type denyAll struct{}
+
+func (denyAll) GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error) {
+	return auth.NoAccess, nil
+}
+
+func TestGetProjectAccessLevel(t *testing.T) {
+	token, value, err := model.NewAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.Scope = "group/project"
+	token.Access = auth.ACLReadOnly
+	expired, expiredValue, err := model.NewAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.Scope = "*"
+	expired.Access = auth.ACLReadWrite
+	expired.Expires = time.Now().Add(-time.Minute)
+	s := &fakeStorage{tokens: map[string]*model.APIToken{token.ID: token, expired.ID: expired}}
+	roles, err := auth.NewRoles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(s, denyAll{}, roles)
+	tests := []struct {
+		name    string
+		value   string
+		project string
+		want    auth.AccessLevel
+	}{
+		{"valid", value, "project", auth.ReadOnly},
+		{"out of scope", value, "other", auth.NoAccess},
+		{"wrong secret", value[:len(value)-1] + "0", "project", auth.NoAccess},
+		{"expired", expiredValue, "project", auth.NoAccess},
+		{"unknown", "rht_0123456789abcdef_secret", "project", auth.NoAccess},
+		{"malformed ID", "rht_../../x_secret", "project", auth.NoAccess},
+		{"ID with dots", "rht_a.b_secret", "project", auth.NoAccess},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/jobs", nil)
+		r.Header.Set("Authorization", "Bearer "+tt.value)
+		lvl, err := a.GetProjectAccessLevel(r, "group", tt.project)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if lvl != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, lvl, tt.want)
+		}
+	}
+}
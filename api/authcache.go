@@ -0,0 +1,152 @@
+package api
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxAuthCacheEntries bounds memory used by cache as clients can send any
+// number of distinct (e.g. invalid) credentials.
+const maxAuthCacheEntries = 10000
+
+var (
+	authCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_auth_cache_requests",
+		Help: "Number of authorization decisions served by cache (hit or negative_hit) or by backend (miss).",
+	}, []string{"result"})
+	authBackendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "api_auth_backend_duration_seconds",
+		Help:    "Time taken by authorization backend to return access level.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"backend"})
+)
+
+func init() {
+	prometheus.MustRegister(authCacheRequests)
+	prometheus.MustRegister(authBackendDuration)
+}
+
+type authCacheKey struct {
+	principal [sha256.Size]byte
+	group     string
+	project   string
+}
+
+type authCacheEntry struct {
+	lvl     auth.AccessLevel
+	expires time.Time
+}
+
+// authCache keeps access levels returned by authorizer per principal and
+// project. Decisions granting no access are kept for negativeTTL which is
+// usually shorter so newly granted access is visible quickly. Entries never
+// outlive credentials if authorizer can tell when they expire. Errors aren't
+// cached.
+type authCache struct {
+	a           authorizer
+	backend     string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	mut         sync.Mutex
+	entries     map[authCacheKey]authCacheEntry
+	lastSweep   time.Time
+}
+
+func newAuthCache(a authorizer, backend string, ttl, negativeTTL time.Duration) *authCache {
+	return &authCache{
+		a:           a,
+		backend:     backend,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[authCacheKey]authCacheEntry),
+		lastSweep:   time.Now(),
+	}
+}
+
+// principal identifies credentials sent with request. Only hash is kept so
+// credentials aren't stored in memory longer than needed.
+func principal(r *http.Request) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(r.Header.Get("Authorization")))
+	h.Write([]byte{0})
+	h.Write([]byte(r.Header.Get("X-Token")))
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func (c *authCache) GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error) {
+	key := authCacheKey{principal(r), group, project}
+	now := time.Now()
+	c.mut.Lock()
+	entry, ok := c.entries[key]
+	c.mut.Unlock()
+	if ok && now.Before(entry.expires) {
+		if entry.lvl == auth.NoAccess {
+			authCacheRequests.WithLabelValues("negative_hit").Inc()
+		} else {
+			authCacheRequests.WithLabelValues("hit").Inc()
+		}
+		return entry.lvl, nil
+	}
+	authCacheRequests.WithLabelValues("miss").Inc()
+	lvl, err := c.a.GetProjectAccessLevel(r, group, project)
+	authBackendDuration.WithLabelValues(c.backend).Observe(time.Since(now).Seconds())
+	if err != nil {
+		return lvl, err
+	}
+	ttl := c.ttl
+	if lvl == auth.NoAccess {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return lvl, nil
+	}
+	expires := now.Add(ttl)
+	if e, ok := c.a.(auth.CredentialsExpirer); ok {
+		if exp, ok := e.CredentialsExpiry(r); ok && exp.Before(expires) {
+			if !now.Before(exp) {
+				return lvl, nil
+			}
+			expires = exp
+		}
+	}
+	c.mut.Lock()
+	if now.Sub(c.lastSweep) > c.sweepInterval() || len(c.entries) >= maxAuthCacheEntries {
+		c.sweep(now)
+	}
+	if len(c.entries) < maxAuthCacheEntries {
+		c.entries[key] = authCacheEntry{lvl: lvl, expires: expires}
+	}
+	c.mut.Unlock()
+	return lvl, nil
+}
+
+// flush removes all entries.
+func (c *authCache) flush() {
+	c.mut.Lock()
+	c.entries = make(map[authCacheKey]authCacheEntry)
+	c.mut.Unlock()
+}
+
+func (c *authCache) sweepInterval() time.Duration {
+	if c.negativeTTL > c.ttl {
+		return c.negativeTTL
+	}
+	return c.ttl
+}
+
+// sweep removes expired entries. Must be called with mutex held.
+func (c *authCache) sweep(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.lastSweep = now
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/model"
+)
+
+// expiringAuthorizer grants lvl and tells credentials expire at exp.
+type expiringAuthorizer struct {
+	lvl   auth.AccessLevel
+	exp   time.Time
+	calls int
+}
+
+func (a *expiringAuthorizer) GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error) {
+	a.calls++
+	return a.lvl, nil
+}
+
+func (a *expiringAuthorizer) CredentialsExpiry(r *http.Request) (time.Time, bool) {
+	return a.exp, true
+}
+
+func TestAuthCacheEntryCappedAtCredentialsExpiry(t *testing.T) {
+	a := &expiringAuthorizer{lvl: auth.ReadOnly, exp: time.Now().Add(50 * time.Millisecond)}
+	c := newAuthCache(a, "jwt", time.Hour, time.Hour)
+	r := httptest.NewRequest("GET", "/api/v1/jobs", nil)
+	r.Header.Set("Authorization", "Bearer x")
+	c.GetProjectAccessLevel(r, "group", "project")
+	c.GetProjectAccessLevel(r, "group", "project")
+	if a.calls != 1 {
+		t.Fatalf("got %d backend calls before expiry, want 1", a.calls)
+	}
+	time.Sleep(60 * time.Millisecond)
+	c.GetProjectAccessLevel(r, "group", "project")
+	if a.calls != 2 {
+		t.Fatalf("got %d backend calls after expiry, want 2", a.calls)
+	}
+	// Expired credentials aren't cached at all.
+	c.GetProjectAccessLevel(r, "group", "project")
+	if a.calls != 3 {
+		t.Fatalf("got %d backend calls, want 3", a.calls)
+	}
+}
+
+func TestAuthCacheFlushedOnTokenRevocation(t *testing.T) {
+	a := &expiringAuthorizer{lvl: auth.All, exp: time.Now().Add(time.Hour)}
+	c := newAuthCache(a, "jwt", time.Hour, time.Hour)
+	ra := &reloadableAuthorizer{a: c, cache: c}
+	ta := &tokenAdmin{conf: conf.APIAuthTokens{Enabled: true, AdminProject: "admin/tokens"}}
+	s := &tokensStorage{saved: []*model.APIToken{{ID: "0123456789abcdef"}}}
+	r := httptest.NewRequest("DELETE", "/api/v1/tokens/0123456789abcdef", nil)
+	r = mux.SetURLVars(r, map[string]string{"id": "0123456789abcdef"})
+	w := httptest.NewRecorder()
+	if err := ta.revokeToken(ra, s, w, r); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.saved) != 0 {
+		t.Fatal("token not deleted")
+	}
+	ra.GetProjectAccessLevel(r, "admin", "tokens")
+	if a.calls != 2 {
+		t.Fatalf("got %d backend calls, want 2", a.calls)
+	}
+}
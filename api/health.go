@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mlowicki/rhythm/health"
+	"github.com/tevino/abool"
+)
+
+func getHealth(state *State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoder(w).Encode(struct {
+			ServerTime string
+			Version    string
+			Leader     bool
+		}{
+			time.Now().Format(time.UnixDate),
+			state.Version,
+			state.IsLeader(),
+		})
+	}
+}
+
+// getLiveness reports if server is running. It doesn't check any dependencies
+// so failure of e.g. ZooKeeper doesn't cause restarts of all instances.
+func getLiveness(state *State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoder(w).Encode(struct {
+			Live       bool
+			ServerTime string
+		}{
+			true,
+			time.Now().Format(time.UnixDate),
+		})
+	}
+}
+
+// checkTimeout bounds how long readiness waits for single check (e.g. Vault
+// health request) so slow dependency doesn't make probes time out.
+const checkTimeout = time.Second * 2
+
+// getReadiness reports state of all dependencies. Returns 503 if any of them
+// isn't healthy or server is shutting down.
+func getReadiness(state *State, readOnly *abool.AtomicBool) http.HandlerFunc {
+	runner := newCheckRunner(state.Checks, checkTimeout)
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := runner.run()
+		if readOnly.IsSet() {
+			checks["api"] = health.Check{Message: errShuttingDown.Error()}
+		}
+		ready := true
+		for _, check := range checks {
+			if !check.Healthy {
+				ready = false
+			}
+		}
+		enc := encoder(w)
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc.Encode(struct {
+			Ready      bool
+			ServerTime string
+			Version    string
+			Leader     bool
+			Checks     map[string]health.Check
+		}{
+			ready,
+			time.Now().Format(time.UnixDate),
+			state.Version,
+			state.IsLeader(),
+			checks,
+		})
+	}
+}
+
+// checkRunner runs checks concurrently. Check not finished within timeout is
+// reported as unhealthy and isn't started again until it finishes so hanging
+// dependency doesn't pile up goroutines.
+type checkRunner struct {
+	checkers map[string]health.Checker
+	timeout  time.Duration
+	mut      sync.Mutex
+	running  map[string]bool
+}
+
+func newCheckRunner(checkers map[string]health.Checker, timeout time.Duration) *checkRunner {
+	return &checkRunner{
+		checkers: checkers,
+		timeout:  timeout,
+		running:  make(map[string]bool),
+	}
+}
+
+type checkResult struct {
+	name  string
+	check health.Check
+}
+
+func (c *checkRunner) run() map[string]health.Check {
+	checks := make(map[string]health.Check, len(c.checkers))
+	results := make(chan checkResult, len(c.checkers))
+	started := 0
+	c.mut.Lock()
+	for name, checker := range c.checkers {
+		if c.running[name] {
+			checks[name] = health.Check{Message: "Previous check still running"}
+			continue
+		}
+		c.running[name] = true
+		started++
+		go func(name string, checker health.Checker) {
+			check := checker.Check()
+			c.mut.Lock()
+			delete(c.running, name)
+			c.mut.Unlock()
+			results <- checkResult{name, check}
+		}(name, checker)
+	}
+	c.mut.Unlock()
+	timeout := time.NewTimer(c.timeout)
+	defer timeout.Stop()
+	for ; started > 0; started-- {
+		select {
+		case res := <-results:
+			checks[res.name] = res.check
+		case <-timeout.C:
+			for name := range c.checkers {
+				if _, ok := checks[name]; !ok {
+					checks[name] = health.Check{Message: "Check timed out"}
+				}
+			}
+			return checks
+		}
+	}
+	return checks
+}
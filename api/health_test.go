@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/health"
+)
+
+type checkerFunc func() health.Check
+
+func (f checkerFunc) Check() health.Check { return f() }
+
+func TestCheckRunnerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	runner := newCheckRunner(map[string]health.Checker{
+		"fast": checkerFunc(func() health.Check { return health.Check{Healthy: true} }),
+		"slow": checkerFunc(func() health.Check {
+			<-release
+			return health.Check{Healthy: true}
+		}),
+	}, time.Millisecond*50)
+	start := time.Now()
+	checks := runner.run()
+	if time.Since(start) > time.Second {
+		t.Fatal("run waited for slow check")
+	}
+	if !checks["fast"].Healthy {
+		t.Error("expected fast check to be healthy")
+	}
+	if checks["slow"].Healthy || checks["slow"].Message != "Check timed out" {
+		t.Errorf("unexpected slow check: %+v", checks["slow"])
+	}
+	checks = runner.run()
+	if checks["slow"].Message != "Previous check still running" {
+		t.Errorf("unexpected slow check while previous is running: %+v", checks["slow"])
+	}
+	close(release)
+	for i := 0; i < 100; i++ {
+		checks = runner.run()
+		if checks["slow"].Healthy {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Errorf("slow check not healthy after release: %+v", checks["slow"])
+}
@@ -29,6 +29,79 @@ const (
 
 type schema map[string]interface{}
 
+// secretSchema describes secret's reference given either as "path",
+// "path#key" or as object.
+func secretSchema(expand bool) schema {
+	obj := schema{
+		"type": "object",
+		"properties": schema{
+			"Path": schema{
+				"type":      "string",
+				"minLength": 1,
+			},
+			"Key": schema{
+				"type": "string",
+			},
+			"Version": schema{
+				"type":    "integer",
+				"minimum": 0,
+			},
+		},
+		"required": []string{"Path"},
+	}
+	if expand {
+		obj["properties"].(schema)["Expand"] = schema{
+			"type": "boolean",
+		}
+		obj["not"] = schema{
+			"required": []string{"Key", "Expand"},
+		}
+	} else {
+		obj["not"] = schema{
+			"required": []string{"Expand"},
+		}
+	}
+	return schema{
+		"oneOf": []schema{
+			{
+				"type":      "string",
+				"minLength": 1,
+			},
+			obj,
+		},
+	}
+}
+
+// secretsSchema describes map of environment variables to secrets.
+func secretsSchema(types ...string) schema {
+	return schema{
+		"type":                 types,
+		"additionalProperties": secretSchema(true),
+	}
+}
+
+// secretFilesSchema describes list of secrets delivered as files.
+func secretFilesSchema(types ...string) schema {
+	return schema{
+		"type": types,
+		"items": schema{
+			"type": "object",
+			"properties": schema{
+				"Path": schema{
+					"type":      "string",
+					"minLength": 1,
+				},
+				"Secret": secretSchema(false),
+				"Mode": schema{
+					"type":    "string",
+					"pattern": "^(0?[0-7]{3})?$",
+				},
+			},
+			"required": []string{"Path", "Secret"},
+		},
+	}
+}
+
 type newJobPayload struct {
 	Group    string
 	Project  string
@@ -36,9 +109,10 @@ type newJobPayload struct {
 	Schedule struct {
 		Cron string
 	}
-	Env       map[string]string
-	Secrets   map[string]string
-	Container struct {
+	Env         map[string]string
+	Secrets     map[string]model.JobSecret
+	SecretFiles []model.JobSecretFile
+	Container   struct {
 		Docker struct {
 			Image          string
 			ForcePullImage bool
@@ -47,15 +121,21 @@ type newJobPayload struct {
 			Image string
 		}
 	}
-	CPUs       float64
-	Mem        float64
-	Disk       float64
-	Cmd        string
-	User       string
-	Shell      *bool
-	Arguments  []string
-	Labels     map[string]string
-	MaxRetries int
+	CPUs          float64
+	Mem           float64
+	Disk          float64
+	Cmd           string
+	User          string
+	Shell         *bool
+	Arguments     []string
+	Labels        map[string]string
+	MaxRetries    int
+	TaskRetention struct {
+		MinCount int
+		MaxCount int
+		MaxAge   int
+	}
+	RestartOnSecretsRotation bool
 }
 
 var newJobSchema = schema{
@@ -83,6 +163,8 @@ var newJobSchema = schema{
 			},
 			"required": []string{"Cron"},
 		},
+		"Secrets":     secretsSchema("object", "null"),
+		"SecretFiles": secretFilesSchema("array", "null"),
 		"Container": schema{
 			"type": "object",
 			"oneOf": []schema{
@@ -132,6 +214,26 @@ var newJobSchema = schema{
 			"type":    "integer",
 			"minimum": 0,
 		},
+		"RestartOnSecretsRotation": schema{
+			"type": "boolean",
+		},
+		"TaskRetention": schema{
+			"type": "object",
+			"properties": schema{
+				"MinCount": schema{
+					"type":    "integer",
+					"minimum": 0,
+				},
+				"MaxCount": schema{
+					"type":    "integer",
+					"minimum": 0,
+				},
+				"MaxAge": schema{
+					"type":    "integer",
+					"minimum": 0,
+				},
+			},
+		},
 	},
 	"required": []string{"Group", "Project", "ID", "Schedule", "Mem", "CPUs"},
 }
@@ -140,9 +242,10 @@ type updateJobPayload struct {
 	Schedule *struct {
 		Cron *string
 	}
-	Env       *map[string]string
-	Secrets   *map[string]string
-	Container *struct {
+	Env         *map[string]string
+	Secrets     *map[string]model.JobSecret
+	SecretFiles *[]model.JobSecretFile
+	Container   *struct {
 		Docker *struct {
 			Image          *string
 			ForcePullImage *bool
@@ -151,15 +254,21 @@ type updateJobPayload struct {
 			Image *string
 		}
 	}
-	CPUs       *float64
-	Mem        *float64
-	Disk       *float64
-	Cmd        *string
-	User       *string
-	Shell      *bool
-	Arguments  *[]string
-	Labels     *map[string]string
-	MaxRetries *int
+	CPUs          *float64
+	Mem           *float64
+	Disk          *float64
+	Cmd           *string
+	User          *string
+	Shell         *bool
+	Arguments     *[]string
+	Labels        *map[string]string
+	MaxRetries    *int
+	TaskRetention *struct {
+		MinCount *int
+		MaxCount *int
+		MaxAge   *int
+	}
+	RestartOnSecretsRotation *bool
 }
 
 var updateJobSchema = schema{
@@ -175,6 +284,8 @@ var updateJobSchema = schema{
 			},
 			"required": []string{"Cron"},
 		},
+		"Secrets":     secretsSchema("object", "null"),
+		"SecretFiles": secretFilesSchema("array", "null"),
 		"Container": schema{
 			"type": []string{"object", "null"},
 			"anyOf": []schema{
@@ -228,5 +339,54 @@ var updateJobSchema = schema{
 			"type":    []string{"integer", "null"},
 			"minimum": 0,
 		},
+		"RestartOnSecretsRotation": schema{
+			"type": []string{"boolean", "null"},
+		},
+		"TaskRetention": schema{
+			"type": []string{"object", "null"},
+			"properties": schema{
+				"MinCount": schema{
+					"type":    []string{"integer", "null"},
+					"minimum": 0,
+				},
+				"MaxCount": schema{
+					"type":    []string{"integer", "null"},
+					"minimum": 0,
+				},
+				"MaxAge": schema{
+					"type":    []string{"integer", "null"},
+					"minimum": 0,
+				},
+			},
+		},
+	},
+}
+
+type newTokenPayload struct {
+	Description string
+	Scope       string
+	Access      string
+	TTL         int
+}
+
+var newTokenSchema = schema{
+	"type": "object",
+	"properties": schema{
+		"Description": schema{
+			"type": "string",
+		},
+		"Scope": schema{
+			"type":    "string",
+			"pattern": "^(\\*|[a-zA-Z0-9-_]+(/[a-zA-Z0-9-_]+)?)$",
+		},
+		"Access": schema{
+			"type":      "string",
+			"minLength": 1,
+		},
+		"TTL": schema{
+			"type":    "integer",
+			"minimum": 0,
+		},
 	},
+	"required": []string{"Scope", "Access"},
 }
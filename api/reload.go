@@ -0,0 +1,176 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/api/auth/chain"
+	"github.com/mlowicki/rhythm/api/auth/gitlab"
+	"github.com/mlowicki/rhythm/api/auth/jwt"
+	"github.com/mlowicki/rhythm/api/auth/ldap"
+	"github.com/mlowicki/rhythm/api/auth/static"
+	"github.com/mlowicki/rhythm/api/auth/tokens"
+	"github.com/mlowicki/rhythm/conf"
+)
+
+func newBackend(backend string, c *conf.APIAuth, roles auth.Roles) (authorizer, error) {
+	switch backend {
+	case conf.APIAuthBackendGitLab:
+		return gitlab.New(&c.GitLab, roles)
+	case conf.APIAuthBackendNone:
+		return &auth.NoneAuthorizer{}, nil
+	case conf.APIAuthBackendLDAP:
+		return ldap.New(&c.LDAP, roles)
+	case conf.APIAuthBackendJWT:
+		return jwt.New(&c.JWT, roles)
+	case conf.APIAuthBackendStatic:
+		return static.New(&c.Static, roles)
+	case conf.APIAuthBackendChain:
+		members := make([]chain.Member, 0, len(c.Chain.Backends))
+		for _, b := range c.Chain.Backends {
+			if b == conf.APIAuthBackendChain {
+				return nil, errors.New("Chain can't contain another chain")
+			}
+			// None backend grants full access to every request.
+			if b == conf.APIAuthBackendNone {
+				return nil, errors.New("Chain can't contain none backend")
+			}
+			a, err := newBackend(b, c, roles)
+			if err != nil {
+				return nil, fmt.Errorf("Error creating %s backend: %s", b, err)
+			}
+			members = append(members, chain.Member{Backend: b, Authorizer: a})
+		}
+		return chain.New(members, c.Chain.Policy)
+	default:
+		return nil, fmt.Errorf("Unknown authorization backend: %s", backend)
+	}
+}
+
+// newAuthorizer builds authorizer out of configuration. Returned cache is nil
+// if caching is disabled.
+func newAuthorizer(c *conf.APIAuth, s storage, roles auth.Roles) (authorizer, *authCache, error) {
+	a, err := newBackend(c.Backend, c, roles)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Backend == conf.APIAuthBackendNone {
+		return a, nil, nil
+	}
+	var cache *authCache
+	if c.CacheTTL != 0 || c.NegativeCacheTTL != 0 {
+		cache = newAuthCache(a, c.Backend, c.CacheTTL, c.NegativeCacheTTL)
+		a = cache
+	}
+	// API tokens are checked in front of cache so revoked token is rejected
+	// right away.
+	if c.Tokens.Enabled {
+		a = tokens.New(s, a, roles)
+	}
+	return a, cache, nil
+}
+
+// setLDAPTimeout applies LDAP timeout. It's a package-level setting of LDAP
+// library so it's changed only once authorizer is put in use.
+func setLDAPTimeout(c *conf.APIAuth) {
+	if c.Uses(conf.APIAuthBackendLDAP) {
+		ldap.SetTimeout(c.LDAP.Timeout)
+	}
+}
+
+// reloadableAuthorizer allows to replace authorizer (e.g. with updated ACLs)
+// without restarting the server.
+type reloadableAuthorizer struct {
+	mut   sync.RWMutex
+	a     authorizer
+	cache *authCache
+}
+
+func (r *reloadableAuthorizer) GetProjectAccessLevel(req *http.Request, group string, project string) (auth.AccessLevel, error) {
+	r.mut.RLock()
+	a := r.a
+	r.mut.RUnlock()
+	return a.GetProjectAccessLevel(req, group, project)
+}
+
+func (r *reloadableAuthorizer) set(a authorizer, cache *authCache) {
+	r.mut.Lock()
+	r.a = a
+	r.cache = cache
+	r.mut.Unlock()
+}
+
+// flushCache drops access levels cached by current authorizer.
+func (r *reloadableAuthorizer) flushCache() {
+	r.mut.RLock()
+	cache := r.cache
+	r.mut.RUnlock()
+	if cache != nil {
+		cache.flush()
+	}
+}
+
+// certificate holds API server certificate which can be replaced
+// (e.g. after renewal) without restarting the server.
+type certificate struct {
+	mut  sync.RWMutex
+	cert *tls.Certificate
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.cert, nil
+}
+
+func (c *certificate) set(cert *tls.Certificate) {
+	c.mut.Lock()
+	c.cert = cert
+	c.mut.Unlock()
+}
+
+func loadCertificate(c *conf.API) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed loading certificate: %s", err)
+	}
+	return &cert, nil
+}
+
+func isTLS(c *conf.API) bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// PrepareReload validates new configuration and builds authorizer and TLS
+// certificate out of it. Returned function swaps them without interrupting
+// the server. Nothing is changed if error is returned. Address and enabling
+// or disabling TLS can't be changed without restart.
+func (s *Server) PrepareReload(c *conf.API) (func(), error) {
+	roles, err := auth.NewRoles(c.Auth.Roles)
+	if err != nil {
+		return nil, err
+	}
+	a, cache, err := newAuthorizer(&c.Auth, s.storage, roles)
+	if err != nil {
+		return nil, err
+	}
+	var cert *tls.Certificate
+	if isTLS(c) {
+		cert, err = loadCertificate(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func() {
+		setLDAPTimeout(&c.Auth)
+		s.auth.set(a, cache)
+		s.tokens.set(&c.Auth.Tokens, roles)
+		if cert != nil {
+			s.cert.set(cert)
+		}
+	}, nil
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var (
+	errTokensDisabled = errors.New("API tokens are disabled")
+	errTokenNotFound  = errors.New("Token not found")
+)
+
+// cacheFlusher is implemented by authorizers caching access levels.
+type cacheFlusher interface {
+	flushCache()
+}
+
+// tokenAdmin groups handlers managing API tokens. Managing tokens requires
+// admin permission to admin project. Options and roles can be changed by
+// configuration reload.
+type tokenAdmin struct {
+	mut   sync.RWMutex
+	conf  conf.APIAuthTokens
+	roles auth.Roles
+}
+
+func (ta *tokenAdmin) get() (conf.APIAuthTokens, auth.Roles) {
+	ta.mut.RLock()
+	defer ta.mut.RUnlock()
+	return ta.conf, ta.roles
+}
+
+func (ta *tokenAdmin) set(c *conf.APIAuthTokens, roles auth.Roles) {
+	ta.mut.Lock()
+	ta.conf = *c
+	ta.roles = roles
+	ta.mut.Unlock()
+}
+
+// authorize checks if request is allowed to manage tokens.
+func (ta *tokenAdmin) authorize(a authorizer, w http.ResponseWriter, r *http.Request) (*conf.APIAuthTokens, auth.Roles, error) {
+	c, roles := ta.get()
+	if !c.Enabled {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, nil, errTokensDisabled
+	}
+	chunks := strings.SplitN(c.AdminProject, "/", 2)
+	lvl, err := a.GetProjectAccessLevel(r, chunks[0], chunks[1])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, nil, err
+	}
+	if !lvl.Has(auth.Admin) {
+		w.WriteHeader(http.StatusForbidden)
+		return nil, nil, errForbidden
+	}
+	return &c, roles, nil
+}
+
+func (ta *tokenAdmin) getTokens(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
+	if _, _, err := ta.authorize(a, w, r); err != nil {
+		return err
+	}
+	tokens, err := s.GetAPITokens()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	if tokens == nil {
+		tokens = make([]*model.APIToken, 0)
+	}
+	for _, token := range tokens {
+		token.Hash = ""
+	}
+	encoder(w).Encode(tokens)
+	return nil
+}
+
+// newTokenResponse holds created token. Value isn't stored so it's returned
+// only once.
+type newTokenResponse struct {
+	model.APIToken
+	Token string
+}
+
+func (ta *tokenAdmin) createToken(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
+	c, roles, err := ta.authorize(a, w, r)
+	if err != nil {
+		return err
+	}
+	var payload newTokenPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return fmt.Errorf("JSON decoding failed: %s", err)
+	}
+	err = validateSchema(gojsonschema.NewGoLoader(payload), gojsonschema.NewGoLoader(newTokenSchema))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+	lvl, ok := roles[payload.Access]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return fmt.Errorf("Unknown role: %s", payload.Access)
+	}
+	projects, err := scopeProjects(s, payload.Scope)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	// Token can't give more than its creator has to any project it covers.
+	for _, p := range projects {
+		creatorLvl, err := a.GetProjectAccessLevel(r, p[0], p[1])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return err
+		}
+		if !creatorLvl.Has(lvl) {
+			w.WriteHeader(http.StatusForbidden)
+			return fmt.Errorf("Role %s exceeds permissions to %s/%s", payload.Access, p[0], p[1])
+		}
+	}
+	ttl := time.Duration(payload.TTL) * time.Second
+	if c.MaxTTL > 0 {
+		if ttl == 0 {
+			ttl = c.MaxTTL
+		}
+		if ttl > c.MaxTTL {
+			w.WriteHeader(http.StatusBadRequest)
+			return fmt.Errorf("TTL exceeds maximum (%d seconds)", int64(c.MaxTTL/time.Second))
+		}
+	}
+	token, value, err := model.NewAPIToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	token.Description = payload.Description
+	token.Scope = payload.Scope
+	token.Access = payload.Access
+	token.Created = time.Now().UTC()
+	if ttl > 0 {
+		token.Expires = token.Created.Add(ttl)
+	}
+	err = s.SaveAPIToken(token)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	log.WithFields(log.Fields{"id": token.ID, "scope": token.Scope, "access": token.Access}).Info("API token created")
+	token.Hash = ""
+	w.WriteHeader(http.StatusCreated)
+	encoder(w).Encode(&newTokenResponse{APIToken: *token, Token: value})
+	return nil
+}
+
+// scopeProjects returns group and project of projects covered by scope. For
+// group scope ("group") and all projects ("*") these are projects having
+// jobs.
+func scopeProjects(s storage, scope string) ([][2]string, error) {
+	chunks := strings.SplitN(scope, "/", 2)
+	if len(chunks) == 2 {
+		return [][2]string{{chunks[0], chunks[1]}}, nil
+	}
+	var jobs []*model.Job
+	var err error
+	if scope == "*" {
+		jobs, err = s.GetJobs()
+	} else {
+		jobs, err = s.GetGroupJobs(scope)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[[2]string]bool)
+	var projects [][2]string
+	for _, job := range jobs {
+		p := [2]string{job.Group, job.Project}
+		if !seen[p] {
+			seen[p] = true
+			projects = append(projects, p)
+		}
+	}
+	return projects, nil
+}
+
+func (ta *tokenAdmin) revokeToken(a authorizer, s storage, w http.ResponseWriter, r *http.Request) error {
+	if _, _, err := ta.authorize(a, w, r); err != nil {
+		return err
+	}
+	id := mux.Vars(r)["id"]
+	if !model.ValidAPITokenID(id) {
+		w.WriteHeader(http.StatusNotFound)
+		return errTokenNotFound
+	}
+	token, err := s.GetAPIToken(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	if token == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return errTokenNotFound
+	}
+	err = s.DeleteAPIToken(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	log.WithField("id", id).Info("API token revoked")
+	// API tokens are checked in front of cache. Cached decisions are
+	// dropped anyway so nothing granted before revocation outlives it.
+	if f, ok := a.(cacheFlusher); ok {
+		f.flushCache()
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mlowicki/rhythm/api/auth"
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/model"
+)
+
+type tokensStorage struct {
+	storage
+	jobs  []*model.Job
+	saved []*model.APIToken
+}
+
+func (s *tokensStorage) GetJobs() ([]*model.Job, error) {
+	return s.jobs, nil
+}
+
+func (s *tokensStorage) GetGroupJobs(group string) ([]*model.Job, error) {
+	var jobs []*model.Job
+	for _, job := range s.jobs {
+		if job.Group == group {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *tokensStorage) SaveAPIToken(token *model.APIToken) error {
+	s.saved = append(s.saved, token)
+	return nil
+}
+
+func (s *tokensStorage) GetAPIToken(id string) (*model.APIToken, error) {
+	for _, token := range s.saved {
+		if token.ID == id {
+			return token, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *tokensStorage) DeleteAPIToken(id string) error {
+	for i, token := range s.saved {
+		if token.ID == id {
+			s.saved = append(s.saved[:i], s.saved[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// projectsAuthorizer grants access levels per "group/project".
+type projectsAuthorizer map[string]auth.AccessLevel
+
+func (a projectsAuthorizer) GetProjectAccessLevel(r *http.Request, group string, project string) (auth.AccessLevel, error) {
+	return a[group+"/"+project], nil
+}
+
+func TestCreateTokenBoundedByCreatorAccess(t *testing.T) {
+	roles, err := auth.NewRoles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ta := &tokenAdmin{
+		conf:  conf.APIAuthTokens{Enabled: true, AdminProject: "admin/tokens"},
+		roles: roles,
+	}
+	a := projectsAuthorizer{
+		"admin/tokens": auth.All,
+		"a/x":          auth.ReadWrite,
+		"a/y":          auth.ReadOnly,
+		"b/z":          auth.ReadWrite,
+	}
+	s := &tokensStorage{jobs: []*model.Job{
+		{JobConf: model.JobConf{JobID: model.JobID{Group: "a", Project: "x", ID: "1"}}},
+		{JobConf: model.JobConf{JobID: model.JobID{Group: "a", Project: "y", ID: "1"}}},
+		{JobConf: model.JobConf{JobID: model.JobID{Group: "b", Project: "z", ID: "1"}}},
+	}}
+	tests := []struct {
+		scope  string
+		access string
+		status int
+	}{
+		{"a/x", auth.ACLReadWrite, http.StatusCreated},
+		{"a/y", auth.ACLReadOnly, http.StatusCreated},
+		{"a/y", auth.ACLReadWrite, http.StatusForbidden},
+		{"a/x", auth.ACLAdmin, http.StatusForbidden},
+		{"c/unknown", auth.ACLReadOnly, http.StatusForbidden},
+		{"a", auth.ACLReadOnly, http.StatusCreated},
+		{"a", auth.ACLReadWrite, http.StatusForbidden},
+		{"b", auth.ACLReadWrite, http.StatusCreated},
+		{"*", auth.ACLReadOnly, http.StatusCreated},
+		{"*", auth.ACLReadWrite, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		s.saved = nil
+		body := `{"Scope": "` + test.scope + `", "Access": "` + test.access + `"}`
+		r := httptest.NewRequest("POST", "/api/v1/tokens", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		err := ta.createToken(a, s, w, r)
+		if w.Code != test.status {
+			t.Errorf("%s %s: got status %d (%v), want %d", test.scope, test.access, w.Code, err, test.status)
+		}
+		if created := len(s.saved) == 1; created != (test.status == http.StatusCreated) {
+			t.Errorf("%s %s: token saved: %v", test.scope, test.access, created)
+		}
+	}
+}
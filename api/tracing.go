@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/tracing"
+)
+
+// tracedStorage records storage calls as children of request's span.
+type tracedStorage struct {
+	ctx context.Context
+	s   storage
+}
+
+func (t *tracedStorage) GetJobs() ([]*model.Job, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetJobs")
+	jobs, err := t.s.GetJobs()
+	tracing.End(span, err)
+	return jobs, err
+}
+
+func (t *tracedStorage) GetGroupJobs(group string) ([]*model.Job, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetGroupJobs")
+	jobs, err := t.s.GetGroupJobs(group)
+	tracing.End(span, err)
+	return jobs, err
+}
+
+func (t *tracedStorage) GetProjectJobs(group, project string) ([]*model.Job, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetProjectJobs")
+	jobs, err := t.s.GetProjectJobs(group, project)
+	tracing.End(span, err)
+	return jobs, err
+}
+
+func (t *tracedStorage) GetJob(group, project, id string) (*model.Job, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetJob", tracing.WithJob(group, project, id))
+	job, err := t.s.GetJob(group, project, id)
+	tracing.End(span, err)
+	return job, err
+}
+
+func (t *tracedStorage) SaveJob(j *model.Job) error {
+	_, span := tracing.Start(t.ctx, "storage.SaveJob", tracing.WithJob(j.Group, j.Project, j.ID))
+	err := t.s.SaveJob(j)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) DeleteJob(group, project, id string) error {
+	_, span := tracing.Start(t.ctx, "storage.DeleteJob", tracing.WithJob(group, project, id))
+	err := t.s.DeleteJob(group, project, id)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) GetTasks(group, project, id string) ([]*model.Task, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetTasks", tracing.WithJob(group, project, id))
+	tasks, err := t.s.GetTasks(group, project, id)
+	tracing.End(span, err)
+	return tasks, err
+}
+
+func (t *tracedStorage) GetJobConf(group, project, id string) (*model.JobConf, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetJobConf", tracing.WithJob(group, project, id))
+	conf, err := t.s.GetJobConf(group, project, id)
+	tracing.End(span, err)
+	return conf, err
+}
+
+func (t *tracedStorage) SaveJobConf(c *model.JobConf) error {
+	_, span := tracing.Start(t.ctx, "storage.SaveJobConf", tracing.WithJob(c.Group, c.Project, c.ID))
+	err := t.s.SaveJobConf(c)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) QueueJob(group, project, id string, traceContext map[string]string) error {
+	_, span := tracing.Start(t.ctx, "storage.QueueJob", tracing.WithJob(group, project, id))
+	err := t.s.QueueJob(group, project, id, traceContext)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) RequestKill(group, project, id string) error {
+	_, span := tracing.Start(t.ctx, "storage.RequestKill", tracing.WithJob(group, project, id))
+	err := t.s.RequestKill(group, project, id)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) GetAPIToken(id string) (*model.APIToken, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetAPIToken")
+	token, err := t.s.GetAPIToken(id)
+	tracing.End(span, err)
+	return token, err
+}
+
+func (t *tracedStorage) GetAPITokens() ([]*model.APIToken, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetAPITokens")
+	tokens, err := t.s.GetAPITokens()
+	tracing.End(span, err)
+	return tokens, err
+}
+
+func (t *tracedStorage) SaveAPIToken(token *model.APIToken) error {
+	_, span := tracing.Start(t.ctx, "storage.SaveAPIToken")
+	err := t.s.SaveAPIToken(token)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) DeleteAPIToken(id string) error {
+	_, span := tracing.Start(t.ctx, "storage.DeleteAPIToken")
+	err := t.s.DeleteAPIToken(id)
+	tracing.End(span, err)
+	return err
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/go-multierror"
+	"github.com/mlowicki/rhythm/health"
 	"github.com/mlowicki/rhythm/model"
 	log "github.com/sirupsen/logrus"
 )
@@ -25,6 +26,15 @@ type HealthInfo struct {
 	ServerTime string
 }
 
+// ReadinessInfo describes state of server's dependencies.
+type ReadinessInfo struct {
+	Ready      bool
+	Leader     bool
+	Version    string
+	ServerTime string
+	Checks     map[string]health.Check
+}
+
 // New creates instance of API client.
 func New(addr string, auth func(*http.Request) error) (*Client, error) {
 	c := Client{
@@ -114,6 +124,35 @@ func (c *Client) Health() (*HealthInfo, error) {
 	return &health, nil
 }
 
+// Readiness returns state of server's dependencies. Unlike other methods it
+// doesn't fail if server isn't ready as response still describes its state.
+func (c *Client) Readiness() (*ReadinessInfo, error) {
+	u, _ := url.Parse(c.addr.String())
+	u.Path = "api/v1/health/ready"
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating request: %s.", err)
+	}
+	resp, err := c.send(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response: %s.", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("Server error: %d.", resp.StatusCode)
+	}
+	var readiness ReadinessInfo
+	err = json.Unmarshal(body, &readiness)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding server status: %s.", err)
+	}
+	return &readiness, nil
+}
+
 // ReadTasks returns list of job's runs.
 func (c *Client) ReadTasks(fqid string) ([]*model.Task, error) {
 	u, _ := url.Parse(c.addr.String())
@@ -145,6 +184,34 @@ func (c *Client) ReadTasks(fqid string) ([]*model.Task, error) {
 	return tasks, nil
 }
 
+// ReadTaskLogs returns tails of task's stdout and stderr.
+func (c *Client) ReadTaskLogs(fqid, taskID string) (*model.TaskLogs, error) {
+	u, _ := url.Parse(c.addr.String())
+	u.Path = fmt.Sprintf("api/v1/jobs/%s/tasks/%s/logs", fqid, taskID)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating request: %s.", err)
+	}
+	resp, err := c.send(req, c.auth)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response: %s.", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.parseErrResp(body)
+	}
+	var logs model.TaskLogs
+	err = json.Unmarshal(body, &logs)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding task logs: %s.", err)
+	}
+	return &logs, nil
+}
+
 // ReadJob returns job's info.
 func (c *Client) ReadJob(fqid string) (*model.Job, error) {
 	if strings.Count(fqid, "/") != 2 {
@@ -225,6 +292,29 @@ func (c *Client) RunJob(fqid string) error {
 	return nil
 }
 
+// KillJob requests kill of job's running task.
+func (c *Client) KillJob(fqid string) error {
+	u, _ := url.Parse(c.addr.String())
+	u.Path = "api/v1/jobs/" + fqid + "/kill"
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("Error creating request: %s.", err)
+	}
+	resp, err := c.send(req, c.auth)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading response: %s.", err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return c.parseErrResp(body)
+	}
+	return nil
+}
+
 // CreateJob adds new job.
 func (c *Client) CreateJob(jobEncoded []byte) error {
 	u, _ := url.Parse(c.addr.String())
@@ -301,3 +391,98 @@ func (c *Client) FindJobs(filter string) ([]*model.Job, error) {
 	}
 	return jobs, nil
 }
+
+// FindTokens returns all API tokens (without their values).
+func (c *Client) FindTokens() ([]*model.APIToken, error) {
+	u, _ := url.Parse(c.addr.String())
+	u.Path = "api/v1/tokens"
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating request: %s.", err)
+	}
+	resp, err := c.send(req, c.auth)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response: %s.", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.parseErrResp(body)
+	}
+	var tokens []*model.APIToken
+	err = json.Unmarshal(body, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding tokens: %s.", err)
+	}
+	return tokens, nil
+}
+
+// NewToken describes API token to create.
+type NewToken struct {
+	Description string
+	Scope       string
+	Access      string
+	// TTL in seconds. Zero means server's maximum (if any).
+	TTL int
+}
+
+// CreateToken adds new API token. Returned is token's info and its value.
+func (c *Client) CreateToken(t *NewToken) (*model.APIToken, string, error) {
+	encoded, err := json.Marshal(t)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error encoding token: %s.", err)
+	}
+	u, _ := url.Parse(c.addr.String())
+	u.Path = "api/v1/tokens"
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(encoded))
+	if err != nil {
+		return nil, "", fmt.Errorf("Error creating request: %s.", err)
+	}
+	resp, err := c.send(req, c.auth)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error reading response: %s.", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, "", c.parseErrResp(body)
+	}
+	var created struct {
+		model.APIToken
+		Token string
+	}
+	err = json.Unmarshal(body, &created)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error decoding token: %s.", err)
+	}
+	return &created.APIToken, created.Token, nil
+}
+
+// RevokeToken removes API token.
+func (c *Client) RevokeToken(id string) error {
+	u, _ := url.Parse(c.addr.String())
+	u.Path = "api/v1/tokens/" + id
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("Error creating request: %s.", err)
+	}
+	resp, err := c.send(req, c.auth)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading response: %s.", err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return c.parseErrResp(body)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/storage"
+	"github.com/mlowicki/rhythm/storage/backup"
+)
+
+// BackupCommand implements command for dumping the whole state from storage.
+type BackupCommand struct {
+	*BaseCommand
+	confPath string
+}
+
+// Run executes a command.
+func (c *BackupCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 1 {
+		c.Errorf("Exactly one argument is required (path to archive or \"-\" for stdout)")
+		return 1
+	}
+	conf, err := conf.New(c.confPath)
+	if err != nil {
+		c.Errorf("Error getting configuration: %s", err)
+		return 1
+	}
+	stor, err := storage.Connect(&conf.Storage)
+	if err != nil {
+		c.Errorf("Error connecting to storage: %s", err)
+		return 1
+	}
+	archive, err := backup.Dump(stor)
+	if err != nil {
+		c.Errorf("Error reading state: %s", err)
+		return 1
+	}
+	var w io.Writer
+	if args[0] == "-" {
+		w = os.Stdout
+	} else {
+		f, err := os.OpenFile(args[0], os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			c.Errorf("%s", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	err = backup.Write(w, archive)
+	if err != nil {
+		c.Errorf("Error writing archive: %s", err)
+		return 1
+	}
+	return 0
+}
+
+// Help returns full manual.
+func (c *BackupCommand) Help() string {
+	help := `
+Usage: rhythm backup [options] PATH
+
+  Save jobs, their runtime state and tasks, queued jobs and framework ID
+  into archive located under PATH ("-" for stdout). Storage is accessed
+  directly using server configuration file.
+
+  Copy state between storages:
+
+      $ rhythm backup -config=old.json - | rhythm restore -config=new.json -
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *BackupCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.confPath, "config", "config.json", "Path to server configuration file")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *BackupCommand) Synopsis() string {
+	return "Save the whole state into archive"
+}
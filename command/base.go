@@ -21,6 +21,7 @@ import (
 const (
 	envRhythmAuth        = "RHYTHM_AUTH"
 	envRhythmTokenHelper = "RHYTHM_TOKEN_HELPER"
+	envRhythmToken       = "RHYTHM_TOKEN"
 )
 
 // BaseCommand implements funcionality shared by all commands.
@@ -63,8 +64,25 @@ func (c *BaseCommand) readGitLabToken() (string, error) {
 	return token, nil
 }
 
+// readAPIToken returns API token issued by Rhythm. It's never asked for
+// interactively so commands can be run by automation.
+func (c *BaseCommand) readAPIToken() (string, error) {
+	if token := os.Getenv(envRhythmToken); token != "" {
+		return token, nil
+	}
+	token, err := c.readGitLabToken()
+	if err != nil {
+		return "", err
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("API token not found (set %s or use update-token)", envRhythmToken)
+	}
+	return token, nil
+}
+
 /**
- * Possible methods are "gitlab", "ldap" or "" (blank),
+ * Possible methods are "gitlab", "ldap", "oidc", "token" or "" (blank),
  *
  * If blank is passed then method is read from env var. If env var is not set
  * or empty then no authentication is assumed.
@@ -101,6 +119,18 @@ func (c *BaseCommand) authReq(method string) func(*http.Request) error {
 				return err
 			}
 			req.SetBasicAuth(username, password)
+		case "oidc":
+			token, err := c.readOIDCToken()
+			if err != nil {
+				return err
+			}
+			req.Header.Add("Authorization", "Bearer "+token)
+		case "token":
+			token, err := c.readAPIToken()
+			if err != nil {
+				return err
+			}
+			req.Header.Add("Authorization", "Bearer "+token)
 		default:
 			return fmt.Errorf("Unknown authentication method: %s", method)
 		}
@@ -114,6 +144,42 @@ func (c *BaseCommand) printHealth(health *apiclient.HealthInfo) {
 	c.Printf("ServerTime: %s", health.ServerTime)
 }
 
+func (c *BaseCommand) printReadiness(readiness *apiclient.ReadinessInfo) {
+	c.Printf("Leader: %t", readiness.Leader)
+	c.Printf("Version: %s", readiness.Version)
+	c.Printf("ServerTime: %s", readiness.ServerTime)
+	if readiness.Ready {
+		c.Printf("Ready: %s", color.GreenString("true"))
+	} else {
+		c.Printf("Ready: %s", color.RedString("false"))
+	}
+	names := make([]string, 0, len(readiness.Checks))
+	for name := range readiness.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		check := readiness.Checks[name]
+		status := color.GreenString("healthy")
+		if !check.Healthy {
+			status = color.RedString("unhealthy")
+		}
+		if check.Message != "" {
+			c.Printf("%s: %s (%s)", strings.Title(name), status, check.Message)
+		} else {
+			c.Printf("%s: %s", strings.Title(name), status)
+		}
+		keys := make([]string, 0, len(check.Details))
+		for k := range check.Details {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			c.Printf("    %s: %s", k, check.Details[k])
+		}
+	}
+}
+
 func (c *BaseCommand) printJob(job *model.Job) {
 	c.Printf("State: %s", coloredState(job.State))
 	if job.State == model.FAILED {
@@ -146,13 +212,32 @@ func (c *BaseCommand) printJob(job *model.Job) {
 		c.Printf("Cmd: %s %s", job.Cmd, strings.Join(job.Arguments, " "))
 	}
 	c.printMap("Environment", job.Env)
-	c.printMap("Secrets", job.Secrets)
+	c.printSecrets(job.Secrets)
+	c.printSecretFiles(job.SecretFiles)
+	if job.RestartOnSecretsRotation {
+		c.Printf("Restart on secrets rotation: true")
+	}
+	if len(job.StaleSecrets) > 0 {
+		c.Printf("Stale secrets: %s", color.YellowString(strings.Join(job.StaleSecrets, ", ")))
+	}
 	c.Printf("User: %s", job.User)
 	c.Printf("Resources:")
 	c.Printf("    Memory: %.1f MB", job.Mem)
 	c.Printf("    Disk: %.1f MB", job.Disk)
 	c.Printf("    CPUs: %.1f", job.CPUs)
 	c.printMap("Labels", job.Labels)
+	if r := job.TaskRetention; r != (model.TaskRetention{}) {
+		c.Printf("Task retention:")
+		if r.MinCount > 0 {
+			c.Printf("    Min count: %d", r.MinCount)
+		}
+		if r.MaxCount > 0 {
+			c.Printf("    Max count: %d", r.MaxCount)
+		}
+		if r.MaxAge > 0 {
+			c.Printf("    Max age: %s", time.Duration(r.MaxAge)*time.Second)
+		}
+	}
 }
 
 func (c *BaseCommand) printTasks(tasks []*model.Task) {
@@ -160,15 +245,13 @@ func (c *BaseCommand) printTasks(tasks []*model.Task) {
 		if i > 0 {
 			c.Printf("")
 		}
-		var status string
-		if task.Source == "" {
-			status = color.GreenString("SUCCESS")
-		} else {
-			status = color.RedString("FAIL")
+		c.Printf("Status: \t%s", coloredTaskStatus(task))
+		if task.ExitCode != nil {
+			c.Printf("Exit code: \t%d", *task.ExitCode)
 		}
-		c.Printf("Status: \t%s", status)
 		c.Printf("Start: \t\t%s", task.Start.Format(time.UnixDate))
-		c.Printf("End: \t\t%s", task.Start.Format(time.UnixDate))
+		c.Printf("End: \t\t%s", task.End.Format(time.UnixDate))
+		c.Printf("Duration: \t%s", task.End.Sub(task.Start))
 		if task.TaskID != "" {
 			c.Printf("Task ID: \t%s", task.TaskID)
 		}
@@ -178,6 +261,12 @@ func (c *BaseCommand) printTasks(tasks []*model.Task) {
 		if task.AgentID != "" {
 			c.Printf("Agent ID: \t%s", task.AgentID)
 		}
+		if len(task.StaleSecrets) > 0 {
+			c.Printf("Stale secrets: \t%s", strings.Join(task.StaleSecrets, ", "))
+		}
+		if task.Hostname != "" {
+			c.Printf("Hostname: \t%s", task.Hostname)
+		}
 		if task.FrameworkID != "" {
 			c.Printf("Framework ID: \t%s", task.FrameworkID)
 		}
@@ -196,6 +285,24 @@ func (c *BaseCommand) printTasks(tasks []*model.Task) {
 	}
 }
 
+func (c *BaseCommand) printAPIToken(token *model.APIToken) {
+	c.Printf("ID: \t\t%s", token.ID)
+	if token.Description != "" {
+		c.Printf("Description: \t%s", token.Description)
+	}
+	c.Printf("Scope: \t\t%s", token.Scope)
+	c.Printf("Access: \t%s", token.Access)
+	c.Printf("Created: \t%s", token.Created.Format(time.UnixDate))
+	switch {
+	case token.Expires.IsZero():
+		c.Printf("Expires: \tnever")
+	case token.Expired(time.Now()):
+		c.Printf("Expires: \t%s", color.RedString("%s (expired)", token.Expires.Format(time.UnixDate)))
+	default:
+		c.Printf("Expires: \t%s", token.Expires.Format(time.UnixDate))
+	}
+}
+
 func (c *BaseCommand) printMap(title string, m map[string]string) {
 	if len(m) == 0 {
 		return
@@ -211,6 +318,28 @@ func (c *BaseCommand) printMap(title string, m map[string]string) {
 	}
 }
 
+func (c *BaseCommand) printSecrets(secrets map[string]model.JobSecret) {
+	m := make(map[string]string, len(secrets))
+	for k, v := range secrets {
+		m[k] = v.String()
+	}
+	c.printMap("Secrets", m)
+}
+
+func (c *BaseCommand) printSecretFiles(files []model.JobSecretFile) {
+	if len(files) == 0 {
+		return
+	}
+	c.Printf("Secret files:")
+	for _, f := range files {
+		if f.Mode != "" {
+			c.Printf("    %s: %s (mode %s)", f.Path, f.Secret, f.Mode)
+		} else {
+			c.Printf("    %s: %s", f.Path, f.Secret)
+		}
+	}
+}
+
 var stateColorFunc = map[model.State]func(format string, a ...interface{}) string{
 	model.IDLE:    color.GreenString,
 	model.RUNNING: color.YellowString,
@@ -225,6 +354,23 @@ func coloredState(state model.State) string {
 	return state.String()
 }
 
+// coloredTaskStatus returns task's status. Status of tasks saved by older
+// versions is inferred from source of failure.
+func coloredTaskStatus(task *model.Task) string {
+	status := task.Status
+	if status == "" {
+		if task.Source == "" {
+			status = model.TaskSucceeded
+		} else {
+			status = model.TaskFailed
+		}
+	}
+	if status == model.TaskSucceeded {
+		return color.GreenString(status.String())
+	}
+	return color.RedString(status.String())
+}
+
 type flagSet struct {
 	*flag.FlagSet
 }
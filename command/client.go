@@ -38,6 +38,7 @@ var topLevelSuggestions = []prompt.Suggest{
 	{"cd", "Go to group, project or back"},
 	{"delete", "Delete job"},
 	{"health", "Show server info"},
+	{"kill", "Kill job's running task"},
 	{"ls", "List jobs"},
 	{"read", "Show job configuration and state"},
 	{"run", "Schedule job for immediate run"},
@@ -129,6 +130,10 @@ func (c *ClientCommand) completeRun(word string, words []string) []prompt.Sugges
 	return c.completeRead(word, words)
 }
 
+func (c *ClientCommand) completeKill(word string, words []string) []prompt.Suggest {
+	return c.completeRead(word, words)
+}
+
 func (c *ClientCommand) completeTasks(word string, words []string) []prompt.Suggest {
 	return c.completeRead(word, words)
 }
@@ -153,6 +158,8 @@ func (c *ClientCommand) completer(in prompt.Document) []prompt.Suggest {
 		return c.completeRead(word, words)
 	case "run":
 		return c.completeRun(word, words)
+	case "kill":
+		return c.completeKill(word, words)
 	case "tasks":
 		return c.completeTasks(word, words)
 	case "delete":
@@ -253,6 +260,15 @@ func (c *ClientCommand) run(id string) {
 	c.Printf("Job scheduled for immedidate run.")
 }
 
+func (c *ClientCommand) kill(id string) {
+	err := c.apiClient.KillJob(id)
+	if err != nil {
+		c.Errorf("%s", err)
+		return
+	}
+	c.Printf("Kill of job's task requested.")
+}
+
 func (c *ClientCommand) readTasks(id string) {
 	tasks, err := c.apiClient.ReadTasks(id)
 	if err != nil {
@@ -298,6 +314,12 @@ func (c *ClientCommand) executor(in string) {
 			return
 		}
 		c.run(c.absoluteJobID(blocks[1]))
+	case "kill":
+		if len(blocks) == 1 {
+			c.Errorf("Argument is missing.")
+			return
+		}
+		c.kill(c.absoluteJobID(blocks[1]))
 	case "tasks":
 		if len(blocks) == 1 {
 			c.Errorf("Argument is missing.")
@@ -335,6 +357,8 @@ func (c *ClientCommand) authReq() func(*http.Request) error {
 			req.Header.Add("X-Token", c.token)
 		case "ldap":
 			req.SetBasicAuth(c.username, c.password)
+		case "oidc", "token":
+			req.Header.Add("Authorization", "Bearer "+c.token)
 		default:
 			return fmt.Errorf("Unknown authentication method: %s", c.auth)
 		}
@@ -374,6 +398,18 @@ func (c *ClientCommand) authInit() error {
 		}
 		c.username = username
 		c.password = password
+	case "oidc":
+		token, err := c.readOIDCToken()
+		if err != nil {
+			return err
+		}
+		c.token = token
+	case "token":
+		token, err := c.readAPIToken()
+		if err != nil {
+			return err
+		}
+		c.token = token
 	default:
 		return fmt.Errorf("Unknown authentication method: %s", c.auth)
 	}
@@ -426,7 +462,7 @@ func (c *ClientCommand) Flags() *flagSet {
 	fs := flag.NewFlagSet("client", flag.ContinueOnError)
 	fs.Usage = func() { c.Printf(c.Help()) }
 	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
-	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\" or \"gitlab\")")
+	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\", \"gitlab\", \"oidc\" or \"token\")")
 	return &flagSet{fs}
 }
 
@@ -0,0 +1,93 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/storage"
+	"github.com/mlowicki/rhythm/storage/backup"
+)
+
+// CopyCommand implements command for copying the whole state between storages.
+type CopyCommand struct {
+	*BaseCommand
+	confPath        string
+	targetConfPath  string
+	skipFrameworkID bool
+	force           bool
+}
+
+// Run executes a command.
+func (c *CopyCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	if c.targetConfPath == "" {
+		c.Errorf("-target-config is required")
+		return 1
+	}
+	srcConf, err := conf.New(c.confPath)
+	if err != nil {
+		c.Errorf("Error getting configuration: %s", err)
+		return 1
+	}
+	targetConf, err := conf.New(c.targetConfPath)
+	if err != nil {
+		c.Errorf("Error getting target configuration: %s", err)
+		return 1
+	}
+	src, err := storage.Connect(&srcConf.Storage)
+	if err != nil {
+		c.Errorf("Error connecting to storage: %s", err)
+		return 1
+	}
+	archive, err := backup.Dump(src)
+	if err != nil {
+		c.Errorf("Error reading state: %s", err)
+		return 1
+	}
+	target, err := storage.Connect(&targetConf.Storage)
+	if err != nil {
+		c.Errorf("Error connecting to target storage: %s", err)
+		return 1
+	}
+	err = backup.Restore(target, archive, !c.skipFrameworkID, c.force)
+	if err != nil {
+		c.Errorf("Error restoring state: %s", err)
+		return 1
+	}
+	c.Printf("Copied jobs: %d", len(archive.Jobs))
+	return 0
+}
+
+// Help returns full manual.
+func (c *CopyCommand) Help() string {
+	help := `
+Usage: rhythm copy [options]
+
+  Copy the whole state from storage set in server configuration file to
+  storage set in target configuration file (e.g. while moving to another
+  ZooKeeper cluster). Target storage must not contain any jobs unless
+  -force is set.
+
+      $ rhythm copy -config=old.json -target-config=new.json
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *CopyCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("copy", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.confPath, "config", "config.json", "Path to server configuration file of source storage")
+	fs.StringVar(&c.targetConfPath, "target-config", "", "Path to server configuration file of target storage")
+	fs.BoolVar(&c.skipFrameworkID, "skip-framework-id", false, "Don't copy Mesos framework ID")
+	fs.BoolVar(&c.force, "force", false, "Copy into storage with jobs (overwriting copied ones)")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *CopyCommand) Synopsis() string {
+	return "Copy state to another storage"
+}
@@ -0,0 +1,81 @@
+package command
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/mlowicki/rhythm/command/apiclient"
+)
+
+// CreateTokenCommand implements command for creating API token.
+type CreateTokenCommand struct {
+	*BaseCommand
+	addr        string
+	auth        string
+	description string
+	access      string
+	ttl         time.Duration
+}
+
+// Run executes a command.
+func (c *CreateTokenCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 1 {
+		c.Errorf("Exactly one argument is required (scope)")
+		return 1
+	}
+	cli, err := apiclient.New(c.addr, c.authReq(c.auth))
+	if err != nil {
+		c.Errorf("Error creating API client: %s", err)
+		return 1
+	}
+	token, value, err := cli.CreateToken(&apiclient.NewToken{
+		Description: c.description,
+		Scope:       args[0],
+		Access:      c.access,
+		TTL:         int(c.ttl / time.Second),
+	})
+	if err != nil {
+		c.Errorf("%s", err)
+		return 1
+	}
+	c.printAPIToken(token)
+	c.Printf("Token: \t\t%s", value)
+	c.Printf("")
+	c.Printf("Token is shown only once. Pass it with -auth=token (e.g. via %s).", envRhythmToken)
+	return 0
+}
+
+// Help returns full manual.
+func (c *CreateTokenCommand) Help() string {
+	help := `
+Usage: rhythm token create [options] SCOPE
+
+  Create API token for automation (e.g. CI pipelines). Scope is either
+  project ("group/project"), the whole group ("group") or all projects ("*").
+
+      $ rhythm token create -access=readwrite -ttl=720h -description="CI" group/project
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *CreateTokenCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("token create", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
+	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\", \"gitlab\", \"oidc\" or \"token\")")
+	fs.StringVar(&c.description, "description", "", "Description of token (e.g. its owner)")
+	fs.StringVar(&c.access, "access", "readonly", "Role granted by token (e.g. \"readonly\" or \"readwrite\")")
+	fs.DurationVar(&c.ttl, "ttl", 0, "Lifetime of token (e.g. \"720h\"). Token doesn't expire if not set unless server enforces maximum lifetime")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *CreateTokenCommand) Synopsis() string {
+	return "Create API token"
+}
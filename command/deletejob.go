@@ -52,7 +52,7 @@ func (c *DeleteJobCommand) Flags() *flagSet {
 	fs := flag.NewFlagSet("delete-job", flag.ContinueOnError)
 	fs.Usage = func() { c.Printf(c.Help()) }
 	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
-	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\" or \"gitlab\")")
+	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\", \"gitlab\", \"oidc\" or \"token\")")
 	return &flagSet{fs}
 }
 
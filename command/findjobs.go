@@ -73,7 +73,7 @@ func (c *FindJobsCommand) Flags() *flagSet {
 	fs := flag.NewFlagSet("find-jobs", flag.ContinueOnError)
 	fs.Usage = func() { c.Printf(c.Help()) }
 	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
-	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\" or \"gitlab\")")
+	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\", \"gitlab\", \"oidc\" or \"token\")")
 	fs.BoolVar(&c.showState, "state", true, "Show job state")
 	return &flagSet{fs}
 }
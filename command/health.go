@@ -10,7 +10,8 @@ import (
 // HealthCommand implements command for returning server's info.
 type HealthCommand struct {
 	*BaseCommand
-	addr string
+	addr    string
+	verbose bool
 }
 
 // Run executes a command.
@@ -22,6 +23,18 @@ func (c *HealthCommand) Run(args []string) int {
 		c.Errorf("Error creating API client: %s", err)
 		return 1
 	}
+	if c.verbose {
+		readiness, err := cli.Readiness()
+		if err != nil {
+			c.Errorf("%s", err)
+			return 1
+		}
+		c.printReadiness(readiness)
+		if !readiness.Ready {
+			return 1
+		}
+		return 0
+	}
 	health, err := cli.Health()
 	if err != nil {
 		c.Errorf("%s", err)
@@ -38,6 +51,10 @@ Usage: rhythm health [options]
 
   Show status of Rhythm server.
 
+  Show state of server's dependencies (exits with 1 if any of them is unhealthy):
+
+      $ rhythm health -addr https://example.com -verbose
+
 ` + c.Flags().help()
 	return strings.TrimSpace(help)
 }
@@ -47,6 +64,7 @@ func (c *HealthCommand) Flags() *flagSet {
 	fs := flag.NewFlagSet("health", flag.ExitOnError)
 	fs.Usage = func() { c.Printf(c.Help()) }
 	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
+	fs.BoolVar(&c.verbose, "verbose", false, "Show state of storage, coordinator, secrets backend and Mesos")
 	return &flagSet{fs}
 }
 
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/mlowicki/rhythm/command/apiclient"
+)
+
+// KillJobCommand implements command for killing job's running task.
+type KillJobCommand struct {
+	*BaseCommand
+	addr string
+	auth string
+}
+
+// Run executes a command.
+func (c *KillJobCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 1 {
+		c.Errorf("Exactly one argument is required (fully-qualified job ID)")
+		return 1
+	}
+	cli, err := apiclient.New(c.addr, c.authReq(c.auth))
+	if err != nil {
+		c.Errorf("Error creating API client: %s", err)
+		return 1
+	}
+	err = cli.KillJob(args[0])
+	if err != nil {
+		c.Errorf("%s", err)
+		return 1
+	}
+	return 0
+}
+
+// Help returns full manual.
+func (c *KillJobCommand) Help() string {
+	help := `
+Usage: rhythm kill-job [options] FQID
+
+  Kill running task of job with the given fully-qualified ID (e.g. "group/project/id").
+  Task is killed by scheduler asynchronously. Command fails if job is not running.
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *KillJobCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("kill-job", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
+	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\", \"gitlab\", \"oidc\" or \"token\")")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *KillJobCommand) Synopsis() string {
+	return "Kill job's running task"
+}
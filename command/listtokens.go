@@ -0,0 +1,63 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/mlowicki/rhythm/command/apiclient"
+)
+
+// ListTokensCommand implements command for listing API tokens.
+type ListTokensCommand struct {
+	*BaseCommand
+	addr string
+	auth string
+}
+
+// Run executes a command.
+func (c *ListTokensCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	cli, err := apiclient.New(c.addr, c.authReq(c.auth))
+	if err != nil {
+		c.Errorf("Error creating API client: %s", err)
+		return 1
+	}
+	tokens, err := cli.FindTokens()
+	if err != nil {
+		c.Errorf("%s", err)
+		return 1
+	}
+	for i, token := range tokens {
+		if i > 0 {
+			c.Printf("")
+		}
+		c.printAPIToken(token)
+	}
+	return 0
+}
+
+// Help returns full manual.
+func (c *ListTokensCommand) Help() string {
+	help := `
+Usage: rhythm token list [options]
+
+  Show all API tokens. Values of tokens aren't available.
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *ListTokensCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("token list", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
+	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\", \"gitlab\", \"oidc\" or \"token\")")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *ListTokensCommand) Synopsis() string {
+	return "List API tokens"
+}
@@ -0,0 +1,78 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/storage"
+)
+
+// MigrateCommand implements command for migrating storage schema.
+type MigrateCommand struct {
+	*BaseCommand
+	confPath string
+	dryRun   bool
+}
+
+// Run executes a command.
+func (c *MigrateCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	conf, err := conf.New(c.confPath)
+	if err != nil {
+		c.Errorf("Error getting configuration: %s", err)
+		return 1
+	}
+	from, results, err := storage.Migrate(&conf.Storage, c.dryRun)
+	if err != nil && len(results) == 0 {
+		c.Errorf("%s", err)
+		return 1
+	}
+	c.Printf("Schema version: %d", from)
+	for _, res := range results {
+		c.Printf("Migration to version %d: %s", res.Version, res.Description)
+		for _, change := range res.Changes {
+			c.Printf("    %s", change)
+		}
+	}
+	if err != nil {
+		c.Errorf("%s", err)
+		return 1
+	}
+	if len(results) == 0 {
+		c.Printf("Nothing to migrate")
+	} else if c.dryRun {
+		c.Printf("Dry run. No changes made")
+	}
+	return 0
+}
+
+// Help returns full manual.
+func (c *MigrateCommand) Help() string {
+	help := `
+Usage: rhythm migrate [options]
+
+  Migrate storage schema to the version used by this release.
+
+  Show changes without applying them:
+
+      $ rhythm migrate -config=/etc/rhythm/config.json -dry-run
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *MigrateCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.confPath, "config", "config.json", "Path to server configuration file")
+	fs.BoolVar(&c.dryRun, "dry-run", false, "Show changes without applying them")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *MigrateCommand) Synopsis() string {
+	return "Migrate storage schema"
+}
@@ -0,0 +1,190 @@
+package command
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	envRhythmOIDCIssuer   = "RHYTHM_OIDC_ISSUER"
+	envRhythmOIDCClientID = "RHYTHM_OIDC_CLIENT_ID"
+	envRhythmOIDCScope    = "RHYTHM_OIDC_SCOPE"
+	defaultOIDCScope      = "openid email profile"
+	// Token is renewed if it expires sooner than that so it doesn't expire
+	// while request is sent.
+	oidcExpiryMargin = 30 * time.Second
+)
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// readOIDCToken returns token saved by token helper. If there is no token or
+// it has expired then device authorization flow (RFC 8628) is started to get
+// a new one which is then saved.
+func (c *BaseCommand) readOIDCToken() (string, error) {
+	helper, err := c.getTokenHelper()
+	if err != nil {
+		return "", err
+	}
+	token, err := helper.Read()
+	if err != nil {
+		return "", fmt.Errorf("Error getting token from token helper: %s", err)
+	}
+	token = strings.TrimSpace(token)
+	if token != "" && !tokenExpired(token) {
+		return token, nil
+	}
+	token, err = c.oidcLogin()
+	if err != nil {
+		return "", fmt.Errorf("OIDC login failed: %s", err)
+	}
+	if err := helper.Update(token); err != nil {
+		return "", fmt.Errorf("Error updating token: %s", err)
+	}
+	return token, nil
+}
+
+// tokenExpired tells if JWT has expired. Signature isn't verified as it's
+// server's job. Tokens which cannot be parsed are treated as not expired so
+// server decides about them.
+func tokenExpired(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Exp == 0 {
+		return false
+	}
+	return time.Now().Add(oidcExpiryMargin).After(time.Unix(claims.Exp, 0))
+}
+
+type oidcProvider struct {
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+}
+
+type oidcDeviceAuth struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (c *BaseCommand) oidcLogin() (string, error) {
+	issuer := os.Getenv(envRhythmOIDCIssuer)
+	if issuer == "" {
+		return "", fmt.Errorf("%s is not set", envRhythmOIDCIssuer)
+	}
+	clientID := os.Getenv(envRhythmOIDCClientID)
+	if clientID == "" {
+		return "", fmt.Errorf("%s is not set", envRhythmOIDCClientID)
+	}
+	scope := os.Getenv(envRhythmOIDCScope)
+	if scope == "" {
+		scope = defaultOIDCScope
+	}
+	var provider oidcProvider
+	u := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	res, err := oidcHTTPClient.Get(u)
+	if err != nil {
+		return "", fmt.Errorf("Discovery failed: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Discovery failed: %s", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&provider); err != nil {
+		return "", fmt.Errorf("Error decoding discovery document: %s", err)
+	}
+	if provider.DeviceAuthorizationEndpoint == "" {
+		return "", errors.New("Provider doesn't support device authorization flow")
+	}
+	var auth oidcDeviceAuth
+	err = oidcPost(provider.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {clientID},
+		"scope":     {scope},
+	}, &auth)
+	if err != nil {
+		return "", fmt.Errorf("Device authorization request failed: %s", err)
+	}
+	if auth.VerificationURIComplete != "" {
+		c.Printf("Open %s to log in (code: %s)", auth.VerificationURIComplete, auth.UserCode)
+	} else {
+		c.Printf("Open %s and enter code: %s", auth.VerificationURI, auth.UserCode)
+	}
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	for auth.ExpiresIn == 0 || time.Now().Before(deadline) {
+		time.Sleep(interval)
+		var token oidcTokenResponse
+		err := oidcPost(provider.TokenEndpoint, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {clientID},
+		}, &token)
+		if err != nil && token.Error == "" {
+			return "", fmt.Errorf("Token request failed: %s", err)
+		}
+		switch token.Error {
+		case "":
+			// ID token is preferred as its audience is client ID which
+			// Rhythm server can verify.
+			if token.IDToken != "" {
+				return token.IDToken, nil
+			}
+			if token.AccessToken != "" {
+				return token.AccessToken, nil
+			}
+			return "", errors.New("Token response without token")
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			if token.ErrorDescription != "" {
+				return "", fmt.Errorf("%s: %s", token.Error, token.ErrorDescription)
+			}
+			return "", errors.New(token.Error)
+		}
+	}
+	return "", errors.New("Device code expired")
+}
+
+// oidcPost sends form and decodes JSON response into v. Response is decoded
+// also if status isn't 200 since OAuth 2.0 errors are returned with 400.
+func oidcPost(u string, form url.Values, v interface{}) error {
+	res, err := oidcHTTPClient.PostForm(u, form)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	decodeErr := json.NewDecoder(res.Body).Decode(v)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response: %s", res.Status)
+	}
+	return decodeErr
+}
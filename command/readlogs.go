@@ -0,0 +1,81 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/mlowicki/rhythm/command/apiclient"
+)
+
+// ReadLogsCommand implements command for returning tails of task's output.
+type ReadLogsCommand struct {
+	*BaseCommand
+	addr   string
+	auth   string
+	stream string
+}
+
+// Run executes a command.
+func (c *ReadLogsCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 2 {
+		c.Errorf("Exactly two arguments are required (fully-qualified job ID and task ID)")
+		return 1
+	}
+	if c.stream != "" && c.stream != "stdout" && c.stream != "stderr" {
+		c.Errorf("Invalid stream: %s", c.stream)
+		return 1
+	}
+	cli, err := apiclient.New(c.addr, c.authReq(c.auth))
+	if err != nil {
+		c.Errorf("Error creating API client: %s", err)
+		return 1
+	}
+	logs, err := cli.ReadTaskLogs(args[0], args[1])
+	if err != nil {
+		c.Errorf("%s", err)
+		return 1
+	}
+	switch c.stream {
+	case "stdout":
+		c.Printf("%s", logs.Stdout)
+	case "stderr":
+		c.Printf("%s", logs.Stderr)
+	default:
+		c.Printf("Stdout:")
+		c.Printf("%s", logs.Stdout)
+		c.Printf("Stderr:")
+		c.Printf("%s", logs.Stderr)
+	}
+	return 0
+}
+
+// Help returns full manual.
+func (c *ReadLogsCommand) Help() string {
+	help := `
+Usage: rhythm read-logs [options] FQID TASKID
+
+  Show tails of stdout and stderr captured while task (run) of job with given
+  fully-qualified ID (e.g. "group/project/id") has finished. Task IDs are
+  listed by read-tasks command.
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *ReadLogsCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("read-logs", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
+	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\", \"gitlab\", \"oidc\" or \"token\")")
+	fs.StringVar(&c.stream, "stream", "", "Show only one stream (\"stdout\" or \"stderr\")")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *ReadLogsCommand) Synopsis() string {
+	return "Show tails of task's stdout and stderr"
+}
@@ -0,0 +1,98 @@
+package command
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/mlowicki/rhythm/api"
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/secrets"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	configReloadsCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "config_reloads",
+		Help: "Number of configuration reloads.",
+	}, []string{"result"})
+	configLastReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "config_last_reload_success_timestamp_seconds",
+		Help: "Time of the last successful configuration reload.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(configReloadsCount)
+	prometheus.MustRegister(configLastReloadSuccess)
+}
+
+// reloader applies configuration changes to running server. Only logging,
+// API authorization and TLS certificate and secrets backend are reloaded.
+type reloader struct {
+	path    string
+	current *conf.Conf
+	api     *api.Server
+	secrets *secrets.Reloadable
+}
+
+func (r *reloader) reload() {
+	err := r.apply()
+	if err != nil {
+		configReloadsCount.WithLabelValues("failure").Inc()
+		log.Errorf("Configuration reload failed. Keeping old configuration: %s", err)
+		return
+	}
+	configReloadsCount.WithLabelValues("success").Inc()
+	configLastReloadSuccess.Set(float64(time.Now().Unix()))
+	log.Info("Configuration reloaded")
+}
+
+// apply validates and builds everything first so either all sections
+// are updated or none.
+func (r *reloader) apply() error {
+	c, err := conf.New(r.path)
+	if err != nil {
+		return fmt.Errorf("Error getting configuration: %s", err)
+	}
+	loggingSetup, err := newLoggingSetup(&c.Logging)
+	if err != nil {
+		return err
+	}
+	applyAPI, err := r.api.PrepareReload(&c.API)
+	if err != nil {
+		return fmt.Errorf("Error reloading API: %s", err)
+	}
+	applySecrets, err := r.secrets.PrepareReload(&c.Secrets)
+	if err != nil {
+		return fmt.Errorf("Error reloading secrets: %s", err)
+	}
+	loggingSetup.apply()
+	applyAPI()
+	applySecrets()
+	r.warnAboutRestart(c)
+	r.current = c
+	return nil
+}
+
+// warnAboutRestart logs changes which are ignored until restart.
+func (r *reloader) warnAboutRestart(c *conf.Conf) {
+	changed := func(name string, old, new interface{}) {
+		if !reflect.DeepEqual(old, new) {
+			log.Warnf("Changes in %s require restart", name)
+		}
+	}
+	changed("api.addr", r.current.API.Addr, c.API.Addr)
+	changed("api.shutdowntimeout", r.current.API.ShutdownTimeout, c.API.ShutdownTimeout)
+	oldTLS := r.current.API.CertFile != "" || r.current.API.KeyFile != ""
+	newTLS := c.API.CertFile != "" || c.API.KeyFile != ""
+	if oldTLS != newTLS {
+		log.Warn("Enabling or disabling TLS requires restart")
+	}
+	changed("storage", r.current.Storage, c.Storage)
+	changed("coordinator", r.current.Coordinator, c.Coordinator)
+	changed("mesos", r.current.Mesos, c.Mesos)
+	changed("metrics", r.current.Metrics, c.Metrics)
+	changed("tracing", r.current.Tracing, c.Tracing)
+}
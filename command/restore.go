@@ -0,0 +1,97 @@
+package command
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/storage"
+	"github.com/mlowicki/rhythm/storage/backup"
+)
+
+// RestoreCommand implements command for loading state saved by backup command.
+type RestoreCommand struct {
+	*BaseCommand
+	confPath        string
+	skipFrameworkID bool
+	force           bool
+}
+
+// Run executes a command.
+func (c *RestoreCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 1 {
+		c.Errorf("Exactly one argument is required (path to archive or \"-\" for stdin)")
+		return 1
+	}
+	conf, err := conf.New(c.confPath)
+	if err != nil {
+		c.Errorf("Error getting configuration: %s", err)
+		return 1
+	}
+	var r io.Reader
+	if args[0] == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(args[0])
+		if err != nil {
+			c.Errorf("%s", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+	archive, err := backup.Read(r)
+	if err != nil {
+		c.Errorf("Error reading archive: %s", err)
+		return 1
+	}
+	stor, err := storage.Connect(&conf.Storage)
+	if err != nil {
+		c.Errorf("Error connecting to storage: %s", err)
+		return 1
+	}
+	err = backup.Restore(stor, archive, !c.skipFrameworkID, c.force)
+	if err != nil {
+		c.Errorf("Error restoring state: %s", err)
+		return 1
+	}
+	c.Printf("Restored jobs: %d", len(archive.Jobs))
+	return 0
+}
+
+// Help returns full manual.
+func (c *RestoreCommand) Help() string {
+	help := `
+Usage: rhythm restore [options] PATH
+
+  Load state from archive located under PATH ("-" for stdin) created by
+  backup command. Storage is accessed directly using server configuration
+  file and must not contain any jobs unless -force is set.
+
+  Restore isn't atomic. If it fails halfway then run it again with -force
+  to finish it (stored jobs are overwritten and tasks already restored are
+  skipped).
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *RestoreCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.confPath, "config", "config.json", "Path to server configuration file")
+	fs.BoolVar(&c.skipFrameworkID, "skip-framework-id", false, "Don't restore Mesos framework ID")
+	fs.BoolVar(&c.force, "force", false, "Restore into storage with jobs (overwriting ones from archive)")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *RestoreCommand) Synopsis() string {
+	return "Load state saved by backup command"
+}
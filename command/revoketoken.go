@@ -0,0 +1,62 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/mlowicki/rhythm/command/apiclient"
+)
+
+// RevokeTokenCommand implements command for revoking API token.
+type RevokeTokenCommand struct {
+	*BaseCommand
+	addr string
+	auth string
+}
+
+// Run executes a command.
+func (c *RevokeTokenCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 1 {
+		c.Errorf("Exactly one argument is required (token ID)")
+		return 1
+	}
+	cli, err := apiclient.New(c.addr, c.authReq(c.auth))
+	if err != nil {
+		c.Errorf("Error creating API client: %s", err)
+		return 1
+	}
+	err = cli.RevokeToken(args[0])
+	if err != nil {
+		c.Errorf("%s", err)
+		return 1
+	}
+	return 0
+}
+
+// Help returns full manual.
+func (c *RevokeTokenCommand) Help() string {
+	help := `
+Usage: rhythm token revoke [options] ID
+
+  Revoke API token with given ID.
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *RevokeTokenCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("token revoke", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.addr, "addr", "", "Address of Rhythm server (with protocol e.g. \"https://example.com\")")
+	fs.StringVar(&c.auth, "auth", "", "Authentication method (\"ldap\", \"gitlab\", \"oidc\" or \"token\")")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *RevokeTokenCommand) Synopsis() string {
+	return "Revoke API token"
+}
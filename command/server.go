@@ -1,10 +1,16 @@
 package command
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/evalphobia/logrus_sentry"
@@ -12,10 +18,13 @@ import (
 	"github.com/mlowicki/rhythm/api"
 	"github.com/mlowicki/rhythm/conf"
 	"github.com/mlowicki/rhythm/coordinator"
+	"github.com/mlowicki/rhythm/health"
+	"github.com/mlowicki/rhythm/logging"
 	"github.com/mlowicki/rhythm/mesos"
 	"github.com/mlowicki/rhythm/secrets"
 	"github.com/mlowicki/rhythm/storage"
 	tlsutils "github.com/mlowicki/rhythm/tls"
+	"github.com/mlowicki/rhythm/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"github.com/tevino/abool"
@@ -45,6 +54,7 @@ func (c *ServerCommand) Run(args []string) int {
 		log.Fatalf("Error getting configuration: %s", err)
 	}
 	initLogging(&conf.Logging)
+	tracing.New(&conf.Tracing, c.Version)
 	if c.testLogging {
 		log.Error("test")
 		log.Info("Sending test event. Wait 10s...")
@@ -62,21 +72,118 @@ func (c *ServerCommand) Run(args []string) int {
 		return 0
 	})
 	prometheus.MustRegister(leaderGauge)
+	isLeader := func() bool { return leader.IsSet() }
 	stor := storage.New(&conf.Storage)
 	coord := coordinator.New(&conf.Coordinator)
-	api.New(&conf.API, stor, api.State{func() bool { return leader.IsSet() }, c.Version})
 	secr := secrets.New(&conf.Secrets)
-	for {
-		log.Info("Waiting until Mesos scheduler leader")
-		ctx := coord.WaitUntilLeader()
-		leader.Set()
-		err = mesos.Run(ctx, conf, stor, secr)
-		leader.UnSet()
-		if err != nil {
-			log.Errorf("Controller error: %s", err)
-			<-time.After(time.Second)
+	mesosStatus := health.NewMesos(isLeader)
+	apiSrv := api.New(&conf.API, stor, secr, api.State{
+		IsLeader: isLeader,
+		Version:  c.Version,
+		Checks: map[string]health.Checker{
+			"storage":     stor,
+			"coordinator": coord,
+			"secrets":     secr,
+			"mesos":       mesosStatus,
+		},
+	})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	ctx, cancel := context.WithCancel(context.Background())
+	// Guards starting scheduler so shutdown can't miss leadership won
+	// while it's cancelling ctx.
+	var runMut sync.Mutex
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		for {
+			log.Info("Waiting until Mesos scheduler leader")
+			leaderCtx := coord.WaitUntilLeader()
+			runMut.Lock()
+			if ctx.Err() != nil {
+				runMut.Unlock()
+				return
+			}
+			runCtx, cancelRun := context.WithCancel(leaderCtx)
+			go func() {
+				select {
+				case <-ctx.Done():
+					cancelRun()
+				case <-runCtx.Done():
+				}
+			}()
+			leader.Set()
+			runMut.Unlock()
+			err := mesos.Run(runCtx, conf, stor, secr, mesosStatus)
+			leader.UnSet()
+			cancelRun()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Errorf("Controller error: %s", err)
+				<-time.After(time.Second)
+			}
+		}
+	}()
+	rel := reloader{path: c.confPath, current: conf, api: apiSrv, secrets: secr}
+	var sig os.Signal
+	for sig = range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		log.Info("Received SIGHUP. Reloading configuration...")
+		rel.reload()
+	}
+	log.Infof("Received %s. Shutting down...", sig)
+	go func() {
+		for sig := range signals {
+			if sig != syscall.SIGHUP {
+				log.Fatalf("Received %s while shutting down. Exiting immediately", sig)
+			}
 		}
+	}()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), conf.API.ShutdownTimeout)
+	defer cancelShutdown()
+	apiSrv.StopWrites()
+	runMut.Lock()
+	cancel()
+	wasLeader := leader.IsSet()
+	runMut.Unlock()
+	waitRun := func() {
+		select {
+		case <-runDone:
+		case <-shutdownCtx.Done():
+			log.Error("Timeout waiting for Mesos scheduler to stop")
+		}
+	}
+	// Scheduler must be stopped before dropping election ticket so two
+	// instances never run it at once.
+	if wasLeader {
+		waitRun()
+	}
+	// In-flight API requests need storage so server is shut down first.
+	err = apiSrv.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Errorf("Error shutting down API server: %s", err)
 	}
+	// Dropping election ticket lets other instance take over immediately.
+	// It also stops waiting for leadership if instance hasn't been leader.
+	err = coord.Close()
+	if err != nil {
+		log.Errorf("Error closing coordinator: %s", err)
+	}
+	waitRun()
+	err = stor.Close(shutdownCtx)
+	if err != nil {
+		log.Errorf("Error closing storage: %s", err)
+	}
+	err = tracing.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Errorf("Error shutting down tracing: %s", err)
+	}
+	log.Info("Shutdown finished")
+	return 0
 }
 
 // Help returns full manual.
@@ -108,41 +215,99 @@ func (c *ServerCommand) Synopsis() string {
 	return "Start a Rhythm server"
 }
 
-func initLogging(c *conf.Logging) {
+// loggingSetup holds validated logging options which can be applied at once.
+type loggingSetup struct {
+	level     log.Level
+	formatter log.Formatter
+	hooks     log.LevelHooks
+	sampling  conf.LoggingSampling
+}
+
+var (
+	baseHooks     log.LevelHooks
+	baseHooksOnce sync.Once
+)
+
+// loggingBaseHooks returns hooks installed before logging configuration has
+// been applied for the first time (e.g. adding file name to entries). They
+// are kept while applying configuration (also on reload).
+func loggingBaseHooks() log.LevelHooks {
+	baseHooksOnce.Do(func() {
+		baseHooks = make(log.LevelHooks)
+		for level, hooks := range log.StandardLogger().Hooks {
+			baseHooks[level] = append([]log.Hook{}, hooks...)
+		}
+	})
+	return baseHooks
+}
+
+func newLoggingSetup(c *conf.Logging) (*loggingSetup, error) {
+	setup := loggingSetup{
+		hooks:    make(log.LevelHooks),
+		sampling: c.Sampling,
+	}
+	for level, hooks := range loggingBaseHooks() {
+		setup.hooks[level] = append([]log.Hook{}, hooks...)
+	}
 	switch c.Level {
 	case conf.LoggingLevelDebug:
-		log.SetLevel(log.DebugLevel)
+		setup.level = log.DebugLevel
 	case conf.LoggingLevelInfo:
-		log.SetLevel(log.InfoLevel)
+		setup.level = log.InfoLevel
 	case conf.LoggingLevelWarn:
-		log.SetLevel(log.WarnLevel)
+		setup.level = log.WarnLevel
 	case conf.LoggingLevelError:
-		log.SetLevel(log.ErrorLevel)
+		setup.level = log.ErrorLevel
 	default:
-		log.Fatalf("Unknown logging level: %s", c.Level)
+		return nil, fmt.Errorf("Unknown logging level: %s", c.Level)
+	}
+	switch c.Format {
+	case conf.LoggingFormatJSON:
+		setup.formatter = &log.JSONFormatter{}
+	case conf.LoggingFormatText:
+		setup.formatter = &log.TextFormatter{}
+	default:
+		return nil, fmt.Errorf("Unknown logging format: %s", c.Format)
 	}
 	switch c.Backend {
 	case conf.LoggingBackendSentry:
-		err := initSentryLogging(&c.Sentry)
+		hook, err := newSentryHook(&c.Sentry)
 		if err != nil {
-			log.Fatalf("Error initializing Sentry logging: %s", err)
+			return nil, fmt.Errorf("Error initializing Sentry logging: %s", err)
 		}
+		setup.hooks.Add(hook)
 	case conf.LoggingBackendNone:
 	default:
-		log.Fatalf("Unknown logging backend: %s", c.Backend)
+		return nil, fmt.Errorf("Unknown logging backend: %s", c.Backend)
+	}
+	return &setup, nil
+}
+
+func (setup *loggingSetup) apply() {
+	log.SetLevel(setup.level)
+	log.SetFormatter(setup.formatter)
+	log.StandardLogger().ReplaceHooks(setup.hooks)
+	logging.SetSampling(setup.sampling.Burst, setup.sampling.Interval)
+}
+
+func initLogging(c *conf.Logging) {
+	setup, err := newLoggingSetup(c)
+	if err != nil {
+		log.Fatal(err)
 	}
+	setup.apply()
 	log.Infof("Logging backend: %s", c.Backend)
 }
 
-func initSentryLogging(c *conf.LoggingSentry) error {
+func newSentryHook(c *conf.LoggingSentry) (log.Hook, error) {
 	cli, err := raven.NewWithTags(c.DSN, c.Tags)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if c.CACert != "" {
 		pool, err := tlsutils.BuildCertPool(c.CACert)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		cli.Transport = &raven.HTTPTransport{
 			Client: &http.Client{
@@ -159,9 +324,8 @@ func initSentryLogging(c *conf.LoggingSentry) error {
 		log.WarnLevel,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	hook.Timeout = 0 // Do not wait for a reply.
-	log.AddHook(hook)
-	return nil
+	return hook, nil
 }
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mlowicki/rhythm/conf"
+)
+
+// ValidateConfigCommand implements command for validating server configuration.
+type ValidateConfigCommand struct {
+	*BaseCommand
+	confPath string
+}
+
+// Run executes a command.
+func (c *ValidateConfigCommand) Run(args []string) int {
+	fs := c.Flags()
+	fs.Parse(args)
+	_, err := conf.New(c.confPath)
+	if err != nil {
+		if merr, ok := err.(*multierror.Error); ok {
+			c.Errorf("Found %d errors:", len(merr.Errors))
+			for _, err := range merr.Errors {
+				c.Errorf("    %s", err)
+			}
+		} else {
+			c.Errorf("%s", err)
+		}
+		return 1
+	}
+	c.Printf("Configuration is valid")
+	return 0
+}
+
+// Help returns full manual.
+func (c *ValidateConfigCommand) Help() string {
+	help := `
+Usage: rhythm validate-config [options]
+
+  Check server configuration file. Unknown fields, invalid values and missing
+  files (e.g. certificates) are reported. Server runs the same validation
+  while starting.
+
+      $ rhythm validate-config -config=/etc/rhythm/config.json
+
+` + c.Flags().help()
+	return strings.TrimSpace(help)
+}
+
+// Flags returns parameters associated with command.
+func (c *ValidateConfigCommand) Flags() *flagSet {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	fs.Usage = func() { c.Printf(c.Help()) }
+	fs.StringVar(&c.confPath, "config", "config.json", "Path to server configuration file")
+	return &flagSet{fs}
+}
+
+// Synopsis returns short, one-line help.
+func (c *ValidateConfigCommand) Synopsis() string {
+	return "Validate server configuration"
+}
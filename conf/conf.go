@@ -2,9 +2,12 @@ package conf
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"reflect"
 	"time"
+
+	"github.com/hashicorp/go-multierror"
 )
 
 // Conf defines server options.
@@ -15,14 +18,17 @@ type Conf struct {
 	Secrets     Secrets
 	Mesos       Mesos
 	Logging     Logging
+	Metrics     Metrics
+	Tracing     Tracing
 }
 
 // API defines API server options.
 type API struct {
-	Addr     string
-	CertFile string
-	KeyFile  string
-	Auth     APIAuth
+	Addr            string
+	CertFile        string
+	KeyFile         string
+	Auth            APIAuth
+	ShutdownTimeout time.Duration
 }
 
 // API server authz backends.
@@ -30,19 +36,64 @@ const (
 	APIAuthBackendGitLab = "gitlab"
 	APIAuthBackendNone   = "none"
 	APIAuthBackendLDAP   = "ldap"
+	APIAuthBackendJWT    = "jwt"
+	APIAuthBackendStatic = "static"
+	APIAuthBackendChain  = "chain"
+)
+
+// GitLab access levels which can be mapped to roles.
+const (
+	APIAuthGitLabGuest      = "guest"
+	APIAuthGitLabReporter   = "reporter"
+	APIAuthGitLabDeveloper  = "developer"
+	APIAuthGitLabMaintainer = "maintainer"
+	APIAuthGitLabOwner      = "owner"
+)
+
+// Policies combining access levels returned by chained authz backends.
+const (
+	APIAuthChainPolicyFirst = "first"
+	APIAuthChainPolicyMax   = "max"
 )
 
 // APIAuth defines API server authz options.
 type APIAuth struct {
-	Backend string
-	GitLab  APIAuthGitLab
-	LDAP    APIAuthLDAP
+	Backend          string
+	GitLab           APIAuthGitLab
+	LDAP             APIAuthLDAP
+	JWT              APIAuthJWT
+	Static           APIAuthStatic
+	Chain            APIAuthChain
+	Tokens           APIAuthTokens
+	CacheTTL         time.Duration
+	NegativeCacheTTL time.Duration
+	// Roles defines custom roles (usable in ACLs besides built-in "readonly"
+	// and "readwrite") as lists of permissions.
+	Roles map[string][]string
+}
+
+// Uses returns true if backend is either selected one or is in chain.
+func (a *APIAuth) Uses(backend string) bool {
+	if a.Backend == backend {
+		return true
+	}
+	if a.Backend != APIAuthBackendChain {
+		return false
+	}
+	for _, b := range a.Chain.Backends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
 }
 
 // APIAuthGitLab defines options of GitLab authz backend.
 type APIAuthGitLab struct {
 	Addr   string
 	CACert string
+	// Roles maps GitLab access level (e.g. "developer") to role.
+	Roles map[string]string
 }
 
 // APIAuthLDAP defines options of LDAP authz backend.
@@ -62,6 +113,43 @@ type APIAuthLDAP struct {
 	CaseSensitiveNames bool
 }
 
+// APIAuthJWT defines options of JWT (e.g. issued by OIDC provider) authz
+// backend.
+type APIAuthJWT struct {
+	Issuer             string
+	Audience           string
+	JWKSURL            string
+	Keys               []string
+	CACert             string
+	Timeout            time.Duration
+	Algorithms         []string
+	Leeway             time.Duration
+	UsernameClaim      string
+	GroupsClaim        string
+	UserACL            map[string]map[string]string
+	GroupACL           map[string]map[string]string
+	CaseSensitiveNames bool
+}
+
+// APIAuthStatic defines options of static authz backend which grants access
+// defined in ACL file to every request.
+type APIAuthStatic struct {
+	Path string
+}
+
+// APIAuthChain defines options of authz backend combining other backends.
+type APIAuthChain struct {
+	Backends []string
+	Policy   string
+}
+
+// APIAuthTokens defines options of API tokens issued by Rhythm.
+type APIAuthTokens struct {
+	Enabled      bool
+	AdminProject string
+	MaxTTL       time.Duration
+}
+
 // Storage defines server storage options.
 type Storage struct {
 	Backend   string
@@ -73,11 +161,14 @@ const StorageBackendZK = "zookeeper"
 
 // StorageZK defines ZooKeeper storage backend options.
 type StorageZK struct {
-	Dir     string
-	Addrs   []string
-	Timeout time.Duration
-	Auth    ZKAuth
-	TaskTTL time.Duration
+	Dir          string
+	Addrs        []string
+	Timeout      time.Duration
+	Auth         ZKAuth
+	TaskTTL      time.Duration
+	TaskMinCount int
+	TaskMaxCount int
+	CacheTTL     time.Duration
 }
 
 // CoordinatorBackendZK denotes ZooKeeper coordinator backend.
@@ -119,13 +210,64 @@ type ZKAuthDigest struct {
 // Secrets backends.
 const (
 	SecretsBackendVault = "vault"
+	SecretsBackendFile  = "file"
+	SecretsBackendHTTP  = "http"
 	SecretsBackendNone  = "none"
 )
 
 // Secrets defines server secrets options.
 type Secrets struct {
 	Backend string
-	Vault   SecretsVault
+	// Additional backends used for secrets whose paths are prefixed with
+	// backend's name (e.g. "file:db/password").
+	Chain []string
+	// How long successfully read secrets are cached. Cache is disabled if
+	// zero.
+	CacheTTL time.Duration
+	// How often secrets of running tasks are compared with their current
+	// values. Disabled if zero.
+	RotationCheckInterval time.Duration
+	Vault                 SecretsVault
+	File                  SecretsFile
+	HTTP                  SecretsHTTP
+}
+
+// Uses returns true if backend is either default one or is in chain.
+func (s *Secrets) Uses(backend string) bool {
+	if s.Backend == backend {
+		return true
+	}
+	for _, b := range s.Chain {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// Decryption methods of file secrets backend.
+const (
+	SecretsFileDecryptNone = "none"
+	SecretsFileDecryptSOPS = "sops"
+	SecretsFileDecryptAge  = "age"
+)
+
+// SecretsFile defines local file secrets backend options.
+type SecretsFile struct {
+	Path    string
+	Decrypt string
+	// Binary used for decryption. Named after decryption method by default.
+	Command string
+	// File with age identities (used only by age decryption method).
+	AgeIdentity string
+}
+
+// SecretsHTTP defines HTTP secrets backend options.
+type SecretsHTTP struct {
+	Addr    string
+	Token   string
+	Timeout time.Duration
+	CACert  string
 }
 
 // SecretsVault defines Vault secrets backend options.
@@ -135,6 +277,50 @@ type SecretsVault struct {
 	Timeout time.Duration
 	Root    string
 	CACert  string
+	Auth    SecretsVaultAuth
+	// Version of KV secrets engine mounted under Root. Detected if zero.
+	KVVersion int
+}
+
+// Vault authn methods.
+const (
+	SecretsVaultAuthToken      = "token"
+	SecretsVaultAuthAppRole    = "approle"
+	SecretsVaultAuthCert       = "cert"
+	SecretsVaultAuthJWT        = "jwt"
+	SecretsVaultAuthKubernetes = "kubernetes"
+)
+
+// SecretsVaultAuth defines how Vault token is obtained.
+type SecretsVaultAuth struct {
+	Method string
+	// Path where auth method is mounted. Method's name by default.
+	Mount   string
+	AppRole SecretsVaultAppRole
+	Cert    SecretsVaultCert
+	JWT     SecretsVaultJWT
+	// Delay between failed login attempts.
+	RetryInterval time.Duration
+}
+
+// SecretsVaultAppRole defines options of AppRole authn method.
+type SecretsVaultAppRole struct {
+	RoleID   string
+	SecretID string
+}
+
+// SecretsVaultCert defines options of TLS certificate authn method.
+type SecretsVaultCert struct {
+	CertFile string
+	KeyFile  string
+	Name     string
+}
+
+// SecretsVaultJWT defines options of JWT and Kubernetes authn methods.
+type SecretsVaultJWT struct {
+	Role string
+	// File with JWT. It's read on every login so token can be rotated.
+	TokenFile string
 }
 
 // Mesos defines Mesos-related options.
@@ -151,8 +337,20 @@ type Mesos struct {
 	Labels          map[string]string
 	Roles           []string
 	LogAllEvents    bool
+	TaskLogs        MesosTaskLogs
+}
+
+// MesosTaskLogs defines options of capturing tails of tasks' stdout and stderr.
+type MesosTaskLogs struct {
+	MaxSize int
+	Timeout time.Duration
 }
 
+// MaxTaskLogsSize is the upper bound of MesosTaskLogs.MaxSize. Both tails
+// are stored with task in single ZooKeeper node (limited to 1 MB) and each
+// byte can take up to 6 bytes once escaped in JSON.
+const MaxTaskLogsSize = 64 * 1024
+
 // Mesos authn schemes.
 const (
 	MesosAuthTypeBasic = "basic"
@@ -177,6 +375,12 @@ const (
 	LoggingBackendSentry = "sentry"
 )
 
+// Logging formats.
+const (
+	LoggingFormatText = "text"
+	LoggingFormatJSON = "json"
+)
+
 // Logging levels.
 const (
 	LoggingLevelDebug = "debug"
@@ -185,11 +389,55 @@ const (
 	LoggingLevelError = "error"
 )
 
+// Metrics defines options of exposed Prometheus metrics.
+type Metrics struct {
+	Jobs MetricsJobs
+}
+
+// MetricsJobs defines which jobs have per-job metrics.
+type MetricsJobs struct {
+	// Entries like "group", "group/project" or "group/project/id". "*" matches all jobs.
+	Include []string
+	// Job matches if any of its labels has given value.
+	Labels map[string]string
+}
+
+// Tracing backends.
+const (
+	TracingBackendNone = "none"
+	TracingBackendOTLP = "otlp"
+)
+
+// Tracing defines OpenTelemetry tracing options.
+type Tracing struct {
+	Backend     string
+	SampleRatio float64
+	OTLP        TracingOTLP
+}
+
+// TracingOTLP defines options of OTLP (over HTTP) tracing backend.
+type TracingOTLP struct {
+	Endpoint string
+	Insecure bool
+	CACert   string
+	Headers  map[string]string
+	Timeout  time.Duration
+}
+
 // Logging defines server logging options.
 type Logging struct {
-	Level   string
-	Backend string
-	Sentry  LoggingSentry
+	Level    string
+	Format   string
+	Backend  string
+	Sentry   LoggingSentry
+	Sampling LoggingSampling
+}
+
+// LoggingSampling defines sampling of high-rate log entries.
+type LoggingSampling struct {
+	// Maximum number of similar entries logged within interval. 0 disables sampling.
+	Burst    int
+	Interval time.Duration
 }
 
 // LoggingSentry defines Sentry logging backend options.
@@ -215,7 +463,10 @@ func millisecondFieldsToDuration(v reflect.Value) {
 	}
 }
 
-// New creates new configuration struct.
+// New creates new configuration struct. Fields can be overridden by
+// environment variables and string values can reference files (see applyEnv
+// and resolveFileRefs). Returns error listing all unknown fields and invalid
+// values if configuration doesn't pass validation.
 func New(path string) (*Conf, error) {
 	file, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -223,14 +474,34 @@ func New(path string) (*Conf, error) {
 	}
 	var conf = &Conf{
 		API: API{
-			Addr: "localhost:8000",
+			Addr:            "localhost:8000",
+			ShutdownTimeout: 30000, // 30s
 			Auth: APIAuth{
-				Backend: APIAuthBackendNone,
+				Backend:          APIAuthBackendNone,
+				CacheTTL:         30000, // 30s
+				NegativeCacheTTL: 5000,  // 5s
+				GitLab: APIAuthGitLab{
+					Roles: map[string]string{
+						APIAuthGitLabReporter:   "readonly",
+						APIAuthGitLabDeveloper:  "readwrite",
+						APIAuthGitLabMaintainer: "readwrite",
+						APIAuthGitLabOwner:      "readwrite",
+					},
+				},
 				LDAP: APIAuthLDAP{
 					Timeout:     5000,
 					GroupFilter: "(|(memberUid={{.Username}})(member={{.UserDN}})(uniqueMember={{.UserDN}}))",
 					GroupAttr:   "cn",
 				},
+				JWT: APIAuthJWT{
+					Timeout:       10000, // 10s
+					Leeway:        60000, // 1m
+					UsernameClaim: "email",
+					GroupsClaim:   "groups",
+				},
+				Chain: APIAuthChain{
+					Policy: APIAuthChainPolicyFirst,
+				},
 			},
 		},
 		Storage: Storage{
@@ -242,7 +513,8 @@ func New(path string) (*Conf, error) {
 				Auth: ZKAuth{
 					Scheme: ZKAuthSchemeWorld,
 				},
-				TaskTTL: 1000 * 3600 * 24, // 24h
+				TaskTTL:  1000 * 3600 * 24, // 24h
+				CacheTTL: 5000,             // 5s
 			},
 		},
 		Coordinator: Coordinator{
@@ -257,10 +529,22 @@ func New(path string) (*Conf, error) {
 			},
 		},
 		Secrets: Secrets{
-			Backend: SecretsBackendNone,
+			Backend:               SecretsBackendNone,
+			CacheTTL:              30000, // 30s
+			RotationCheckInterval: 60000, // 1m
 			Vault: SecretsVault{
 				Timeout: 0, // no timeout
 				Root:    "secret/rhythm/",
+				Auth: SecretsVaultAuth{
+					Method:        SecretsVaultAuthToken,
+					RetryInterval: 10000, // 10s
+				},
+			},
+			File: SecretsFile{
+				Decrypt: SecretsFileDecryptSOPS,
+			},
+			HTTP: SecretsHTTP{
+				Timeout: 10000, // 10s
 			},
 		},
 		Mesos: Mesos{
@@ -269,20 +553,54 @@ func New(path string) (*Conf, error) {
 			Auth: MesosAuth{
 				Type: MesosAuthTypeNone,
 			},
+			TaskLogs: MesosTaskLogs{
+				MaxSize: 4096,
+				Timeout: 5000, // 5s
+			},
 		},
 		Logging: Logging{
 			Backend: LoggingBackendNone,
 			Level:   LoggingLevelInfo,
+			Format:  LoggingFormatText,
+			Sampling: LoggingSampling{
+				Interval: 1000,
+			},
+		},
+		Tracing: Tracing{
+			Backend:     TracingBackendNone,
+			SampleRatio: 1,
+			OTLP: TracingOTLP{
+				Endpoint: "localhost:4318",
+				Timeout:  10000, // 10s
+			},
 		},
 	}
 	err = json.Unmarshal(file, conf)
 	if err != nil {
 		return nil, err
 	}
+	var raw interface{}
+	err = json.Unmarshal(file, &raw)
+	if err != nil {
+		return nil, err
+	}
+	var errs *multierror.Error
+	for _, path := range unknownFields(raw, reflect.TypeOf(*conf), "") {
+		errs = multierror.Append(errs, fmt.Errorf("%s: unknown field", path))
+	}
+	errs = applyEnv(reflect.ValueOf(conf).Elem(), envPrefix, "", errs)
+	errs = resolveFileRefs(reflect.ValueOf(conf).Elem(), "", errs)
 	conf.Coordinator.ZooKeeper.ElectionDir = "election/mesos_scheduler"
 	// All time.Duration fields from Conf should be in milliseconds so
 	// conversion to time elapsed in nanoseconds (represented by time.Duration)
 	// is needed.
 	millisecondFieldsToDuration(reflect.ValueOf(conf).Elem())
+	err = conf.Validate()
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if errs != nil {
+		return nil, errs
+	}
 	return conf, nil
 }
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newConf writes configuration into temporary file and loads it.
+func newConf(t *testing.T, content string) (*Conf, error) {
+	f, err := ioutil.TempFile("", "rhythm-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return New(f.Name())
+}
+
+func TestTaskRetentionCounts(t *testing.T) {
+	tests := []struct {
+		zk    string
+		valid bool
+	}{
+		{`{}`, true},
+		{`{"taskmincount": 5, "taskmaxcount": 10}`, true},
+		{`{"taskmincount": 10}`, true},
+		{`{"taskmincount": 10, "taskmaxcount": 5}`, false},
+	}
+	for _, test := range tests {
+		_, err := newConf(t, `{"mesos": {"addrs": ["http://127.0.0.1:5050"]}, "storage": {"zookeeper": `+test.zk+`}}`)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.zk, err)
+		}
+		if !test.valid && (err == nil || !strings.Contains(err.Error(), "taskmaxcount")) {
+			t.Errorf("%s: got %v, want error about taskmaxcount", test.zk, err)
+		}
+	}
+}
+
+func TestEnvReplacesMaps(t *testing.T) {
+	os.Setenv("RHYTHM_API_AUTH_GITLAB_ROLES", `{"owner": "readwrite"}`)
+	defer os.Unsetenv("RHYTHM_API_AUTH_GITLAB_ROLES")
+	c, err := newConf(t, `{"mesos": {"addrs": ["http://127.0.0.1:5050"]}, "api": {"auth": {"gitlab": {"roles": {"guest": "readonly"}}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := c.API.Auth.GitLab.Roles
+	if len(roles) != 1 || roles[APIAuthGitLabOwner] != "readwrite" {
+		t.Errorf("got %v, want only owner mapped", roles)
+	}
+}
+
+func TestConfigFileMergesMaps(t *testing.T) {
+	c, err := newConf(t, `{"mesos": {"addrs": ["http://127.0.0.1:5050"]}, "api": {"auth": {"gitlab": {"roles": {"guest": "readonly"}}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := c.API.Auth.GitLab.Roles
+	if roles[APIAuthGitLabGuest] != "readonly" || roles[APIAuthGitLabDeveloper] != "readwrite" {
+		t.Errorf("got %v, want defaults with guest added", roles)
+	}
+}
@@ -0,0 +1,104 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	envPrefix     = "RHYTHM"
+	fileRefPrefix = "@file:"
+)
+
+// applyEnv overrides fields with values of environment variables named after
+// fields' paths like RHYTHM_SECRETS_VAULT_TOKEN. Values of non-string fields
+// are decoded as JSON (e.g. RHYTHM_MESOS_ADDRS='["https://example.com"]').
+// Decoded value replaces the whole field so maps aren't merged with defaults.
+func applyEnv(v reflect.Value, name, path string, errs *multierror.Error) *multierror.Error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fname := name + "_" + strings.ToUpper(f.Name)
+		fpath := joinPath(path, strings.ToLower(f.Name))
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			errs = applyEnv(field, fname, fpath, errs)
+			continue
+		}
+		value, ok := os.LookupEnv(fname)
+		if !ok {
+			continue
+		}
+		if field.Kind() == reflect.String {
+			field.SetString(value)
+			continue
+		}
+		decoded := reflect.New(field.Type())
+		err := json.Unmarshal([]byte(value), decoded.Interface())
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: invalid value of %s: %s", fpath, fname, err))
+			continue
+		}
+		field.Set(decoded.Elem())
+	}
+	return errs
+}
+
+// resolveFileRefs replaces string values like "@file:/run/secrets/token"
+// with content of referenced file. Trailing newline is trimmed.
+func resolveFileRefs(v reflect.Value, path string, errs *multierror.Error) *multierror.Error {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			errs = resolveFileRefs(v.Field(i), joinPath(path, strings.ToLower(t.Field(i).Name)), errs)
+		}
+	case reflect.String:
+		resolved, err := readFileRef(v.String())
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %s", path, err))
+		} else {
+			v.SetString(resolved)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			errs = resolveFileRefs(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errs
+		}
+		for _, k := range v.MapKeys() {
+			resolved, err := readFileRef(v.MapIndex(k).String())
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("%s: %s", joinPath(path, k.String()), err))
+			} else {
+				v.SetMapIndex(k, reflect.ValueOf(resolved))
+			}
+		}
+	}
+	return errs
+}
+
+func readFileRef(value string) (string, error) {
+	if !strings.HasPrefix(value, fileRefPrefix) {
+		return value, nil
+	}
+	content, err := ioutil.ReadFile(strings.TrimPrefix(value, fileRefPrefix))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
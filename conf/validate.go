@@ -0,0 +1,429 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mlowicki/rhythm/api/auth"
+)
+
+// unknownFields returns paths of keys from decoded JSON which don't match any
+// field of type t. Like encoding/json, matching is case-insensitive.
+func unknownFields(v interface{}, t reflect.Type, path string) []string {
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil // Type mismatches are reported by json.Unmarshal.
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field, ok := findField(t, k)
+			if !ok {
+				unknown = append(unknown, joinPath(path, k))
+				continue
+			}
+			unknown = append(unknown, unknownFields(obj[k], field.Type, joinPath(path, k))...)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for k, elem := range obj {
+			unknown = append(unknown, unknownFields(elem, t.Elem(), joinPath(path, k))...)
+		}
+		sort.Strings(unknown)
+	case reflect.Slice:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, elem := range arr {
+			unknown = append(unknown, unknownFields(elem, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return unknown
+}
+
+func findField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath == "" && strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// validator collects all found problems so they can be reported at once.
+type validator struct {
+	errs *multierror.Error
+}
+
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.errs = multierror.Append(v.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.errorf(path, "invalid value %q (allowed: %s)", value, strings.Join(allowed, ", "))
+}
+
+func (v *validator) required(path, value string) {
+	if value == "" {
+		v.errorf(path, "required")
+	}
+}
+
+func (v *validator) file(path, value string) {
+	if value == "" {
+		return
+	}
+	info, err := os.Stat(value)
+	if err != nil {
+		v.errorf(path, "%s", err)
+	} else if info.IsDir() {
+		v.errorf(path, "%s is a directory", value)
+	}
+}
+
+func (v *validator) url(path, value string, schemes ...string) {
+	u, err := url.Parse(value)
+	if err != nil {
+		v.errorf(path, "%s", err)
+		return
+	}
+	v.oneOf(path+" (scheme)", u.Scheme, schemes...)
+}
+
+func (v *validator) positive(path string, value int64) {
+	if value <= 0 {
+		v.errorf(path, "must be positive")
+	}
+}
+
+func (v *validator) nonNegative(path string, value int64) {
+	if value < 0 {
+		v.errorf(path, "must not be negative")
+	}
+}
+
+func (v *validator) zkAuth(path string, c *ZKAuth) {
+	v.oneOf(path+".scheme", c.Scheme, ZKAuthSchemeDigest, ZKAuthSchemeWorld)
+	if c.Scheme == ZKAuthSchemeDigest {
+		v.required(path+".digest.user", c.Digest.User)
+	}
+}
+
+// acl checks if ACL uses only built-in or custom roles.
+func (v *validator) acl(path string, acl map[string]map[string]string, roles []string) {
+	for name, entries := range acl {
+		for target, role := range entries {
+			v.oneOf(joinPath(joinPath(path, name), target), role, roles...)
+		}
+	}
+}
+
+// roles checks definitions of custom roles and returns names of all roles
+// (built-in ones included) sorted.
+func (v *validator) roles(path string, defs map[string][]string) []string {
+	if _, err := auth.NewRoles(defs); err != nil {
+		v.errorf(path, "%s", err)
+	}
+	names := auth.BuiltinRoles()
+	for name := range defs {
+		if name != auth.ACLReadOnly && name != auth.ACLReadWrite && name != auth.ACLAdmin {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks if configuration is complete and consistent. All found
+// problems are returned at once.
+func (c *Conf) Validate() error {
+	var v validator
+	c.validateAPI(&v)
+	c.validateStorage(&v)
+	c.validateCoordinator(&v)
+	c.validateSecrets(&v)
+	c.validateMesos(&v)
+	c.validateLogging(&v)
+	c.validateTracing(&v)
+	return v.errs.ErrorOrNil()
+}
+
+func (c *Conf) validateAPI(v *validator) {
+	if (c.API.CertFile == "") != (c.API.KeyFile == "") {
+		v.errorf("api", "certfile and keyfile must be set together")
+	}
+	v.file("api.certfile", c.API.CertFile)
+	v.file("api.keyfile", c.API.KeyFile)
+	v.positive("api.shutdowntimeout", int64(c.API.ShutdownTimeout))
+	v.nonNegative("api.auth.cachettl", int64(c.API.Auth.CacheTTL))
+	v.nonNegative("api.auth.negativecachettl", int64(c.API.Auth.NegativeCacheTTL))
+	roles := v.roles("api.auth.roles", c.API.Auth.Roles)
+	if tokens := &c.API.Auth.Tokens; tokens.Enabled {
+		v.required("api.auth.tokens.adminproject", tokens.AdminProject)
+		if tokens.AdminProject != "" && strings.Count(tokens.AdminProject, "/") != 1 {
+			v.errorf("api.auth.tokens.adminproject", "must be in form group/project")
+		}
+		v.nonNegative("api.auth.tokens.maxttl", int64(tokens.MaxTTL))
+	}
+	backends := []string{APIAuthBackendNone, APIAuthBackendGitLab, APIAuthBackendLDAP, APIAuthBackendJWT, APIAuthBackendStatic}
+	v.oneOf("api.auth.backend", c.API.Auth.Backend, append(backends, APIAuthBackendChain)...)
+	if c.API.Auth.Backend == APIAuthBackendChain {
+		chain := &c.API.Auth.Chain
+		if len(chain.Backends) == 0 {
+			v.errorf("api.auth.chain.backends", "required")
+		}
+		seen := make(map[string]bool)
+		for i, b := range chain.Backends {
+			path := fmt.Sprintf("api.auth.chain.backends[%d]", i)
+			// "none" grants full access to everyone so it would open API
+			// regardless of other members.
+			v.oneOf(path, b, APIAuthBackendGitLab, APIAuthBackendLDAP, APIAuthBackendJWT, APIAuthBackendStatic)
+			if seen[b] {
+				v.errorf(path, "duplicated backend %q", b)
+			}
+			seen[b] = true
+		}
+		v.oneOf("api.auth.chain.policy", chain.Policy, APIAuthChainPolicyFirst, APIAuthChainPolicyMax)
+	}
+	if c.API.Auth.Uses(APIAuthBackendStatic) {
+		v.required("api.auth.static.path", c.API.Auth.Static.Path)
+		v.file("api.auth.static.path", c.API.Auth.Static.Path)
+	}
+	if c.API.Auth.Uses(APIAuthBackendGitLab) {
+		gl := &c.API.Auth.GitLab
+		v.required("api.auth.gitlab.addr", gl.Addr)
+		if gl.Addr != "" {
+			v.url("api.auth.gitlab.addr", gl.Addr, "http", "https")
+		}
+		v.file("api.auth.gitlab.cacert", gl.CACert)
+		for level, role := range gl.Roles {
+			path := joinPath("api.auth.gitlab.roles", level)
+			v.oneOf(path+" (level)", level, APIAuthGitLabGuest, APIAuthGitLabReporter, APIAuthGitLabDeveloper, APIAuthGitLabMaintainer, APIAuthGitLabOwner)
+			v.oneOf(path, role, roles...)
+		}
+	}
+	if c.API.Auth.Uses(APIAuthBackendLDAP) {
+		ldap := &c.API.Auth.LDAP
+		if len(ldap.Addrs) == 0 {
+			v.errorf("api.auth.ldap.addrs", "required")
+		}
+		for i, addr := range ldap.Addrs {
+			v.url(fmt.Sprintf("api.auth.ldap.addrs[%d]", i), addr, "ldap", "ldaps")
+		}
+		v.required("api.auth.ldap.userdn", ldap.UserDN)
+		v.required("api.auth.ldap.userattr", ldap.UserAttr)
+		v.required("api.auth.ldap.groupdn", ldap.GroupDN)
+		v.required("api.auth.ldap.groupattr", ldap.GroupAttr)
+		v.file("api.auth.ldap.cacert", ldap.CACert)
+		v.positive("api.auth.ldap.timeout", int64(ldap.Timeout))
+		_, err := template.New("groupfilter").Parse(ldap.GroupFilter)
+		if err != nil {
+			v.errorf("api.auth.ldap.groupfilter", "%s", err)
+		}
+		v.acl("api.auth.ldap.useracl", ldap.UserACL, roles)
+		v.acl("api.auth.ldap.groupacl", ldap.GroupACL, roles)
+	}
+	if c.API.Auth.Uses(APIAuthBackendJWT) {
+		jwt := &c.API.Auth.JWT
+		if jwt.Issuer == "" && jwt.JWKSURL == "" && len(jwt.Keys) == 0 {
+			v.errorf("api.auth.jwt", "one of issuer, jwksurl or keys is required")
+		}
+		if jwt.Issuer != "" {
+			v.url("api.auth.jwt.issuer", jwt.Issuer, "http", "https")
+		}
+		if jwt.JWKSURL != "" {
+			v.url("api.auth.jwt.jwksurl", jwt.JWKSURL, "http", "https")
+		}
+		for i, key := range jwt.Keys {
+			v.file(fmt.Sprintf("api.auth.jwt.keys[%d]", i), key)
+		}
+		for i, alg := range jwt.Algorithms {
+			v.oneOf(fmt.Sprintf("api.auth.jwt.algorithms[%d]", i), alg, "RS256", "RS384", "RS512", "ES256", "ES384", "ES512")
+		}
+		v.file("api.auth.jwt.cacert", jwt.CACert)
+		v.positive("api.auth.jwt.timeout", int64(jwt.Timeout))
+		v.nonNegative("api.auth.jwt.leeway", int64(jwt.Leeway))
+		v.required("api.auth.jwt.audience", jwt.Audience)
+		v.required("api.auth.jwt.usernameclaim", jwt.UsernameClaim)
+		v.acl("api.auth.jwt.useracl", jwt.UserACL, roles)
+		v.acl("api.auth.jwt.groupacl", jwt.GroupACL, roles)
+	}
+}
+
+func (c *Conf) validateStorage(v *validator) {
+	v.oneOf("storage.backend", c.Storage.Backend, StorageBackendZK)
+	if c.Storage.Backend != StorageBackendZK {
+		return
+	}
+	zk := &c.Storage.ZooKeeper
+	if len(zk.Addrs) == 0 {
+		v.errorf("storage.zookeeper.addrs", "required")
+	}
+	v.required("storage.zookeeper.dir", zk.Dir)
+	v.positive("storage.zookeeper.timeout", int64(zk.Timeout))
+	v.zkAuth("storage.zookeeper.auth", &zk.Auth)
+	v.nonNegative("storage.zookeeper.taskttl", int64(zk.TaskTTL))
+	v.nonNegative("storage.zookeeper.taskmincount", int64(zk.TaskMinCount))
+	v.nonNegative("storage.zookeeper.taskmaxcount", int64(zk.TaskMaxCount))
+	if zk.TaskMaxCount > 0 && zk.TaskMaxCount < zk.TaskMinCount {
+		v.errorf("storage.zookeeper.taskmaxcount", "must not be lower than taskmincount")
+	}
+	v.nonNegative("storage.zookeeper.cachettl", int64(zk.CacheTTL))
+}
+
+func (c *Conf) validateCoordinator(v *validator) {
+	v.oneOf("coordinator.backend", c.Coordinator.Backend, CoordinatorBackendZK)
+	if c.Coordinator.Backend != CoordinatorBackendZK {
+		return
+	}
+	zk := &c.Coordinator.ZooKeeper
+	if len(zk.Addrs) == 0 {
+		v.errorf("coordinator.zookeeper.addrs", "required")
+	}
+	v.required("coordinator.zookeeper.dir", zk.Dir)
+	v.positive("coordinator.zookeeper.timeout", int64(zk.Timeout))
+	v.zkAuth("coordinator.zookeeper.auth", &zk.Auth)
+}
+
+func (c *Conf) validateSecrets(v *validator) {
+	backends := []string{SecretsBackendNone, SecretsBackendVault, SecretsBackendFile, SecretsBackendHTTP}
+	v.oneOf("secrets.backend", c.Secrets.Backend, backends...)
+	seen := make(map[string]bool)
+	for i, b := range c.Secrets.Chain {
+		path := fmt.Sprintf("secrets.chain[%d]", i)
+		v.oneOf(path, b, backends...)
+		if seen[b] {
+			v.errorf(path, "duplicated backend %q", b)
+		}
+		seen[b] = true
+	}
+	v.nonNegative("secrets.cachettl", int64(c.Secrets.CacheTTL))
+	v.nonNegative("secrets.rotationcheckinterval", int64(c.Secrets.RotationCheckInterval))
+	if c.Secrets.Uses(SecretsBackendFile) {
+		file := &c.Secrets.File
+		v.required("secrets.file.path", file.Path)
+		v.file("secrets.file.path", file.Path)
+		v.oneOf("secrets.file.decrypt", file.Decrypt, SecretsFileDecryptNone, SecretsFileDecryptSOPS, SecretsFileDecryptAge)
+		if file.Decrypt == SecretsFileDecryptAge {
+			v.required("secrets.file.ageidentity", file.AgeIdentity)
+		}
+		v.file("secrets.file.ageidentity", file.AgeIdentity)
+	}
+	if c.Secrets.Uses(SecretsBackendHTTP) {
+		h := &c.Secrets.HTTP
+		v.required("secrets.http.addr", h.Addr)
+		if h.Addr != "" {
+			v.url("secrets.http.addr", h.Addr, "http", "https")
+		}
+		v.nonNegative("secrets.http.timeout", int64(h.Timeout))
+		v.file("secrets.http.cacert", h.CACert)
+	}
+	if c.Secrets.Uses(SecretsBackendVault) {
+		vault := &c.Secrets.Vault
+		v.required("secrets.vault.addr", vault.Addr)
+		if vault.Addr != "" {
+			v.url("secrets.vault.addr", vault.Addr, "http", "https")
+		}
+		v.nonNegative("secrets.vault.timeout", int64(vault.Timeout))
+		v.file("secrets.vault.cacert", vault.CACert)
+		if vault.KVVersion < 0 || vault.KVVersion > 2 {
+			v.errorf("secrets.vault.kvversion", "invalid value %d (allowed: 0, 1, 2)", vault.KVVersion)
+		}
+		auth := &vault.Auth
+		v.oneOf("secrets.vault.auth.method", auth.Method, SecretsVaultAuthToken, SecretsVaultAuthAppRole, SecretsVaultAuthCert, SecretsVaultAuthJWT, SecretsVaultAuthKubernetes)
+		v.positive("secrets.vault.auth.retryinterval", int64(auth.RetryInterval))
+		switch auth.Method {
+		case SecretsVaultAuthToken:
+			v.required("secrets.vault.token", vault.Token)
+		case SecretsVaultAuthAppRole:
+			v.required("secrets.vault.auth.approle.roleid", auth.AppRole.RoleID)
+		case SecretsVaultAuthCert:
+			v.required("secrets.vault.auth.cert.certfile", auth.Cert.CertFile)
+			v.required("secrets.vault.auth.cert.keyfile", auth.Cert.KeyFile)
+			v.file("secrets.vault.auth.cert.certfile", auth.Cert.CertFile)
+			v.file("secrets.vault.auth.cert.keyfile", auth.Cert.KeyFile)
+		case SecretsVaultAuthJWT, SecretsVaultAuthKubernetes:
+			v.required("secrets.vault.auth.jwt.role", auth.JWT.Role)
+			if auth.Method == SecretsVaultAuthJWT {
+				v.required("secrets.vault.auth.jwt.tokenfile", auth.JWT.TokenFile)
+			}
+			v.file("secrets.vault.auth.jwt.tokenfile", auth.JWT.TokenFile)
+		}
+	}
+}
+
+func (c *Conf) validateMesos(v *validator) {
+	if len(c.Mesos.Addrs) == 0 {
+		v.errorf("mesos.addrs", "required")
+	}
+	for i, addr := range c.Mesos.Addrs {
+		v.url(fmt.Sprintf("mesos.addrs[%d]", i), addr, "http", "https")
+	}
+	v.file("mesos.cacert", c.Mesos.CACert)
+	v.nonNegative("mesos.failovertimeout", int64(c.Mesos.FailoverTimeout))
+	if len(c.Mesos.Roles) == 0 {
+		v.errorf("mesos.roles", "required")
+	}
+	v.oneOf("mesos.auth.type", c.Mesos.Auth.Type, MesosAuthTypeNone, MesosAuthTypeBasic)
+	if c.Mesos.Auth.Type == MesosAuthTypeBasic {
+		v.required("mesos.auth.basic.username", c.Mesos.Auth.Basic.Username)
+	}
+	v.nonNegative("mesos.tasklogs.maxsize", int64(c.Mesos.TaskLogs.MaxSize))
+	if c.Mesos.TaskLogs.MaxSize > MaxTaskLogsSize {
+		v.errorf("mesos.tasklogs.maxsize", "must not be greater than %d", MaxTaskLogsSize)
+	}
+	v.positive("mesos.tasklogs.timeout", int64(c.Mesos.TaskLogs.Timeout))
+}
+
+func (c *Conf) validateLogging(v *validator) {
+	v.oneOf("logging.level", c.Logging.Level, LoggingLevelDebug, LoggingLevelInfo, LoggingLevelWarn, LoggingLevelError)
+	v.oneOf("logging.format", c.Logging.Format, LoggingFormatText, LoggingFormatJSON)
+	v.oneOf("logging.backend", c.Logging.Backend, LoggingBackendNone, LoggingBackendSentry)
+	if c.Logging.Backend == LoggingBackendSentry {
+		v.required("logging.sentry.dsn", c.Logging.Sentry.DSN)
+		v.file("logging.sentry.cacert", c.Logging.Sentry.CACert)
+	}
+	v.nonNegative("logging.sampling.burst", int64(c.Logging.Sampling.Burst))
+	v.positive("logging.sampling.interval", int64(c.Logging.Sampling.Interval))
+}
+
+func (c *Conf) validateTracing(v *validator) {
+	v.oneOf("tracing.backend", c.Tracing.Backend, TracingBackendNone, TracingBackendOTLP)
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.errorf("tracing.sampleratio", "must be between 0 and 1")
+	}
+	if c.Tracing.Backend == TracingBackendOTLP {
+		v.required("tracing.otlp.endpoint", c.Tracing.OTLP.Endpoint)
+		v.file("tracing.otlp.cacert", c.Tracing.OTLP.CACert)
+		v.positive("tracing.otlp.timeout", int64(c.Tracing.OTLP.Timeout))
+	}
+}
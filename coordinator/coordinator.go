@@ -5,11 +5,14 @@ import (
 
 	"github.com/mlowicki/rhythm/conf"
 	"github.com/mlowicki/rhythm/coordinator/zk"
+	"github.com/mlowicki/rhythm/health"
 	log "github.com/sirupsen/logrus"
 )
 
 type coordinator interface {
 	WaitUntilLeader() context.Context
+	Check() health.Check
+	Close() error
 }
 
 // New creates fresh coordinator instance.
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
 	"github.com/mlowicki/rhythm/zkutil"
 	"github.com/samuel/go-zookeeper/zk"
 	log "github.com/sirupsen/logrus"
@@ -23,12 +24,22 @@ type Coordinator struct {
 	ticket      string
 	eventChan   <-chan zk.Event
 	cancel      context.CancelFunc
+	closed      bool
 	sync.Mutex
 }
 
 // WaitUntilLeader blocks until this coordinator instance becomes a leader.
+// Returned context is already cancelled if coordinator has been closed.
 func (coord *Coordinator) WaitUntilLeader() context.Context {
 	for {
+		coord.Lock()
+		closed := coord.closed
+		coord.Unlock()
+		if closed {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx
+		}
 		isLeader, ch, err := coord.isLeader()
 		if err != nil {
 			log.Errorf("Failed checking if elected as leader: %s", err)
@@ -50,6 +61,40 @@ func (coord *Coordinator) WaitUntilLeader() context.Context {
 	return ctx
 }
 
+// Close removes registration ticket so other instance can become a leader
+// immediately instead of waiting for session timeout. Leader's context is
+// cancelled and connection closed.
+func (coord *Coordinator) Close() error {
+	coord.Lock()
+	ticket := coord.ticket
+	coord.ticket = ""
+	coord.closed = true
+	if coord.cancel != nil {
+		coord.cancel()
+		coord.cancel = nil
+	}
+	coord.Unlock()
+	var err error
+	if ticket != "" {
+		err = coord.conn.Delete(coord.dir+"/"+coord.electionDir+"/"+ticket, -1)
+		if err == zk.ErrNoNode {
+			err = nil
+		}
+	}
+	coord.conn.Close()
+	return err
+}
+
+// Check returns state of connection to ZooKeeper and leader election.
+func (coord *Coordinator) Check() health.Check {
+	check := zkutil.Check(coord.conn)
+	coord.Lock()
+	registered := coord.ticket != ""
+	coord.Unlock()
+	check.Details["Registered"] = fmt.Sprintf("%t", registered)
+	return check
+}
+
 func (coord *Coordinator) register() error {
 	name, err := coord.conn.Create(coord.dir+"/"+coord.electionDir+"/", []byte{}, zk.FlagEphemeral|zk.FlagSequence, coord.acl(zk.PermAll))
 	if err != nil {
@@ -149,7 +194,10 @@ func New(c *conf.CoordinatorZK) (*Coordinator, error) {
 	go func() {
 		for {
 			select {
-			case ev := <-coord.eventChan:
+			case ev, ok := <-coord.eventChan:
+				if !ok {
+					return
+				}
 				log.Printf("ZooKeeper event: %s", ev)
 				if ev.State == zk.StateDisconnected {
 					log.Printf("Disconnected from ZooKeeper: %s", ev)
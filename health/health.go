@@ -0,0 +1,95 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+// Check describes state of a single dependency.
+type Check struct {
+	Healthy bool
+	Message string            `json:",omitempty"`
+	Details map[string]string `json:",omitempty"`
+}
+
+// Checker is implemented by components which state can be verified.
+type Checker interface {
+	Check() Check
+}
+
+// Mesos tracks state of the Mesos framework run by the leader.
+type Mesos struct {
+	isLeader           func() bool
+	mut                sync.Mutex
+	subscribed         bool
+	frameworkID        string
+	leaderURL          string
+	lastReconciliation time.Time
+	lastOffersTuning   time.Time
+}
+
+// NewMesos creates fresh instance of Mesos state tracker.
+func NewMesos(isLeader func() bool) *Mesos {
+	return &Mesos{isLeader: isLeader}
+}
+
+// SetSubscribed records successful subscription to Mesos master.
+func (m *Mesos) SetSubscribed(frameworkID, leaderURL string) {
+	m.mut.Lock()
+	m.subscribed = true
+	m.frameworkID = frameworkID
+	m.leaderURL = leaderURL
+	m.mut.Unlock()
+}
+
+// SetUnsubscribed records termination of subscription.
+func (m *Mesos) SetUnsubscribed() {
+	m.mut.Lock()
+	m.subscribed = false
+	m.leaderURL = ""
+	m.mut.Unlock()
+}
+
+// ReconciliationFinished records successful reconciliation round.
+func (m *Mesos) ReconciliationFinished() {
+	m.mut.Lock()
+	m.lastReconciliation = time.Now()
+	m.mut.Unlock()
+}
+
+// OffersTuningFinished records successful offers tuner round.
+func (m *Mesos) OffersTuningFinished() {
+	m.mut.Lock()
+	m.lastOffersTuning = time.Now()
+	m.mut.Unlock()
+}
+
+// Check returns state of the framework. Instance which isn't a leader doesn't
+// subscribe to Mesos so it's always healthy.
+func (m *Mesos) Check() Check {
+	if !m.isLeader() {
+		return Check{Healthy: true, Message: "Not leader"}
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	check := Check{
+		Healthy: m.subscribed,
+		Details: map[string]string{
+			"FrameworkID":        m.frameworkID,
+			"LeaderURL":          m.leaderURL,
+			"LastReconciliation": formatTime(m.lastReconciliation),
+			"LastOffersTuning":   formatTime(m.lastOffersTuning),
+		},
+	}
+	if !m.subscribed {
+		check.Message = "Not subscribed"
+	}
+	return check
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "Never"
+	}
+	return t.Format(time.UnixDate)
+}
@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"github.com/mlowicki/rhythm/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Names of fields shared by all components so logs can be indexed
+// and searched consistently.
+const (
+	FieldJob     = "job"
+	FieldGroup   = "group"
+	FieldProject = "project"
+	FieldTaskID  = "task_id"
+	FieldAgentID = "agent_id"
+	FieldOfferID = "offer_id"
+)
+
+// Job returns logger with fields identifying job.
+func Job(jid *model.JobID) *log.Entry {
+	return log.WithFields(log.Fields{
+		FieldJob:     jid.String(),
+		FieldGroup:   jid.Group,
+		FieldProject: jid.Project,
+	})
+}
+
+// Task returns logger with fields identifying job and its task.
+// Empty agentID is omitted.
+func Task(jid *model.JobID, taskID, agentID string) *log.Entry {
+	entry := Job(jid).WithField(FieldTaskID, taskID)
+	if agentID != "" {
+		entry = entry.WithField(FieldAgentID, agentID)
+	}
+	return entry
+}
+
+// Offer returns logger with fields identifying Mesos offer.
+func Offer(offerID, agentID string) *log.Entry {
+	return log.WithFields(log.Fields{
+		FieldOfferID: offerID,
+		FieldAgentID: agentID,
+	})
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"io/ioutil"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Logger used for dropped entries. Its level makes logrus skip formatting.
+var discard = &log.Logger{
+	Out:       ioutil.Discard,
+	Formatter: new(log.TextFormatter),
+	Hooks:     make(log.LevelHooks),
+	Level:     log.PanicLevel,
+}
+
+type samplingWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+type sampler struct {
+	mut      sync.Mutex
+	burst    int
+	interval time.Duration
+	windows  map[string]*samplingWindow
+}
+
+var defaultSampler = &sampler{windows: make(map[string]*samplingWindow)}
+
+// SetSampling configures sampling of high-rate entries. At most burst entries
+// with the same key are logged within interval. 0 disables sampling.
+func SetSampling(burst int, interval time.Duration) {
+	defaultSampler.mut.Lock()
+	defaultSampler.burst = burst
+	defaultSampler.interval = interval
+	defaultSampler.windows = make(map[string]*samplingWindow)
+	defaultSampler.mut.Unlock()
+}
+
+// Sampled returns entry or, if limit of entries with given key has been
+// reached, logger discarding everything. Number of dropped entries is added
+// as "sampled" field to the first entry logged in the next interval.
+func Sampled(entry *log.Entry, key string) *log.Entry {
+	s := defaultSampler
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.burst <= 0 {
+		return entry
+	}
+	now := time.Now()
+	w, ok := s.windows[key]
+	if !ok || now.Sub(w.start) >= s.interval {
+		dropped := 0
+		if ok {
+			dropped = w.dropped
+		}
+		s.windows[key] = &samplingWindow{start: now, count: 1}
+		if dropped > 0 {
+			return entry.WithField("sampled", dropped)
+		}
+		return entry
+	}
+	if w.count >= s.burst {
+		w.dropped++
+		return log.NewEntry(discard)
+	}
+	w.count++
+	return entry
+}
@@ -14,9 +14,11 @@ import (
 	"github.com/mesos/mesos-go/api/v1/lib/scheduler"
 	"github.com/mesos/mesos-go/api/v1/lib/scheduler/events"
 	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
 	"github.com/mlowicki/rhythm/mesos/jobsscheduler"
 	"github.com/mlowicki/rhythm/mesos/offerstuner"
 	"github.com/mlowicki/rhythm/mesos/reconciliation"
+	"github.com/mlowicki/rhythm/mesos/sandbox"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -38,7 +40,7 @@ func getLeaderHost(info *mesos.MasterInfo) string {
 }
 
 // Run starts Mesos controller and exists when controller ends its execution.
-func Run(ctx context.Context, c *conf.Conf, stor storage, secr secrets) error {
+func Run(ctx context.Context, c *conf.Conf, stor storage, secr secrets, status *health.Mesos) error {
 	frameworkIDStore, err := newFrameworkIDStore(stor)
 	if err != nil {
 		return err
@@ -55,9 +57,21 @@ func Run(ctx context.Context, c *conf.Conf, stor storage, secr secrets) error {
 		return err
 	}
 	ctx, cancel := context.WithCancel(ctx)
-	reconciler := reconciliation.New(ctx, cli, stor)
-	offersTuner := offerstuner.New(ctx, cli, stor)
-	jobsSched := jobsscheduler.New(ctx, c.Mesos.Roles, stor, secr, frameworkID, leaderURL)
+	reconciler := reconciliation.New(ctx, cli, stor, status.ReconciliationFinished)
+	offersTuner := offerstuner.New(ctx, cli, stor, status.OffersTuningFinished)
+	var sb *sandbox.Client
+	if c.Mesos.TaskLogs.MaxSize > 0 {
+		sb, err = sandbox.New(&c.Mesos)
+		if err != nil {
+			cancel()
+			return err
+		}
+	}
+	jobsSched := jobsscheduler.New(ctx, c.Mesos.Roles, stor, secr, sb, &c.Metrics.Jobs, frameworkID, leaderURL)
+	if c.Secrets.RotationCheckInterval > 0 {
+		go watchSecretsRotation(ctx, cli, jobsSched, c.Secrets.RotationCheckInterval)
+	}
+	go watchKillRequests(ctx, cli, jobsSched)
 	logger := controller.LogEvents(func(e *scheduler.Event) {
 		log.Printf("Event: %s", e)
 	}).Unless(c.Mesos.LogAllEvents)
@@ -86,6 +100,7 @@ func Run(ctx context.Context, c *conf.Conf, stor storage, secr secrets) error {
 			leaderURL := url.URL{Scheme: scheme, Host: leaderHost}
 			log.Infof("Leading master URL: %s", &leaderURL)
 			leaderURLStore.Set(leaderURL.String())
+			status.SetSubscribed(frameworkID(), leaderURL.String())
 			reconciler.Run()
 			offersTuner.Run()
 		}),
@@ -93,6 +108,8 @@ func Run(ctx context.Context, c *conf.Conf, stor storage, secr secrets) error {
 		scheduler.Event_UPDATE: buildUpdateEventHandler(cli, reconciler, jobsSched),
 	}.Otherwise(logger.HandleEvent))
 
+	defer status.SetUnsubscribed()
+	defer jobsSched.Wait()
 	err = controller.Run(
 		ctx,
 		newFrameworkInfo(&c.Mesos, frameworkIDStore),
@@ -103,6 +120,7 @@ func Run(ctx context.Context, c *conf.Conf, stor storage, secr secrets) error {
 		controller.WithEventHandler(handler),
 		controller.WithSubscriptionTerminated(func(err error) {
 			log.Infof("Connection to Mesos terminated: %s", err)
+			status.SetUnsubscribed()
 			if err != nil && err.Error() == "Framework has been removed" {
 				log.Info("Resetting framework ID")
 				if err := frameworkIDStore.Set(""); err != nil {
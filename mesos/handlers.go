@@ -11,8 +11,10 @@ import (
 	"github.com/mesos/mesos-go/api/v1/lib/scheduler"
 	"github.com/mesos/mesos-go/api/v1/lib/scheduler/calls"
 	"github.com/mesos/mesos-go/api/v1/lib/scheduler/events"
+	"github.com/mlowicki/rhythm/logging"
 	"github.com/mlowicki/rhythm/mesos/jobsscheduler"
 	"github.com/mlowicki/rhythm/mesos/reconciliation"
+	"github.com/mlowicki/rhythm/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
@@ -72,21 +74,24 @@ func buildOffersEventHandler(cli calls.Caller, jobsSched *jobsscheduler.Schedule
 	return func(ctx context.Context, e *scheduler.Event) error {
 		offers := e.GetOffers().GetOffers()
 		offersCount.Add(float64(len(offers)))
-		log.Debugf("Number of received offers: %d", len(offers))
+		logging.Sampled(log.WithField("offers", len(offers)), "mesos.offers").Debug("Received offers")
 		for i := range offers {
 			if ctx.Err() != nil {
 				break
 			}
 			offer := offers[i]
-			tasks := jobsSched.FindTasksForOffer(ctx, &offer)
+			offerCtx, span := tracing.Start(ctx, "mesos.handleOffer")
+			tasks := jobsSched.FindTasksForOffer(offerCtx, &offer)
 			accept := calls.Accept(calls.OfferOperations{calls.OpLaunch(tasks...)}.WithOffers(offer.ID))
-			err := calls.CallNoData(ctx, cli, accept.With(calls.RefuseSeconds(time.Hour)))
+			err := calls.CallNoData(offerCtx, cli, accept.With(calls.RefuseSeconds(time.Hour)))
+			tracing.End(span, err)
+			logger := logging.Offer(offer.ID.Value, offer.AgentID.Value)
 			if err != nil {
-				log.Errorf("Failed to accept offer: %s", err)
+				logger.Errorf("Failed to accept offer: %s", err)
 				return nil
 			}
 			for _, task := range tasks {
-				log.Debugf("Task staged: %s", task.TaskID.Value)
+				logger.WithField(logging.FieldTaskID, task.TaskID.Value).Debug("Task staged")
 			}
 			taskStateUpdatesCount.WithLabelValues("staged").Add(float64(len(tasks)))
 		}
@@ -16,7 +16,9 @@ import (
 	"github.com/mesos/mesos-go/api/v1/lib/scheduler/calls"
 	"github.com/mlowicki/rhythm/conf"
 	tlsutils "github.com/mlowicki/rhythm/tls"
+	"github.com/mlowicki/rhythm/tracing"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func endpointSelector(addrs []string) httpsched.CandidateSelector {
@@ -57,7 +59,22 @@ func newClient(c *conf.Mesos, frameworkID store.Singleton) (calls.Caller, error)
 	return callrules.New(
 		logCalls(map[scheduler.Call_Type]string{scheduler.Call_SUBSCRIBE: "Connecting..."}),
 		callrules.WithFrameworkID(store.GetIgnoreErrors(frameworkID)),
-	).Caller(httpsched.NewCaller(cli, reconnect, endpoints)), nil
+	).Caller(&tracedCaller{httpsched.NewCaller(cli, reconnect, endpoints)}), nil
+}
+
+// tracedCaller records calls to Mesos (except subscription) as spans.
+type tracedCaller struct {
+	caller calls.Caller
+}
+
+func (tc *tracedCaller) Call(ctx context.Context, c *scheduler.Call) (mesos.Response, error) {
+	if c.GetType() == scheduler.Call_SUBSCRIBE {
+		return tc.caller.Call(ctx, c)
+	}
+	ctx, span := tracing.Start(ctx, "mesos."+c.GetType().String(), trace.WithSpanKind(trace.SpanKindClient))
+	resp, err := tc.caller.Call(ctx, c)
+	tracing.End(span, err)
+	return resp, err
 }
 
 func logCalls(messages map[scheduler.Call_Type]string) callrules.Rule {
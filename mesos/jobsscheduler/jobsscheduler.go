@@ -12,29 +12,44 @@ import (
 	"github.com/gogo/protobuf/proto"
 	mesos "github.com/mesos/mesos-go/api/v1/lib"
 	"github.com/mesos/mesos-go/api/v1/lib/resources"
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/logging"
+	"github.com/mlowicki/rhythm/mesos/sandbox"
 	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/tracing"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const srcScheduler = "Scheduler"
 
 type secrets interface {
-	Read(string) (string, error)
+	Read(path string, version int) (map[string]string, error)
 }
 
 type storage interface {
 	GetJobs() ([]*model.Job, error)
+	GetTasks(group, project, id string) ([]*model.Task, error)
 	AddTask(group, project, id string, task *model.Task) error
 	SaveJobRuntime(group, project, id string, state *model.JobRuntime) error
 	GetQueuedJobsIDs() ([]model.JobID, error)
+	GetQueuedJobTraceContext(group, project, id string) (map[string]string, error)
 	DequeueJob(group, project, id string) error
+	QueueJob(group, project, id string, traceContext map[string]string) error
+	GetSecretsKey() ([]byte, error)
+	GetKillRequests() ([]model.JobID, error)
+	DeleteKillRequest(group, project, id string) error
 }
 
 // Scheduler decides which jobs to run in response to received offers.
 type Scheduler struct {
+	ctx         context.Context
 	roles       []string
 	storage     storage
 	secrets     secrets
+	sandbox     *sandbox.Client // nil if capturing tasks' logs is disabled
+	metrics     *jobMetrics
 	frameworkID func() string
 	leaderURL   func() string
 	// In-memory cache of all jobs.
@@ -47,6 +62,12 @@ type Scheduler struct {
 	// Queued job is scheduled for immediate run.
 	queuedJobs    map[string]struct{}
 	queuedJobsMut sync.Mutex
+	// Key used to compute fingerprints of secrets. Loaded from storage on
+	// first use.
+	secretsKey    []byte
+	secretsKeyMut sync.Mutex
+	// Tasks saved in background.
+	pending sync.WaitGroup
 }
 
 func (sched *Scheduler) getJob(jid string) (model.Job, bool) {
@@ -61,15 +82,27 @@ func (sched *Scheduler) getJob(jid string) (model.Job, bool) {
 	return *job, true
 }
 
-func (sched *Scheduler) dequeueJob(job *model.Job) {
+// queueJob schedules job for immediate run.
+func (sched *Scheduler) queueJob(job *model.Job) {
+	err := sched.stor(sched.ctx).QueueJob(job.Group, job.Project, job.ID, nil)
+	if err != nil {
+		logging.Job(&job.JobID).Errorf("Error queueing job: %s", err)
+		return
+	}
+	sched.queuedJobsMut.Lock()
+	sched.queuedJobs[job.FQID()] = struct{}{}
+	sched.queuedJobsMut.Unlock()
+}
+
+func (sched *Scheduler) dequeueJob(ctx context.Context, job *model.Job) {
 	fqid := job.FQID()
 	sched.queuedJobsMut.Lock()
 	_, isQueued := sched.queuedJobs[fqid]
 	sched.queuedJobsMut.Unlock()
 	if isQueued {
-		err := sched.storage.DequeueJob(job.Group, job.Project, job.ID)
+		err := sched.stor(ctx).DequeueJob(job.Group, job.Project, job.ID)
 		if err != nil {
-			log.Errorf("Error dequeuing job: %s", err)
+			logging.Job(&job.JobID).Errorf("Error dequeuing job: %s", err)
 		}
 		sched.queuedJobsMut.Lock()
 		delete(sched.queuedJobs, job.FQID())
@@ -84,11 +117,14 @@ func (sched *Scheduler) setJob(job model.Job) {
 }
 
 // New creates fresh instance of jobs scheduler.
-func New(ctx context.Context, roles []string, stor storage, secr secrets, frameworkID, leaderURL func() string) *Scheduler {
+func New(ctx context.Context, roles []string, stor storage, secr secrets, sb *sandbox.Client, metricsConf *conf.MetricsJobs, frameworkID, leaderURL func() string) *Scheduler {
 	sched := Scheduler{
+		ctx:         ctx,
 		roles:       roles,
 		storage:     stor,
 		secrets:     secr,
+		sandbox:     sb,
+		metrics:     &jobMetrics{conf: metricsConf},
 		frameworkID: frameworkID,
 		leaderURL:   leaderURL,
 		jobs:        make(map[string]*model.Job),
@@ -120,7 +156,7 @@ func (sched *Scheduler) syncQueuedJobsCache() {
 	var jids []model.JobID
 	for {
 		var err error
-		jids, err = sched.storage.GetQueuedJobsIDs()
+		jids, err = sched.stor(sched.ctx).GetQueuedJobsIDs()
 		if err == nil {
 			break
 		}
@@ -142,7 +178,7 @@ func (sched *Scheduler) syncJobsCache() {
 	var newJobs []*model.Job
 	for {
 		var err error
-		newJobs, err = sched.storage.GetJobs()
+		newJobs, err = sched.stor(sched.ctx).GetJobs()
 		if err == nil {
 			break
 		}
@@ -150,6 +186,7 @@ func (sched *Scheduler) syncJobsCache() {
 		<-time.After(time.Second)
 	}
 	sched.jobsMut.Lock()
+	seed := sched.jobsToSeed(newJobs)
 	ids := make(map[string]struct{}, len(newJobs))
 	for _, job := range newJobs {
 		id := job.FQID()
@@ -169,27 +206,71 @@ func (sched *Scheduler) syncJobsCache() {
 		_, ok := ids[id]
 		if !ok {
 			delete(sched.jobs, id)
+			sched.metrics.forget(&job.JobID)
 		}
 	}
 	sched.jobsMut.Unlock()
+	if len(seed) > 0 {
+		go sched.seedMetrics(seed)
+	}
 	log.Debugf("Jobs cache synced")
 }
 
+// jobsToSeed returns copies of jobs with metrics enabled which aren't cached
+// yet. Must be called with jobsMut held.
+func (sched *Scheduler) jobsToSeed(jobs []*model.Job) []*model.Job {
+	var seed []*model.Job
+	for _, job := range jobs {
+		if _, ok := sched.jobs[job.FQID()]; !ok && sched.metrics.enabled(job) {
+			j := *job
+			seed = append(seed, &j)
+		}
+	}
+	return seed
+}
+
+// seedMetrics initializes metrics of jobs using their tasks history. It's run
+// in background so reading history doesn't delay scheduling.
+func (sched *Scheduler) seedMetrics(jobs []*model.Job) {
+	for _, job := range jobs {
+		if sched.ctx.Err() != nil {
+			return
+		}
+		tasks, err := sched.stor(sched.ctx).GetTasks(job.Group, job.Project, job.ID)
+		if err != nil {
+			logging.Job(&job.JobID).Errorf("Error getting tasks to seed metrics: %s", err)
+			continue
+		}
+		// Skip job deleted meanwhile so its metrics aren't brought back.
+		sched.jobsMut.Lock()
+		if _, ok := sched.jobs[job.FQID()]; ok {
+			sched.metrics.seed(job, tasks)
+		}
+		sched.jobsMut.Unlock()
+	}
+}
+
+// Wait blocks until tasks saved in background are stored.
+func (sched *Scheduler) Wait() {
+	sched.pending.Wait()
+}
+
 // HandleTaskStateUpdate processes task state change.
 func (sched *Scheduler) HandleTaskStateUpdate(status *mesos.TaskStatus) {
 	tid := status.TaskID.Value
 	jid, err := parseTaskID(tid)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"taskID": tid,
+			logging.FieldTaskID: tid,
 		}).Errorf("Error getting job ID from task ID: %s", err)
 		return
 	}
 	state := status.GetState()
-	log.Debugf("Task state update: %s (%s)", tid, state)
+	logger := logging.Task(jid, tid, status.GetAgentID().GetValue())
+	logger.WithField("state", state).Debug("Task state update")
 	job, ok := sched.getJob(jid.String())
 	if !ok {
-		log.Warnf("Update for unknown job: %s", jid)
+		logger.Warn("Update for unknown job")
 		return
 	}
 	switch state {
@@ -200,11 +281,16 @@ func (sched *Scheduler) HandleTaskStateUpdate(status *mesos.TaskStatus) {
 	case mesos.TASK_RUNNING:
 		job.State = model.RUNNING
 	case mesos.TASK_FINISHED:
-		log.Debugf("Task finished successfully: %s", status.TaskID.Value)
-		sched.addTaskHistory(status, job.LastStart, jid)
+		logger.Debug("Task finished successfully")
+		sched.addTaskHistory(status, &job)
 		job.State = model.IDLE
 		job.CurrentTaskID = ""
 		job.CurrentAgentID = ""
+		job.CurrentAgentHostname = ""
+		job.CurrentAgentURL = ""
+		job.SecretsFingerprints = nil
+		job.StaleSecrets = nil
+		job.RotationKillTaskID = ""
 	case mesos.TASK_LOST:
 		/*
 		 * 1. Reconciliation run gets running task A
@@ -226,22 +312,32 @@ func (sched *Scheduler) HandleTaskStateUpdate(status *mesos.TaskStatus) {
 	case mesos.TASK_KILLED:
 		fallthrough
 	case mesos.TASK_ERROR:
-		msg := status.GetMessage()
-		reason := status.GetReason().String()
-		src := status.GetSource().String()
-		state := status.GetState()
-		log.Errorf("Task failed: %s (%s; %s; %s; %s)", tid, state, msg, reason, src)
-		sched.addTaskHistory(status, job.LastStart, jid)
+		logger.WithFields(log.Fields{
+			"state":   state,
+			"message": status.GetMessage(),
+			"reason":  status.GetReason().String(),
+			"source":  status.GetSource().String(),
+		}).Error("Task failed")
+		sched.addTaskHistory(status, &job)
+		if state == mesos.TASK_KILLED && job.RotationKillTaskID == tid {
+			logger.Info("Restarting task killed after secrets rotation")
+			sched.queueJob(&job)
+		}
 		job.State = model.FAILED
 		job.CurrentTaskID = ""
 		job.CurrentAgentID = ""
+		job.CurrentAgentHostname = ""
+		job.CurrentAgentURL = ""
+		job.SecretsFingerprints = nil
+		job.StaleSecrets = nil
+		job.RotationKillTaskID = ""
 	default:
 		log.Panicf("Unknown state: %s", state)
 	}
 	sched.setJob(job)
-	err = sched.storage.SaveJobRuntime(jid.Group, jid.Project, jid.ID, &job.JobRuntime)
+	err = sched.stor(sched.ctx).SaveJobRuntime(jid.Group, jid.Project, jid.ID, &job.JobRuntime)
 	if err != nil {
-		log.Errorf("Error saving job while handling update: %s", err)
+		logger.Errorf("Error saving job while handling update: %s", err)
 	}
 }
 
@@ -262,11 +358,18 @@ func (sched *Scheduler) findTaskResources(taskResources, offerResources mesos.Re
 
 // FindTasksForOffer returns tasks to run for passed offer.
 func (sched *Scheduler) FindTasksForOffer(ctx context.Context, offer *mesos.Offer) []mesos.TaskInfo {
+	ctx, span := tracing.Start(ctx, "jobsscheduler.FindTasksForOffer", trace.WithAttributes(
+		attribute.String("mesos.offer.id", offer.ID.Value),
+		attribute.String("mesos.agent.id", offer.AgentID.Value),
+	))
+	defer span.End()
 	rs := mesos.Resources(offer.Resources)
-	log.Debugf("Finding tasks for offer: %s", rs)
+	logger := logging.Offer(offer.ID.Value, offer.AgentID.Value)
+	logging.Sampled(logger, "jobsscheduler.findTasks").Debugf("Finding tasks for offer: %s", rs)
 	jobs, jobsRs := sched.findJobsForResources(rs)
-	log.Debugf("Found %d tasks for offer", len(jobs))
-	tasks := sched.buildTasksForOffer(jobs, jobsRs, offer)
+	logging.Sampled(logger, "jobsscheduler.foundTasks").WithField("tasks", len(jobs)).Debug("Found tasks for offer")
+	tasks := sched.buildTasksForOffer(ctx, jobs, jobsRs, offer)
+	span.SetAttributes(attribute.Int("rhythm.tasks", len(tasks)))
 	return tasks
 }
 
@@ -299,12 +402,15 @@ func (sched *Scheduler) findJobsForResources(res mesos.Resources) ([]model.Job,
 			job.Retries += 1
 		} else {
 			job.Retries = 0
+			if !job.LastStart.IsZero() && job.IsRunnable() {
+				sched.metrics.taskScheduled(job, time.Now().Sub(job.NextRun()))
+			}
 		}
 		taskRes := sched.findTaskResources(jobRes, res)
 		if len(taskRes) == 0 {
 			log.Fatal("Resources not found")
 		}
-		log.Debugf("Found resources for job: %s", job)
+		logging.Job(&job.JobID).Debug("Found resources for job")
 		jobs = append(jobs, *job)
 		tasksRes = append(tasksRes, taskRes)
 		res.Subtract(taskRes...)
@@ -316,46 +422,63 @@ func (sched *Scheduler) findJobsForResources(res mesos.Resources) ([]model.Job,
 	return jobs, tasksRes
 }
 
-func (sched *Scheduler) buildTasksForOffer(jobs []model.Job, ress []mesos.Resources, offer *mesos.Offer) []mesos.TaskInfo {
+func (sched *Scheduler) buildTasksForOffer(ctx context.Context, jobs []model.Job, ress []mesos.Resources, offer *mesos.Offer) []mesos.TaskInfo {
 	var tasks []mesos.TaskInfo
-	var wg sync.WaitGroup
+	var (
+		wg       sync.WaitGroup
+		tasksMut sync.Mutex
+	)
 	for i := range jobs {
 		wg.Add(1)
 		go func(i int, job *model.Job) {
 			defer wg.Done()
+			ctx, span := sched.startLaunchSpan(ctx, job)
 			job.LastStart = time.Now()
-			task, err := sched.newTaskInfo(job)
+			task, fps, err := sched.newTaskInfo(ctx, job)
+			tracing.End(span, err)
 			if err != nil {
-				log.Errorf("Error creating TaskInfo: %s", err)
+				logger := logging.Job(&job.JobID).WithField(logging.FieldOfferID, offer.ID.Value)
+				logger.Errorf("Error creating TaskInfo: %s", err)
 				job.State = model.FAILED
+				sched.pending.Add(1)
 				go func() {
+					defer sched.pending.Done()
 					now := time.Now()
 					task := model.Task{
 						Start:   now,
 						End:     now,
+						Status:  model.TaskError,
 						Message: err.Error(),
 						Reason:  "Error creating TaskInfo",
 						Source:  srcScheduler,
 					}
-					err := sched.storage.AddTask(job.Group, job.Project, job.ID, &task)
+					sched.metrics.taskFinished(job, &task)
+					err := sched.stor(ctx).AddTask(job.Group, job.Project, job.ID, &task)
 					if err != nil {
-						log.Errorf("Error saving task: %s", err)
+						logger.Errorf("Error saving task: %s", err)
 					}
 				}()
 			} else {
 				job.State = model.STAGING
 				job.CurrentTaskID = task.TaskID.GetValue()
 				job.CurrentAgentID = offer.AgentID.GetValue()
+				job.CurrentAgentHostname = offer.Hostname
+				job.CurrentAgentURL = agentURL(offer)
+				job.SecretsFingerprints = fps
+				job.StaleSecrets = nil
+				job.RotationKillTaskID = ""
 				task.AgentID = offer.AgentID
 				task.Resources = ress[i]
+				tasksMut.Lock()
 				tasks = append(tasks, *task)
+				tasksMut.Unlock()
 			}
-			err = sched.storage.SaveJobRuntime(job.Group, job.Project, job.ID, &job.JobRuntime)
+			err = sched.stor(ctx).SaveJobRuntime(job.Group, job.Project, job.ID, &job.JobRuntime)
 			if err != nil {
-				log.Errorf("Error updating job runtime info: %s", err)
+				logging.Job(&job.JobID).Errorf("Error updating job runtime info: %s", err)
 			}
 			sched.setJob(*job)
-			sched.dequeueJob(job)
+			sched.dequeueJob(ctx, job)
 			sched.bookedJobs.Del(job.FQID())
 		}(i, &jobs[i])
 	}
@@ -365,10 +488,37 @@ func (sched *Scheduler) buildTasksForOffer(jobs []model.Job, ress []mesos.Resour
 
 func strPtr(v string) *string { return &v }
 
-func (sched *Scheduler) newTaskInfo(job *model.Job) (*mesos.TaskInfo, error) {
+// startLaunchSpan starts span covering creation of job's task. If job has been
+// queued (e.g. by run-job command) then span is linked with one which queued it.
+func (sched *Scheduler) startLaunchSpan(ctx context.Context, job *model.Job) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{tracing.WithJob(job.Group, job.Project, job.ID)}
+	sched.queuedJobsMut.Lock()
+	_, isQueued := sched.queuedJobs[job.FQID()]
+	sched.queuedJobsMut.Unlock()
+	if isQueued {
+		traceCtx, err := sched.stor(ctx).GetQueuedJobTraceContext(job.Group, job.Project, job.ID)
+		if err != nil {
+			logging.Job(&job.JobID).Errorf("Error getting trace context of queued job: %s", err)
+		} else if traceCtx != nil {
+			opts = append(opts, trace.WithLinks(tracing.Link(traceCtx)))
+		}
+	}
+	return tracing.Start(ctx, "jobsscheduler.launchTask", opts...)
+}
+
+func (sched *Scheduler) readSecret(ctx context.Context, path string, version int) (map[string]string, error) {
+	_, span := tracing.Start(ctx, "secrets.Read")
+	secret, err := sched.secrets.Read(path, version)
+	tracing.End(span, err)
+	return secret, err
+}
+
+// newTaskInfo returns task to launch for job along with fingerprints of its
+// secrets.
+func (sched *Scheduler) newTaskInfo(ctx context.Context, job *model.Job) (*mesos.TaskInfo, map[string]string, error) {
 	tid, err := newTaskID(&job.JobID)
 	if err != nil {
-		return nil, fmt.Errorf("Getting task ID failed: %s", err)
+		return nil, nil, fmt.Errorf("Getting task ID failed: %s", err)
 	}
 	env := mesos.Environment{
 		Variables: []mesos.Environment_Variable{
@@ -382,14 +532,17 @@ func (sched *Scheduler) newTaskInfo(job *model.Job) (*mesos.TaskInfo, error) {
 		envvar := mesos.Environment_Variable{Name: k, Value: strPtr(v)}
 		env.Variables = append(env.Variables, envvar)
 	}
+	fps := make(map[string]string)
 	for k, v := range job.Secrets {
-		path := fmt.Sprintf("%s/%s/%s", job.Group, job.Project, v)
-		secret, err := sched.secrets.Read(path)
+		vars, err := sched.secretEnv(ctx, job, k, &v)
 		if err != nil {
-			return nil, fmt.Errorf("Reading secret failed: %s", err)
+			return nil, nil, err
+		}
+		fps[secretsFingerprintPrefix+k] = sched.fingerprint(vars)
+		for name, value := range vars {
+			envvar := mesos.Environment_Variable{Name: name, Value: strPtr(value)}
+			env.Variables = append(env.Variables, envvar)
 		}
-		envvar := mesos.Environment_Variable{Name: k, Value: &secret}
-		env.Variables = append(env.Variables, envvar)
 	}
 	var containerInfo mesos.ContainerInfo
 	switch job.Container.Type {
@@ -409,8 +562,13 @@ func (sched *Scheduler) newTaskInfo(job *model.Job) (*mesos.TaskInfo, error) {
 			},
 		}
 	default:
-		return nil, fmt.Errorf("Unknown container type: %s", job.Container.Type)
+		return nil, nil, fmt.Errorf("Unknown container type: %s", job.Container.Type)
+	}
+	volumes, chmods, err := sched.secretVolumes(ctx, job, fps)
+	if err != nil {
+		return nil, nil, err
 	}
+	containerInfo.Volumes = volumes
 	labels := make([]mesos.Label, len(job.Labels))
 	for k, v := range job.Labels {
 		func(v string) {
@@ -430,32 +588,90 @@ func (sched *Scheduler) newTaskInfo(job *model.Job) (*mesos.TaskInfo, error) {
 		Container: &containerInfo,
 		Labels:    &mesos.Labels{labels},
 	}
-	return &task, nil
+	wrapCommand(task.Command, chmods)
+	return &task, fps, nil
 }
 
 // Stores information about single run of a job.
-func (sched *Scheduler) addTaskHistory(status *mesos.TaskStatus, start time.Time, jid *model.JobID) {
+func (sched *Scheduler) addTaskHistory(status *mesos.TaskStatus, job *model.Job) {
 	executorID := status.GetExecutorID().GetValue()
 	agentID := status.GetAgentID().GetValue()
 	frameworkID := sched.frameworkID()
+	end := time.Now()
 	task := model.Task{
-		Start:       start,
-		End:         time.Now(),
-		TaskID:      status.TaskID.GetValue(),
-		ExecutorID:  executorID,
-		AgentID:     agentID,
-		FrameworkID: frameworkID,
-		ExecutorURL: fmt.Sprintf("%s/#/agents/%s/frameworks/%s/executors/%s", sched.leaderURL(), agentID, frameworkID, executorID),
+		Start:               job.LastStart,
+		End:                 end,
+		Duration:            end.Sub(job.LastStart),
+		Status:              taskStatus(status.GetState()),
+		ExitCode:            exitCode(status),
+		TaskID:              status.TaskID.GetValue(),
+		ExecutorID:          executorID,
+		AgentID:             agentID,
+		Hostname:            job.CurrentAgentHostname,
+		FrameworkID:         frameworkID,
+		SecretsFingerprints: job.SecretsFingerprints,
+		StaleSecrets:        job.StaleSecrets,
+		ExecutorURL:         fmt.Sprintf("%s/#/agents/%s/frameworks/%s/executors/%s", sched.leaderURL(), agentID, frameworkID, executorID),
 	}
+	sched.metrics.taskFinished(job, &task)
 	if status.GetState() != mesos.TASK_FINISHED {
 		task.Message = status.GetMessage()
 		task.Reason = status.GetReason().String()
 		task.Source = status.GetSource().String()
 	}
-	err := sched.storage.AddTask(jid.Group, jid.Project, jid.ID, &task)
+	logger := logging.Task(&job.JobID, task.TaskID, agentID)
+	save := func() {
+		err := sched.stor(sched.ctx).AddTask(job.Group, job.Project, job.ID, &task)
+		if err != nil {
+			logger.Errorf("Error saving task: %s", err)
+		}
+	}
+	agentAddr := job.CurrentAgentURL
+	if sched.sandbox == nil || agentAddr == "" {
+		save()
+		return
+	}
+	// Command executor uses task ID as executor ID.
+	if executorID == "" {
+		executorID = task.TaskID
+	}
+	sched.pending.Add(1)
+	go func() {
+		defer sched.pending.Done()
+		task.Logs = sched.readTaskLogs(logger, agentAddr, frameworkID, executorID)
+		save()
+	}()
+}
+
+// readTaskLogs fetches tails of task's stdout and stderr from agent.
+// Failures are logged and don't prevent saving the task.
+func (sched *Scheduler) readTaskLogs(logger *log.Entry, agentURL, frameworkID, executorID string) *model.TaskLogs {
+	var logs model.TaskLogs
+	var err error
+	logs.Stdout, err = sched.sandbox.Tail(agentURL, frameworkID, executorID, "stdout")
 	if err != nil {
-		log.Errorf("Error saving task: %s", err)
+		logger.Errorf("Error reading task's stdout: %s", err)
+	}
+	logs.Stderr, err = sched.sandbox.Tail(agentURL, frameworkID, executorID, "stderr")
+	if err != nil {
+		logger.Errorf("Error reading task's stderr: %s", err)
+	}
+	return &logs
+}
+
+// agentURL returns address (with scheme) of agent which sent offer or empty
+// string if it's unknown.
+func agentURL(offer *mesos.Offer) string {
+	u := offer.GetURL()
+	if u == nil {
+		return ""
+	}
+	addr := u.GetAddress()
+	host := addr.GetHostname()
+	if host == "" {
+		host = addr.GetIP()
 	}
+	return fmt.Sprintf("%s://%s:%d", u.GetScheme(), host, addr.GetPort())
 }
 
 type taskID struct {
@@ -0,0 +1,33 @@
+package jobsscheduler
+
+import (
+	"github.com/mlowicki/rhythm/logging"
+	"github.com/mlowicki/rhythm/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// KillRequests returns jobs whose running tasks have been requested to be
+// killed (e.g. through API). Requests are removed from storage. Requests for
+// jobs which aren't running anymore are dropped.
+func (sched *Scheduler) KillRequests() []model.Job {
+	jids, err := sched.stor(sched.ctx).GetKillRequests()
+	if err != nil {
+		logging.Sampled(log.NewEntry(log.StandardLogger()), "jobsscheduler.killRequests").Errorf("Error getting kill requests: %s", err)
+		return nil
+	}
+	var kill []model.Job
+	for i := range jids {
+		jid := &jids[i]
+		job, ok := sched.getJob(jid.String())
+		if ok && job.CurrentTaskID != "" {
+			kill = append(kill, job)
+		} else {
+			logging.Job(jid).Info("Kill request dropped as job is not running")
+		}
+		err := sched.stor(sched.ctx).DeleteKillRequest(jid.Group, jid.Project, jid.ID)
+		if err != nil {
+			logging.Job(jid).Errorf("Error deleting kill request: %s", err)
+		}
+	}
+	return kill
+}
@@ -0,0 +1,157 @@
+package jobsscheduler
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/model"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var jobLabels = []string{"group", "project", "id"}
+
+var taskStatuses = []model.TaskStatus{
+	model.TaskSucceeded,
+	model.TaskFailed,
+	model.TaskKilled,
+	model.TaskLost,
+	model.TaskError,
+}
+
+var (
+	lastSuccessGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "job_last_success_timestamp_seconds",
+		Help: "Time when the last successful task of job has finished.",
+	}, jobLabels)
+	lastFailureGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "job_last_failure_timestamp_seconds",
+		Help: "Time when the last unsuccessful task of job has finished.",
+	}, jobLabels)
+	runsCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "job_runs",
+		Help: "Number of finished tasks of job by status.",
+	}, append(jobLabels, "status"))
+	taskDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "task_duration_seconds",
+		Help:    "Duration of finished tasks.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 16), // 1s - ~9h
+	}, append(jobLabels, "status"))
+	schedulingLagHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "job_scheduling_lag_seconds",
+		Help:    "Time between scheduled and actual start of job.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14), // 1s - ~2h
+	}, jobLabels)
+)
+
+func init() {
+	prometheus.MustRegister(lastSuccessGauge)
+	prometheus.MustRegister(lastFailureGauge)
+	prometheus.MustRegister(runsCount)
+	prometheus.MustRegister(taskDurationHistogram)
+	prometheus.MustRegister(schedulingLagHistogram)
+}
+
+// jobMetrics records per-job metrics for jobs allowed by configuration so
+// cardinality of metrics stays under control. Duration of tasks is recorded
+// for all jobs.
+type jobMetrics struct {
+	conf *conf.MetricsJobs
+	// End times of the last tasks by job so older values (e.g. read from
+	// tasks history in background) never overwrite newer ones.
+	lastMut     sync.Mutex
+	lastSuccess map[string]time.Time
+	lastFailure map[string]time.Time
+}
+
+func (m *jobMetrics) enabled(job *model.Job) bool {
+	for _, entry := range m.conf.Include {
+		if entry == "*" || entry == job.Path() || strings.HasPrefix(job.Path(), entry+"/") {
+			return true
+		}
+	}
+	for k, v := range m.conf.Labels {
+		if lv, ok := job.Labels[k]; ok && lv == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *jobMetrics) taskFinished(job *model.Job, task *model.Task) {
+	status := task.Status.String()
+	taskDurationHistogram.WithLabelValues(job.Group, job.Project, job.ID, status).Observe(task.Duration.Seconds())
+	if !m.enabled(job) {
+		return
+	}
+	runsCount.WithLabelValues(job.Group, job.Project, job.ID, status).Inc()
+	m.setLast(job, task.Status == model.TaskSucceeded, task.End)
+}
+
+// setLast sets timestamp of the last successful or unsuccessful task unless
+// newer one has been set already.
+func (m *jobMetrics) setLast(job *model.Job, succeeded bool, end time.Time) {
+	m.lastMut.Lock()
+	defer m.lastMut.Unlock()
+	last, gauge := &m.lastFailure, lastFailureGauge
+	if succeeded {
+		last, gauge = &m.lastSuccess, lastSuccessGauge
+	}
+	if *last == nil {
+		*last = make(map[string]time.Time)
+	}
+	fqid := job.FQID()
+	if !end.After((*last)[fqid]) {
+		return
+	}
+	(*last)[fqid] = end
+	gauge.WithLabelValues(job.Group, job.Project, job.ID).Set(float64(end.Unix()))
+}
+
+// seed sets timestamps of the last finished tasks using stored task history so
+// gauges are exported right after start (e.g. after failover) and not only
+// once next task of job finishes.
+func (m *jobMetrics) seed(job *model.Job, tasks []*model.Task) {
+	if !m.enabled(job) {
+		return
+	}
+	var lastSuccess, lastFailure time.Time
+	for _, task := range tasks {
+		if task.Status == model.TaskSucceeded {
+			if task.End.After(lastSuccess) {
+				lastSuccess = task.End
+			}
+		} else if task.End.After(lastFailure) {
+			lastFailure = task.End
+		}
+	}
+	if !lastSuccess.IsZero() {
+		m.setLast(job, true, lastSuccess)
+	}
+	if !lastFailure.IsZero() {
+		m.setLast(job, false, lastFailure)
+	}
+}
+
+func (m *jobMetrics) taskScheduled(job *model.Job, lag time.Duration) {
+	if !m.enabled(job) {
+		return
+	}
+	schedulingLagHistogram.WithLabelValues(job.Group, job.Project, job.ID).Observe(lag.Seconds())
+}
+
+// forget removes metrics of job (e.g. deleted one).
+func (m *jobMetrics) forget(jid *model.JobID) {
+	m.lastMut.Lock()
+	delete(m.lastSuccess, jid.String())
+	delete(m.lastFailure, jid.String())
+	m.lastMut.Unlock()
+	lastSuccessGauge.DeleteLabelValues(jid.Group, jid.Project, jid.ID)
+	lastFailureGauge.DeleteLabelValues(jid.Group, jid.Project, jid.ID)
+	schedulingLagHistogram.DeleteLabelValues(jid.Group, jid.Project, jid.ID)
+	for _, status := range taskStatuses {
+		runsCount.DeleteLabelValues(jid.Group, jid.Project, jid.ID, status.String())
+		taskDurationHistogram.DeleteLabelValues(jid.Group, jid.Project, jid.ID, status.String())
+	}
+}
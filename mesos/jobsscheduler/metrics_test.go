@@ -0,0 +1,94 @@
+package jobsscheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/model"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricValue returns value (number of observations for histograms) of series
+// of metric with given group label. False is returned if there is no such
+// series.
+func metricValue(t *testing.T, name, group string) (float64, bool) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "group" && l.GetValue() == group {
+					if h := m.GetHistogram(); h != nil {
+						return float64(h.GetSampleCount()), true
+					}
+					return m.GetGauge().GetValue(), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func metricsTestJob(group string) *model.Job {
+	return &model.Job{JobConf: model.JobConf{JobID: model.JobID{Group: group, Project: "project", ID: "id"}}}
+}
+
+func TestTaskDurationRecordedForAllJobs(t *testing.T) {
+	m := &jobMetrics{conf: &conf.MetricsJobs{}}
+	job := metricsTestJob("durationgroup")
+	m.taskFinished(job, &model.Task{Status: model.TaskSucceeded, End: time.Now(), Duration: time.Second})
+	if count, ok := metricValue(t, "task_duration_seconds", "durationgroup"); !ok || count != 1 {
+		t.Errorf("got %v observations (%v), want 1", count, ok)
+	}
+	if _, ok := metricValue(t, "job_last_success_timestamp_seconds", "durationgroup"); ok {
+		t.Error("metric recorded for job not selected by configuration")
+	}
+}
+
+func TestSeedDoesntOverwriteNewerTimestamp(t *testing.T) {
+	m := &jobMetrics{conf: &conf.MetricsJobs{Include: []string{"*"}}}
+	job := metricsTestJob("seedgroup")
+	end := time.Unix(1500000000, 0)
+	m.taskFinished(job, &model.Task{Status: model.TaskSucceeded, End: end})
+	m.seed(job, []*model.Task{
+		{Status: model.TaskSucceeded, End: end.Add(-time.Hour)},
+		{Status: model.TaskFailed, End: end.Add(-time.Minute)},
+	})
+	if ts, _ := metricValue(t, "job_last_success_timestamp_seconds", "seedgroup"); ts != float64(end.Unix()) {
+		t.Errorf("got last success %v, want %v", ts, end.Unix())
+	}
+	if ts, _ := metricValue(t, "job_last_failure_timestamp_seconds", "seedgroup"); ts != float64(end.Add(-time.Minute).Unix()) {
+		t.Errorf("got last failure %v, want %v", ts, end.Add(-time.Minute).Unix())
+	}
+}
+
+func TestSyncJobsCacheDoesntWaitForSeeding(t *testing.T) {
+	stor := &memStorage{
+		jobs:    []*model.Job{metricsTestJob("syncgroup")},
+		tasks:   []*model.Task{{Status: model.TaskSucceeded, End: time.Unix(1500000000, 0)}},
+		release: make(chan struct{}),
+	}
+	sched := testScheduler(stor)
+	sched.metrics.conf.Include = []string{"*"}
+	sched.syncJobsCache()
+	if _, ok := sched.getJob("syncgroup:project:id"); !ok {
+		t.Fatal("job not cached")
+	}
+	close(stor.release)
+	for i := 0; i < 100; i++ {
+		if ts, ok := metricValue(t, "job_last_success_timestamp_seconds", "syncgroup"); ok {
+			if ts != 1500000000 {
+				t.Errorf("got %v, want 1500000000", ts)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("metrics not seeded")
+}
@@ -0,0 +1,230 @@
+package jobsscheduler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mlowicki/rhythm/logging"
+	"github.com/mlowicki/rhythm/model"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Prefixes of fingerprints' names denoting secrets delivered as environment
+// variables and as files.
+const (
+	secretsFingerprintPrefix     = "secrets."
+	secretFilesFingerprintPrefix = "secretfiles."
+)
+
+var rotatedSecretsCount = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "jobs_rotated_secrets",
+	Help: "Number of secrets rotated while tasks using them were running.",
+})
+
+func init() {
+	prometheus.MustRegister(rotatedSecretsCount)
+}
+
+// secretEnv reads secret and returns environment variables it's exposed as.
+func (sched *Scheduler) secretEnv(ctx context.Context, job *model.Job, name string, s *model.JobSecret) (map[string]string, error) {
+	path, err := s.BackendPath(job.Group, job.Project)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := sched.readSecret(ctx, path, s.Version)
+	if err != nil {
+		return nil, fmt.Errorf("Reading secret failed: %s", err)
+	}
+	vars, err := s.Env(name, secret)
+	if err != nil {
+		return nil, fmt.Errorf("Reading secret %s failed: %s", path, err)
+	}
+	return vars, nil
+}
+
+// secretFile reads value of secret delivered as file.
+func (sched *Scheduler) secretFile(ctx context.Context, job *model.Job, f *model.JobSecretFile) (string, error) {
+	path, err := f.Secret.BackendPath(job.Group, job.Project)
+	if err != nil {
+		return "", err
+	}
+	secret, err := sched.readSecret(ctx, path, f.Secret.Version)
+	if err != nil {
+		return "", fmt.Errorf("Reading secret failed: %s", err)
+	}
+	value, err := f.Secret.Value(secret)
+	if err != nil {
+		return "", fmt.Errorf("Reading secret %s failed: %s", path, err)
+	}
+	return value, nil
+}
+
+func (sched *Scheduler) getSecretsKey() ([]byte, error) {
+	sched.secretsKeyMut.Lock()
+	defer sched.secretsKeyMut.Unlock()
+	if sched.secretsKey == nil {
+		key, err := sched.stor(sched.ctx).GetSecretsKey()
+		if err != nil {
+			return nil, err
+		}
+		sched.secretsKey = key
+	}
+	return sched.secretsKey, nil
+}
+
+// fingerprint returns HMAC of values so rotation can be detected without
+// storing anything which would allow to guess secrets. Empty string is
+// returned if key isn't available.
+func (sched *Scheduler) fingerprint(values map[string]string) string {
+	key, err := sched.getSecretsKey()
+	if err != nil {
+		logging.Sampled(log.NewEntry(log.StandardLogger()), "jobsscheduler.secretsKey").Errorf("Error getting secrets key: %s", err)
+		return ""
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mac := hmac.New(sha256.New, key)
+	for _, name := range names {
+		mac.Write([]byte(name))
+		mac.Write([]byte{0})
+		mac.Write([]byte(values[name]))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// currentFingerprint returns fingerprint of secret's current value. Secret
+// is identified the same way as in JobRuntime.SecretsFingerprints. False is
+// returned if job doesn't reference such secret anymore.
+func (sched *Scheduler) currentFingerprint(ctx context.Context, job *model.Job, name string) (string, bool, error) {
+	if strings.HasPrefix(name, secretsFingerprintPrefix) {
+		env := strings.TrimPrefix(name, secretsFingerprintPrefix)
+		s, ok := job.Secrets[env]
+		if !ok {
+			return "", false, nil
+		}
+		vars, err := sched.secretEnv(ctx, job, env, &s)
+		if err != nil {
+			return "", true, err
+		}
+		return sched.fingerprint(vars), true, nil
+	}
+	path := strings.TrimPrefix(name, secretFilesFingerprintPrefix)
+	for i := range job.SecretFiles {
+		f := &job.SecretFiles[i]
+		if f.Path != path {
+			continue
+		}
+		value, err := sched.secretFile(ctx, job, f)
+		if err != nil {
+			return "", true, err
+		}
+		return sched.fingerprint(map[string]string{f.Path: value}), true, nil
+	}
+	return "", false, nil
+}
+
+// staleSecrets returns sorted names of job's secrets whose fingerprints
+// differ from ones current task has been launched with.
+func (sched *Scheduler) staleSecrets(ctx context.Context, job *model.Job) []string {
+	var stale []string
+	for name, fp := range job.SecretsFingerprints {
+		if fp == "" {
+			continue
+		}
+		current, ok, err := sched.currentFingerprint(ctx, job, name)
+		if err != nil {
+			logging.Job(&job.JobID).Warnf("Error checking secret rotation: %s", err)
+			continue
+		}
+		if ok && current != "" && current != fp {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// CheckSecretsRotation compares secrets of running tasks with their current
+// values. Jobs whose secrets have been rotated are marked as launched with
+// stale secrets. Returned are jobs whose tasks should be restarted.
+func (sched *Scheduler) CheckSecretsRotation(ctx context.Context) []model.Job {
+	var running []model.Job
+	sched.jobsMut.Lock()
+	for _, job := range sched.jobs {
+		if job.CurrentTaskID != "" && len(job.SecretsFingerprints) > 0 {
+			running = append(running, *job)
+		}
+	}
+	sched.jobsMut.Unlock()
+	var restart []model.Job
+	for i := range running {
+		job := &running[i]
+		stale := sched.staleSecrets(ctx, job)
+		if len(stale) == 0 {
+			continue
+		}
+		sched.jobsMut.Lock()
+		current, ok := sched.jobs[job.FQID()]
+		// Skip if task has ended while secrets were checked.
+		if !ok || current.CurrentTaskID != job.CurrentTaskID {
+			sched.jobsMut.Unlock()
+			continue
+		}
+		changed := !reflect.DeepEqual(current.StaleSecrets, stale)
+		if changed {
+			if n := len(stale) - len(current.StaleSecrets); n > 0 {
+				rotatedSecretsCount.Add(float64(n))
+			}
+			current.StaleSecrets = stale
+		}
+		snapshot := *current
+		sched.jobsMut.Unlock()
+		logger := logging.Task(&job.JobID, job.CurrentTaskID, job.CurrentAgentID)
+		if changed {
+			logger.WithField("secrets", strings.Join(stale, ", ")).Warn("Task launched with stale secrets")
+			err := sched.stor(ctx).SaveJobRuntime(job.Group, job.Project, job.ID, &snapshot.JobRuntime)
+			if err != nil {
+				logger.Errorf("Error saving job runtime: %s", err)
+			}
+		}
+		if snapshot.RestartOnSecretsRotation {
+			restart = append(restart, snapshot)
+		}
+	}
+	return restart
+}
+
+// MarkRotationKill records (or clears if marked is false) that current task
+// of job is being killed after secrets rotation so job is queued once kill is
+// confirmed. False is returned if task has ended meanwhile.
+func (sched *Scheduler) MarkRotationKill(ctx context.Context, job *model.Job, marked bool) bool {
+	sched.jobsMut.Lock()
+	current, ok := sched.jobs[job.FQID()]
+	if !ok || current.CurrentTaskID == "" || current.CurrentTaskID != job.CurrentTaskID {
+		sched.jobsMut.Unlock()
+		return false
+	}
+	if marked {
+		current.RotationKillTaskID = current.CurrentTaskID
+	} else {
+		current.RotationKillTaskID = ""
+	}
+	snapshot := *current
+	sched.jobsMut.Unlock()
+	err := sched.stor(ctx).SaveJobRuntime(job.Group, job.Project, job.ID, &snapshot.JobRuntime)
+	if err != nil {
+		logging.Task(&job.JobID, job.CurrentTaskID, job.CurrentAgentID).Errorf("Error saving job runtime: %s", err)
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package jobsscheduler
+
+import (
+	"context"
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/api/v1/lib"
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/model"
+)
+
+// memStorage returns jobs and tasks set in test and keeps queued jobs in
+// memory. Other methods do nothing.
+type memStorage struct {
+	jobs   []*model.Job
+	tasks  []*model.Task
+	queued []string
+	// If set then GetTasks blocks until it's closed.
+	release chan struct{}
+}
+
+func (s *memStorage) GetJobs() ([]*model.Job, error) { return s.jobs, nil }
+func (s *memStorage) GetTasks(group, project, id string) ([]*model.Task, error) {
+	if s.release != nil {
+		<-s.release
+	}
+	return s.tasks, nil
+}
+func (s *memStorage) AddTask(group, project, id string, task *model.Task) error { return nil }
+func (s *memStorage) SaveJobRuntime(group, project, id string, state *model.JobRuntime) error {
+	return nil
+}
+func (s *memStorage) GetQueuedJobsIDs() ([]model.JobID, error) { return nil, nil }
+func (s *memStorage) GetQueuedJobTraceContext(group, project, id string) (map[string]string, error) {
+	return nil, nil
+}
+func (s *memStorage) DequeueJob(group, project, id string) error { return nil }
+func (s *memStorage) QueueJob(group, project, id string, traceContext map[string]string) error {
+	s.queued = append(s.queued, group+":"+project+":"+id)
+	return nil
+}
+func (s *memStorage) GetSecretsKey() ([]byte, error)                    { return nil, nil }
+func (s *memStorage) GetKillRequests() ([]model.JobID, error)           { return nil, nil }
+func (s *memStorage) DeleteKillRequest(group, project, id string) error { return nil }
+
+func testScheduler(stor storage, jobs ...*model.Job) *Scheduler {
+	sched := &Scheduler{
+		ctx:         context.Background(),
+		storage:     stor,
+		metrics:     &jobMetrics{conf: &conf.MetricsJobs{}},
+		frameworkID: func() string { return "" },
+		leaderURL:   func() string { return "" },
+		jobs:        make(map[string]*model.Job),
+		queuedJobs:  make(map[string]struct{}),
+	}
+	for _, job := range jobs {
+		sched.jobs[job.FQID()] = job
+	}
+	return sched
+}
+
+func TestOnlyRotationKillRestartsJob(t *testing.T) {
+	const tid = "a:b:c:uuid"
+	tests := []struct {
+		name    string
+		mark    bool
+		queued  bool
+		stale   []string
+		restart bool
+	}{
+		{"killed after rotation", true, true, []string{"secrets.FOO"}, true},
+		{"killed on request with stale secrets", false, false, []string{"secrets.FOO"}, true},
+		{"killed on request", false, false, nil, true},
+	}
+	for _, test := range tests {
+		job := &model.Job{
+			JobConf: model.JobConf{
+				JobID:                    model.JobID{Group: "a", Project: "b", ID: "c"},
+				RestartOnSecretsRotation: test.restart,
+			},
+			JobRuntime: model.JobRuntime{
+				State:         model.RUNNING,
+				CurrentTaskID: tid,
+				StaleSecrets:  test.stale,
+			},
+		}
+		stor := &memStorage{}
+		sched := testScheduler(stor, job)
+		if test.mark && !sched.MarkRotationKill(sched.ctx, job, true) {
+			t.Fatalf("%s: task not marked", test.name)
+		}
+		sched.HandleTaskStateUpdate(&mesos.TaskStatus{
+			TaskID: mesos.TaskID{Value: tid},
+			State:  mesos.TASK_KILLED.Enum(),
+		})
+		if queued := len(stor.queued) == 1; queued != test.queued {
+			t.Errorf("%s: got queued %v, want %v", test.name, queued, test.queued)
+		}
+		updated, _ := sched.getJob("a:b:c")
+		if updated.RotationKillTaskID != "" {
+			t.Errorf("%s: mark not cleared", test.name)
+		}
+	}
+}
+
+func TestMarkRotationKillSkipsEndedTask(t *testing.T) {
+	job := &model.Job{
+		JobConf:    model.JobConf{JobID: model.JobID{Group: "a", Project: "b", ID: "c"}},
+		JobRuntime: model.JobRuntime{CurrentTaskID: "a:b:c:old"},
+	}
+	sched := testScheduler(&memStorage{}, &model.Job{
+		JobConf:    job.JobConf,
+		JobRuntime: model.JobRuntime{CurrentTaskID: "a:b:c:new"},
+	})
+	if sched.MarkRotationKill(sched.ctx, job, true) {
+		t.Error("task which has ended got marked")
+	}
+}
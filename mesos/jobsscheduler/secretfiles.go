@@ -0,0 +1,96 @@
+package jobsscheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	mesos "github.com/mesos/mesos-go/api/v1/lib"
+	"github.com/mlowicki/rhythm/model"
+)
+
+// secretVolumes returns volumes delivering job's secret files into container.
+// Files are written by Mesos' volume/secret isolator. Returned chmods maps
+// file mode (e.g. "0400") to paths which must be changed before running
+// job's command. Fingerprints of secrets are added to fps.
+func (sched *Scheduler) secretVolumes(ctx context.Context, job *model.Job, fps map[string]string) ([]mesos.Volume, map[string][]string, error) {
+	var volumes []mesos.Volume
+	chmods := make(map[string][]string)
+	for i := range job.SecretFiles {
+		f := &job.SecretFiles[i]
+		value, err := sched.secretFile(ctx, job, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		fps[secretFilesFingerprintPrefix+f.Path] = sched.fingerprint(map[string]string{f.Path: value})
+		mode, err := f.FileMode()
+		if err != nil {
+			return nil, nil, err
+		}
+		volumeMode := mesos.RO
+		if f.Mode != "" {
+			// Mounted file must be writable to change its permissions.
+			volumeMode = mesos.RW
+			m := fmt.Sprintf("%04o", mode)
+			chmods[m] = append(chmods[m], f.Path)
+		}
+		volumes = append(volumes, mesos.Volume{
+			Mode:          volumeMode.Enum(),
+			ContainerPath: f.Path,
+			Source: &mesos.Volume_Source{
+				Type: mesos.Volume_Source_SECRET.Enum(),
+				Secret: &mesos.Secret{
+					Type:  mesos.Secret_VALUE,
+					Value: &mesos.Secret_Value{Data: []byte(value)},
+				},
+			},
+		})
+	}
+	return volumes, chmods, nil
+}
+
+// wrapCommand prepends chmod calls to command so secret files have requested
+// permissions before job's command starts. chmod is run as job's user so it
+// may fail (e.g. if file is owned by another user). Failure is reported on
+// stderr but doesn't prevent command from starting. Command which isn't run
+// by shell is executed via exec to preserve its arguments.
+func wrapCommand(cmd *mesos.CommandInfo, chmods map[string][]string) {
+	if len(chmods) == 0 {
+		return
+	}
+	modes := make([]string, 0, len(chmods))
+	for m := range chmods {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+	var parts []string
+	for _, m := range modes {
+		args := []string{"chmod", m}
+		for _, p := range chmods[m] {
+			args = append(args, shellQuote(p))
+		}
+		parts = append(parts, strings.Join(args, " ")+" || echo "+shellQuote("rhythm: changing mode of secret files failed")+" >&2")
+	}
+	if cmd.GetShell() {
+		parts = append(parts, cmd.GetValue())
+	} else {
+		// First argument is argv[0] of executable.
+		args := []string{"exec", shellQuote(cmd.GetValue())}
+		if len(cmd.Arguments) > 1 {
+			for _, a := range cmd.Arguments[1:] {
+				args = append(args, shellQuote(a))
+			}
+		}
+		parts = append(parts, strings.Join(args, " "))
+		cmd.Arguments = nil
+	}
+	shell := true
+	value := strings.Join(parts, "; ")
+	cmd.Shell = &shell
+	cmd.Value = &value
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,52 @@
+package jobsscheduler
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/api/v1/lib"
+)
+
+func TestWrapCommand(t *testing.T) {
+	const chmods = "chmod 0400 'a' 'it'\\''s' || echo 'rhythm: changing mode of secret files failed' >&2; " +
+		"chmod 0600 'b' || echo 'rhythm: changing mode of secret files failed' >&2; "
+	tests := []struct {
+		cmd  mesos.CommandInfo
+		want string
+	}{
+		{
+			cmd:  mesos.CommandInfo{Shell: proto.Bool(true), Value: proto.String("echo $HOME && false")},
+			want: chmods + "echo $HOME && false",
+		},
+		{
+			cmd:  mesos.CommandInfo{Shell: proto.Bool(false), Value: proto.String("/bin/echo"), Arguments: []string{"echo", "a b", "$HOME"}},
+			want: chmods + "exec '/bin/echo' 'a b' '$HOME'",
+		},
+	}
+	for _, test := range tests {
+		cmd := test.cmd
+		wrapCommand(&cmd, map[string][]string{"0400": {"a", "it's"}, "0600": {"b"}})
+		if !cmd.GetShell() {
+			t.Errorf("%s: command isn't run by shell", test.want)
+		}
+		if cmd.GetValue() != test.want {
+			t.Errorf("got %q, want %q", cmd.GetValue(), test.want)
+		}
+		if cmd.Arguments != nil {
+			t.Errorf("%s: arguments not cleared: %v", test.want, cmd.Arguments)
+		}
+	}
+}
+
+func TestWrapCommandRunsDespiteChmodFailure(t *testing.T) {
+	cmd := mesos.CommandInfo{Shell: proto.Bool(true), Value: proto.String("echo started")}
+	wrapCommand(&cmd, map[string][]string{"0400": {"/nonexistent/secret"}})
+	out, err := exec.Command("/bin/sh", "-c", cmd.GetValue()).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "started\n" {
+		t.Errorf("got %q, want command's output", out)
+	}
+}
@@ -0,0 +1,56 @@
+package jobsscheduler
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+
+	mesos "github.com/mesos/mesos-go/api/v1/lib"
+	"github.com/mlowicki/rhythm/model"
+)
+
+// Matches messages set by command and Docker executors
+// (e.g. "Command exited with status 127" or "Container exited with status 1").
+var exitStatusRegexp = regexp.MustCompile(`exited with status (-?\d+)`)
+
+// taskStatus maps terminal Mesos task state to task's status.
+func taskStatus(state mesos.TaskState) model.TaskStatus {
+	switch state {
+	case mesos.TASK_FINISHED:
+		return model.TaskSucceeded
+	case mesos.TASK_FAILED:
+		return model.TaskFailed
+	case mesos.TASK_KILLED:
+		return model.TaskKilled
+	case mesos.TASK_LOST:
+		return model.TaskLost
+	default:
+		return model.TaskError
+	}
+}
+
+// exitCode returns exit code of task's process or nil if it can't be determined.
+func exitCode(status *mesos.TaskStatus) *int {
+	if status.GetState() == mesos.TASK_FINISHED {
+		code := 0
+		return &code
+	}
+	if m := exitStatusRegexp.FindStringSubmatch(status.GetMessage()); m != nil {
+		code, err := strconv.Atoi(m[1])
+		if err == nil {
+			return &code
+		}
+	}
+	// Docker executor sets data to output of `docker inspect`.
+	var inspect []struct {
+		State *struct {
+			ExitCode int
+		}
+	}
+	err := json.Unmarshal(status.GetData(), &inspect)
+	if err == nil && len(inspect) == 1 && inspect[0].State != nil {
+		code := inspect[0].State.ExitCode
+		return &code
+	}
+	return nil
+}
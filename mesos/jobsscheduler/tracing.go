@@ -0,0 +1,96 @@
+package jobsscheduler
+
+import (
+	"context"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/tracing"
+)
+
+// tracedStorage records storage calls as children of span from ctx (if any).
+type tracedStorage struct {
+	ctx context.Context
+	s   storage
+}
+
+// stor returns storage recording calls as children of span from ctx.
+func (sched *Scheduler) stor(ctx context.Context) storage {
+	return &tracedStorage{ctx, sched.storage}
+}
+
+func (t *tracedStorage) GetJobs() ([]*model.Job, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetJobs")
+	jobs, err := t.s.GetJobs()
+	tracing.End(span, err)
+	return jobs, err
+}
+
+func (t *tracedStorage) GetTasks(group, project, id string) ([]*model.Task, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetTasks", tracing.WithJob(group, project, id))
+	tasks, err := t.s.GetTasks(group, project, id)
+	tracing.End(span, err)
+	return tasks, err
+}
+
+func (t *tracedStorage) AddTask(group, project, id string, task *model.Task) error {
+	_, span := tracing.Start(t.ctx, "storage.AddTask", tracing.WithJob(group, project, id))
+	err := t.s.AddTask(group, project, id, task)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) SaveJobRuntime(group, project, id string, state *model.JobRuntime) error {
+	_, span := tracing.Start(t.ctx, "storage.SaveJobRuntime", tracing.WithJob(group, project, id))
+	err := t.s.SaveJobRuntime(group, project, id, state)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) GetQueuedJobsIDs() ([]model.JobID, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetQueuedJobsIDs")
+	jids, err := t.s.GetQueuedJobsIDs()
+	tracing.End(span, err)
+	return jids, err
+}
+
+func (t *tracedStorage) GetQueuedJobTraceContext(group, project, id string) (map[string]string, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetQueuedJobTraceContext", tracing.WithJob(group, project, id))
+	traceCtx, err := t.s.GetQueuedJobTraceContext(group, project, id)
+	tracing.End(span, err)
+	return traceCtx, err
+}
+
+func (t *tracedStorage) DequeueJob(group, project, id string) error {
+	_, span := tracing.Start(t.ctx, "storage.DequeueJob", tracing.WithJob(group, project, id))
+	err := t.s.DequeueJob(group, project, id)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) QueueJob(group, project, id string, traceContext map[string]string) error {
+	_, span := tracing.Start(t.ctx, "storage.QueueJob", tracing.WithJob(group, project, id))
+	err := t.s.QueueJob(group, project, id, traceContext)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) GetSecretsKey() ([]byte, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetSecretsKey")
+	key, err := t.s.GetSecretsKey()
+	tracing.End(span, err)
+	return key, err
+}
+
+func (t *tracedStorage) GetKillRequests() ([]model.JobID, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetKillRequests")
+	jids, err := t.s.GetKillRequests()
+	tracing.End(span, err)
+	return jids, err
+}
+
+func (t *tracedStorage) DeleteKillRequest(group, project, id string) error {
+	_, span := tracing.Start(t.ctx, "storage.DeleteKillRequest", tracing.WithJob(group, project, id))
+	err := t.s.DeleteKillRequest(group, project, id)
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,33 @@
+package mesos
+
+import (
+	"context"
+	"time"
+
+	"github.com/mesos/mesos-go/api/v1/lib/scheduler/calls"
+	"github.com/mlowicki/rhythm/logging"
+	"github.com/mlowicki/rhythm/mesos/jobsscheduler"
+)
+
+// How often kill requests (e.g. sent through API) are checked.
+const killRequestsCheckInterval = 5 * time.Second
+
+// watchKillRequests periodically kills tasks of jobs requested to be killed.
+func watchKillRequests(ctx context.Context, cli calls.Caller, sched *jobsscheduler.Scheduler) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(killRequestsCheckInterval):
+		}
+		for _, job := range sched.KillRequests() {
+			logger := logging.Task(&job.JobID, job.CurrentTaskID, job.CurrentAgentID)
+			err := calls.CallNoData(ctx, cli, calls.Kill(job.CurrentTaskID, job.CurrentAgentID))
+			if err != nil {
+				logger.Errorf("Error killing task: %s", err)
+				continue
+			}
+			logger.Info("Task killed on request")
+		}
+	}
+}
@@ -12,7 +12,7 @@ import (
 const frameworkName = "rhythm"
 
 type secrets interface {
-	Read(string) (string, error)
+	Read(path string, version int) (map[string]string, error)
 }
 
 type storage interface {
@@ -21,13 +21,19 @@ type storage interface {
 	SetFrameworkID(id string) error
 	GetFrameworkID() (string, error)
 	SaveJob(j *model.Job) error
+	GetTasks(group, project, id string) ([]*model.Task, error)
 	AddTask(group, project, id string, task *model.Task) error
 	GetJobRuntime(group, project, id string) (*model.JobRuntime, error)
 	SaveJobRuntime(group, project, id string, state *model.JobRuntime) error
 	GetJobConf(group, project, id string) (*model.JobConf, error)
 	SaveJobConf(state *model.JobConf) error
 	GetQueuedJobsIDs() ([]model.JobID, error)
+	GetQueuedJobTraceContext(group, project, id string) (map[string]string, error)
 	DequeueJob(group, project, id string) error
+	QueueJob(group, project, id string, traceContext map[string]string) error
+	GetSecretsKey() ([]byte, error)
+	GetKillRequests() ([]model.JobID, error)
+	DeleteKillRequest(group, project, id string) error
 }
 
 func newFrameworkInfo(conf *conf.Mesos, idStore store.Singleton) *mesos.FrameworkInfo {
@@ -12,6 +12,7 @@ import (
 	"github.com/mesos/mesos-go/api/v1/lib/backoff"
 	"github.com/mesos/mesos-go/api/v1/lib/scheduler/calls"
 	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
@@ -72,17 +73,21 @@ func findMinDeadline(jobs []*model.Job) time.Duration {
 
 // Tuner controls offers flow by REVIVE and SUPPRESS calls.
 type Tuner struct {
-	ctx  context.Context
-	cli  calls.Caller
-	stor storage
+	ctx     context.Context
+	cli     calls.Caller
+	stor    storage
+	onRound func()
 }
 
-func (t *Tuner) round(reviveTokens <-chan struct{}, suppressed bool) (bool, error) {
-	jobs, err := t.stor.GetJobs()
+func (t *Tuner) round(reviveTokens <-chan struct{}, suppressed bool) (_ bool, err error) {
+	ctx, span := tracing.Start(t.ctx, "offerstuner.round")
+	defer func() { tracing.End(span, err) }()
+	stor := &tracedStorage{ctx, t.stor}
+	jobs, err := stor.GetJobs()
 	if err != nil {
 		return suppressed, err
 	}
-	queuedJobs, err := t.stor.GetQueuedJobsIDs()
+	queuedJobs, err := stor.GetQueuedJobsIDs()
 	if err != nil {
 		return suppressed, err
 	}
@@ -94,8 +99,11 @@ func (t *Tuner) round(reviveTokens <-chan struct{}, suppressed bool) (bool, erro
 		maxDelay = findMaxDelay(jobs)
 	}
 	minDeadline := findMinDeadline(jobs)
-	log.Debugf("Max delay: %s", maxDelay)
-	log.Debugf("Min deadline: %s", minDeadline)
+	log.WithFields(log.Fields{
+		"max_delay":    maxDelay,
+		"min_deadline": minDeadline,
+		"queued_jobs":  len(queuedJobs),
+	}).Debug("Round")
 	if (maxDelay >= minDelayToRevive) || (suppressed && maxDelay > 0) {
 		select {
 		case <-reviveTokens:
@@ -148,6 +156,8 @@ func (t *Tuner) Run() {
 				suppressed, err = t.round(reviveTokens, suppressed)
 				if err != nil {
 					log.Error(err)
+				} else {
+					t.onRound()
 				}
 				roundsCount.Inc()
 			}
@@ -156,11 +166,12 @@ func (t *Tuner) Run() {
 }
 
 // New returns fresh offers tuner instance.
-func New(ctx context.Context, cli calls.Caller, stor storage) *Tuner {
+func New(ctx context.Context, cli calls.Caller, stor storage, onRound func()) *Tuner {
 	tuner := Tuner{
-		ctx:  ctx,
-		cli:  cli,
-		stor: stor,
+		ctx:     ctx,
+		cli:     cli,
+		stor:    stor,
+		onRound: onRound,
 	}
 	return &tuner
 }
@@ -0,0 +1,28 @@
+package offerstuner
+
+import (
+	"context"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/tracing"
+)
+
+// tracedStorage records storage calls as children of round's span.
+type tracedStorage struct {
+	ctx context.Context
+	s   storage
+}
+
+func (t *tracedStorage) GetJobs() ([]*model.Job, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetJobs")
+	jobs, err := t.s.GetJobs()
+	tracing.End(span, err)
+	return jobs, err
+}
+
+func (t *tracedStorage) GetQueuedJobsIDs() ([]model.JobID, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetQueuedJobsIDs")
+	jids, err := t.s.GetQueuedJobsIDs()
+	tracing.End(span, err)
+	return jids, err
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/cenkalti/backoff"
 	"github.com/mesos/mesos-go/api/v1/lib"
 	"github.com/mesos/mesos-go/api/v1/lib/scheduler/calls"
+	"github.com/mlowicki/rhythm/logging"
 	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/tracing"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -28,6 +30,7 @@ type Reconciliation struct {
 	updatesCh chan string
 	running   bool
 	mut       sync.Mutex
+	onRound   func()
 }
 
 type storage interface {
@@ -39,14 +42,22 @@ func (rec *Reconciliation) HandleTaskStateUpdate(status *mesos.TaskStatus) {
 	if status.GetReason() != mesos.REASON_RECONCILIATION {
 		return
 	}
+	log.WithFields(log.Fields{
+		logging.FieldTaskID:  status.TaskID.Value,
+		logging.FieldAgentID: status.GetAgentID().GetValue(),
+		"state":              status.GetState(),
+	}).Debug("Task reconciled")
 	select {
 	case rec.updatesCh <- status.TaskID.Value:
 	default:
 	}
 }
 
-func (rec *Reconciliation) round() error {
-	jobs, err := rec.storage.GetJobs()
+func (rec *Reconciliation) round() (err error) {
+	ctx, span := tracing.Start(rec.ctx, "reconciliation.round")
+	defer func() { tracing.End(span, err) }()
+	stor := &tracedStorage{ctx, rec.storage}
+	jobs, err := stor.GetJobs()
 	if err != nil {
 		return err
 	}
@@ -63,6 +74,7 @@ func (rec *Reconciliation) round() error {
 	<-ticker.C // Ticker is guaranteed to tick at least once.
 	defer ticker.Stop()
 	for len(tasks) > 0 {
+		log.WithField("tasks", len(tasks)).Debug("Reconciling tasks")
 		_, err := rec.cli.Call(rec.ctx, calls.Reconcile(calls.ReconcileTasks(tasks)))
 		if err != nil {
 			return err
@@ -115,6 +127,7 @@ func (rec *Reconciliation) Run() {
 						timer = time.After(roundRetry)
 					} else {
 						log.Debug("Round finished")
+						rec.onRound()
 						timer = time.After(roundInterval)
 					}
 				}
@@ -127,13 +140,14 @@ func (rec *Reconciliation) Run() {
 }
 
 // New returns fresh instance of reconciler.
-func New(ctx context.Context, cli calls.Caller, stor storage) *Reconciliation {
+func New(ctx context.Context, cli calls.Caller, stor storage, onRound func()) *Reconciliation {
 	rec := &Reconciliation{
 		ctx:       ctx,
 		cli:       cli,
 		roundQ:    make(chan struct{}, 1),
 		storage:   stor,
 		updatesCh: make(chan string),
+		onRound:   onRound,
 	}
 	return rec
 }
@@ -0,0 +1,21 @@
+package reconciliation
+
+import (
+	"context"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/tracing"
+)
+
+// tracedStorage records storage calls as children of round's span.
+type tracedStorage struct {
+	ctx context.Context
+	s   storage
+}
+
+func (t *tracedStorage) GetJobs() ([]*model.Job, error) {
+	_, span := tracing.Start(t.ctx, "storage.GetJobs")
+	jobs, err := t.s.GetJobs()
+	tracing.End(span, err)
+	return jobs, err
+}
@@ -0,0 +1,38 @@
+package mesos
+
+import (
+	"context"
+	"time"
+
+	"github.com/mesos/mesos-go/api/v1/lib/scheduler/calls"
+	"github.com/mlowicki/rhythm/logging"
+	"github.com/mlowicki/rhythm/mesos/jobsscheduler"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchSecretsRotation periodically checks if secrets of running tasks have
+// been rotated. Tasks of jobs configured to restart on rotation are killed.
+// Jobs are queued for immediate run by scheduler once kill is confirmed.
+func watchSecretsRotation(ctx context.Context, cli calls.Caller, sched *jobsscheduler.Scheduler, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		log.Debug("Checking secrets rotation")
+		for _, job := range sched.CheckSecretsRotation(ctx) {
+			logger := logging.Task(&job.JobID, job.CurrentTaskID, job.CurrentAgentID)
+			if !sched.MarkRotationKill(ctx, &job, true) {
+				continue
+			}
+			err := calls.CallNoData(ctx, cli, calls.Kill(job.CurrentTaskID, job.CurrentAgentID))
+			if err != nil {
+				logger.Errorf("Error killing task after secrets rotation: %s", err)
+				sched.MarkRotationKill(ctx, &job, false)
+				continue
+			}
+			logger.Info("Task killed after secrets rotation")
+		}
+	}
+}
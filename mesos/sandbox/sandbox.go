@@ -0,0 +1,109 @@
+package sandbox
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/mlowicki/rhythm/conf"
+	tlsutils "github.com/mlowicki/rhythm/tls"
+)
+
+// Client reads files from executors' sandboxes using Mesos agent files API.
+// http://mesos.apache.org/documentation/latest/endpoints/files/read/
+type Client struct {
+	client  *http.Client
+	auth    *conf.MesosAuth
+	maxSize int
+}
+
+type readResponse struct {
+	Data   string `json:"data"`
+	Offset int    `json:"offset"`
+}
+
+// New creates fresh instance of sandbox client.
+func New(c *conf.Mesos) (*Client, error) {
+	if c.Auth.Type != conf.MesosAuthTypeBasic && c.Auth.Type != conf.MesosAuthTypeNone {
+		return nil, fmt.Errorf("Unknown authentication type: %s", c.Auth.Type)
+	}
+	tc := &tls.Config{}
+	if c.CACert != "" {
+		pool, err := tlsutils.BuildCertPool(c.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = pool
+	}
+	return &Client{
+		client: &http.Client{
+			Timeout:   c.TaskLogs.Timeout,
+			Transport: &http.Transport{TLSClientConfig: tc},
+		},
+		auth:    &c.Auth,
+		maxSize: c.TaskLogs.MaxSize,
+	}, nil
+}
+
+// Tail returns at most maxSize last bytes of file from executor's sandbox
+// (e.g. "stdout" or "stderr"). agentURL is agent's address with scheme.
+func (c *Client) Tail(agentURL, frameworkID, executorID, name string) (string, error) {
+	path := fmt.Sprintf("/frameworks/%s/executors/%s/runs/latest/%s", frameworkID, executorID, name)
+	// Negative offset returns file's length without any data.
+	res, err := c.read(agentURL, path, -1, 0)
+	if err != nil {
+		return "", err
+	}
+	offset := res.Offset - c.maxSize
+	if offset < 0 {
+		offset = 0
+	}
+	res, err = c.read(agentURL, path, offset, c.maxSize)
+	if err != nil {
+		return "", err
+	}
+	return res.Data, nil
+}
+
+func (c *Client) read(agentURL, path string, offset, length int) (*readResponse, error) {
+	u, err := url.Parse(agentURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/files/read"
+	q := url.Values{}
+	q.Set("path", path)
+	q.Set("offset", fmt.Sprintf("%d", offset))
+	if length > 0 {
+		q.Set("length", fmt.Sprintf("%d", length))
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.auth.Type == conf.MesosAuthTypeBasic {
+		req.SetBasicAuth(c.auth.Basic.Username, c.auth.Basic.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Reading %s failed: %s", path, resp.Status)
+	}
+	var res readResponse
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,131 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/conf"
+)
+
+const (
+	testFrameworkID = "framework"
+	testExecutorID  = "group:project:id:uuid"
+)
+
+// fakeAgent serves files API of Mesos agent for sandbox of single executor.
+func fakeAgent(t *testing.T, files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/files/read" {
+			http.NotFound(w, r)
+			return
+		}
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "rhythm" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		prefix := "/frameworks/" + testFrameworkID + "/executors/" + testExecutorID + "/runs/latest/"
+		path := q.Get("path")
+		if len(path) < len(prefix) || path[:len(prefix)] != prefix {
+			http.NotFound(w, r)
+			return
+		}
+		data, ok := files[path[len(prefix):]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		offset, err := strconv.Atoi(q.Get("offset"))
+		if err != nil {
+			t.Errorf("invalid offset: %s", q.Get("offset"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		res := readResponse{Offset: offset}
+		if offset < 0 {
+			// Negative offset returns file's length.
+			res.Offset = len(data)
+		} else {
+			end := len(data)
+			if l := q.Get("length"); l != "" {
+				length, err := strconv.Atoi(l)
+				if err != nil {
+					t.Errorf("invalid length: %s", l)
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if offset+length < end {
+					end = offset + length
+				}
+			}
+			if offset < end {
+				res.Data = data[offset:end]
+			}
+		}
+		json.NewEncoder(w).Encode(&res)
+	}))
+}
+
+func newClient(t *testing.T, maxSize int) *Client {
+	c, err := New(&conf.Mesos{
+		Auth: conf.MesosAuth{
+			Type:  conf.MesosAuthTypeBasic,
+			Basic: conf.MesosAuthBasic{Username: "rhythm", Password: "secret"},
+		},
+		TaskLogs: conf.MesosTaskLogs{MaxSize: maxSize, Timeout: time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestTail(t *testing.T) {
+	agent := fakeAgent(t, map[string]string{
+		"stdout": "0123456789",
+		"stderr": "err",
+		"empty":  "",
+	})
+	defer agent.Close()
+	c := newClient(t, 4)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"stdout", "6789"},
+		{"stderr", "err"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		got, err := c.Tail(agent.URL, testFrameworkID, testExecutorID, tt.name)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTailErrors(t *testing.T) {
+	agent := fakeAgent(t, map[string]string{"stdout": "out"})
+	defer agent.Close()
+	c := newClient(t, 4)
+	if _, err := c.Tail(agent.URL, testFrameworkID, testExecutorID, "missing"); err == nil {
+		t.Error("expected error for missing file")
+	}
+	c.auth.Basic.Password = "wrong"
+	if _, err := c.Tail(agent.URL, testFrameworkID, testExecutorID, "stdout"); err == nil {
+		t.Error("expected error for invalid credentials")
+	}
+	agent.Close()
+	c.auth.Basic.Password = "secret"
+	if _, err := c.Tail(agent.URL, testFrameworkID, testExecutorID, "stdout"); err == nil {
+		t.Error("expected error for unreachable agent")
+	}
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts every API token so it can be told apart from other
+// credentials (e.g. JWT) sent in "Authorization: Bearer" header.
+const APITokenPrefix = "rht_"
+
+// APIToken describes token issued by Rhythm (e.g. for CI pipelines). Token
+// itself is shown only once, when created. Only its hash is stored.
+type APIToken struct {
+	ID          string
+	Description string `json:",omitempty"`
+	// Scope is either "group/project", "group" or "*" (all projects).
+	Scope string
+	// Access is either "readonly" or "readwrite".
+	Access  string
+	Created time.Time
+	// Expires is zero if token never expires.
+	Expires time.Time
+	Hash    string `json:",omitempty"`
+}
+
+// Expired tells if token has expired at given time.
+func (t *APIToken) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// Covers tells if project belongs to token's scope.
+func (t *APIToken) Covers(group, project string) bool {
+	return t.Scope == "*" || t.Scope == group || t.Scope == group+"/"+project
+}
+
+// Verify checks if secret matches token's hash.
+func (t *APIToken) Verify(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(secret)), []byte(t.Hash)) == 1
+}
+
+// NewAPIToken generates fresh token. Returned is token with ID and Hash set
+// and its value to be passed to client.
+func NewAPIToken() (*APIToken, string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	t := APIToken{
+		ID:   hex.EncodeToString(id),
+		Hash: hashAPITokenSecret(hex.EncodeToString(secret)),
+	}
+	return &t, APITokenPrefix + t.ID + "_" + hex.EncodeToString(secret), nil
+}
+
+// ValidAPITokenID tells if id has format of IDs generated by NewAPIToken.
+func ValidAPITokenID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 16
+}
+
+// ParseAPIToken splits token's value into ID and secret. False is returned
+// if value isn't API token.
+func ParseAPIToken(value string) (id string, secret string, ok bool) {
+	if !strings.HasPrefix(value, APITokenPrefix) {
+		return "", "", false
+	}
+	chunks := strings.Split(strings.TrimPrefix(value, APITokenPrefix), "_")
+	if len(chunks) != 2 || chunks[0] == "" || chunks[1] == "" {
+		return "", "", false
+	}
+	return chunks[0], chunks[1], true
+}
+
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -82,19 +82,35 @@ const (
 // JobConf defines job's configuration fields.
 type JobConf struct {
 	JobID
-	Schedule   JobSchedule
-	Env        map[string]string
-	Secrets    map[string]string
-	Container  JobContainer
-	CPUs       float64
-	Mem        float64
-	Disk       float64
-	Cmd        string
-	User       string
-	Shell      bool
-	Arguments  []string
-	Labels     map[string]string
-	MaxRetries int
+	Schedule      JobSchedule
+	Env           map[string]string
+	Secrets       map[string]JobSecret
+	SecretFiles   []JobSecretFile `json:",omitempty"`
+	Container     JobContainer
+	CPUs          float64
+	Mem           float64
+	Disk          float64
+	Cmd           string
+	User          string
+	Shell         bool
+	Arguments     []string
+	Labels        map[string]string
+	MaxRetries    int
+	TaskRetention TaskRetention
+	// Kill running task (and queue job for immediate run) when any of its
+	// secrets is rotated.
+	RestartOnSecretsRotation bool `json:",omitempty"`
+}
+
+// TaskRetention defines how many and how long job's tasks are kept.
+// Zero values mean that global settings are used.
+type TaskRetention struct {
+	// Minimum number of the most recent tasks kept regardless of their age.
+	MinCount int
+	// Maximum number of kept tasks.
+	MaxCount int
+	// Maximum age of task in seconds.
+	MaxAge int
 }
 
 // FQID returns globablly unique identifier (acrsoss all groups and projects).
@@ -123,7 +139,18 @@ type JobRuntime struct {
 	LastStart      time.Time
 	CurrentTaskID  string
 	CurrentAgentID string
-	Retries        int
+	// Hostname and address (with scheme) of agent current task has been
+	// launched on. Kept in storage so they're available after failover.
+	CurrentAgentHostname string `json:",omitempty"`
+	CurrentAgentURL      string `json:",omitempty"`
+	Retries              int
+	// Fingerprints of secrets current task has been launched with.
+	SecretsFingerprints map[string]string `json:",omitempty"`
+	// Secrets rotated since current task has been launched.
+	StaleSecrets []string `json:",omitempty"`
+	// ID of current task killed by scheduler after secrets rotation. Only
+	// such kills queue job again (kills requested e.g. through API don't).
+	RotationKillTaskID string `json:",omitempty"`
 }
 
 // Job encompasses fields for job's configuration and runtime.
@@ -157,19 +184,55 @@ func (job *Job) IsRunnable() bool {
 	return (job.State == IDLE || job.State == FAILED) && job.NextRun().Before(time.Now())
 }
 
+// TaskStatus defines how task has ended.
+type TaskStatus string
+
+const (
+	// TaskSucceeded denotes task which finished successfully.
+	TaskSucceeded TaskStatus = "Succeeded"
+	// TaskFailed denotes task which finished with non-zero exit code.
+	TaskFailed = "Failed"
+	// TaskKilled denotes task which has been killed.
+	TaskKilled = "Killed"
+	// TaskLost denotes task which state can't be determined by Mesos.
+	TaskLost = "Lost"
+	// TaskError denotes task which couldn't be launched.
+	TaskError = "Error"
+)
+
+func (s TaskStatus) String() string {
+	return string(s)
+}
+
 // Task is a single run (failed or successful) of job.
 type Task struct {
-	Start       time.Time
-	End         time.Time
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Status   TaskStatus
+	// Not set if exit code is unknown (e.g. task hasn't been launched).
+	ExitCode    *int `json:",omitempty"`
 	TaskID      string
 	ExecutorID  string
 	AgentID     string
+	Hostname    string
 	FrameworkID string
 	ExecutorURL string
 	// Set for failed task
 	Message string
 	Reason  string
 	Source  string
+	Logs    *TaskLogs `json:",omitempty"`
+	// Fingerprints of secrets task has been launched with.
+	SecretsFingerprints map[string]string `json:",omitempty"`
+	// Secrets rotated while task was running.
+	StaleSecrets []string `json:",omitempty"`
+}
+
+// TaskLogs holds tails of task's output streams.
+type TaskLogs struct {
+	Stdout string
+	Stderr string
 }
 
 // JobID defines job identifier.
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultSecretKey is a key read from secret if reference doesn't specify one.
+const DefaultSecretKey = "value"
+
+// JobSecret references secret exposed to job as environment variable(s).
+//
+// It's encoded in JSON either as string ("path" or "path#key") or as object
+// which allows to pin secret's version or to expand all its keys.
+type JobSecret struct {
+	// Path relative to job's project.
+	Path string
+	// Key read from secret. DefaultSecretKey is used if empty.
+	Key string `json:",omitempty"`
+	// Version of secret (supported only by versioned backends like Vault's
+	// KV v2). The latest version is used if zero.
+	Version int `json:",omitempty"`
+	// Expand exposes all keys of secret as separate environment variables
+	// named <NAME>_<KEY>.
+	Expand bool `json:",omitempty"`
+}
+
+// ParseJobSecret parses secret reference in form "path" or "path#key".
+func ParseJobSecret(ref string) JobSecret {
+	s := JobSecret{Path: ref}
+	if i := strings.LastIndex(ref, "#"); i != -1 {
+		s.Path = ref[:i]
+		s.Key = ref[i+1:]
+	}
+	return s
+}
+
+func (s JobSecret) String() string {
+	ref := s.Path
+	if s.Key != "" {
+		ref += "#" + s.Key
+	}
+	if s.Version != 0 {
+		ref += fmt.Sprintf(" (version %d)", s.Version)
+	}
+	if s.Expand {
+		ref += " (all keys)"
+	}
+	return ref
+}
+
+// MarshalJSON encodes secret as string if possible to stay compatible with
+// clients expecting plain paths.
+func (s JobSecret) MarshalJSON() ([]byte, error) {
+	if s.Version == 0 && !s.Expand {
+		ref := s.Path
+		if s.Key != "" {
+			ref += "#" + s.Key
+		}
+		return json.Marshal(ref)
+	}
+	type plain JobSecret
+	return json.Marshal(plain(s))
+}
+
+// UnmarshalJSON decodes secret from either string or object.
+func (s *JobSecret) UnmarshalJSON(data []byte) error {
+	var ref string
+	if err := json.Unmarshal(data, &ref); err == nil {
+		*s = ParseJobSecret(ref)
+		return nil
+	}
+	type plain JobSecret
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// BackendPath returns path passed to secrets backend. Prefix selecting
+// backend (e.g. "file:") is moved in front of job's group and project.
+// Paths with empty, "." or ".." segments are rejected so secret can't be read
+// from outside of job's project.
+func (s *JobSecret) BackendPath(group, project string) (string, error) {
+	backend, path := SplitSecretBackend(s.Path)
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("Invalid secret path: %s", s.Path)
+		}
+	}
+	path = fmt.Sprintf("%s/%s/%s", group, project, path)
+	if backend != "" {
+		return backend + ":" + path, nil
+	}
+	return path, nil
+}
+
+// SecretBackends are names of secrets backends which can prefix secret's path
+// (e.g. "file:db"). Must be kept in sync with backends supported by secrets
+// package.
+var SecretBackends = []string{"vault", "file", "http", "none"}
+
+// SplitSecretBackend splits path in form "backend:path" into backend's name
+// and the rest. Backend's name is empty if path doesn't start with name of
+// any of SecretBackends so paths like "db:password" are left intact.
+func SplitSecretBackend(path string) (string, string) {
+	i := strings.Index(path, ":")
+	if i <= 0 {
+		return "", path
+	}
+	for _, name := range SecretBackends {
+		if path[:i] == name {
+			return name, path[i+1:]
+		}
+	}
+	return "", path
+}
+
+// Env returns environment variables for secret exposed under name.
+// Values are key-value pairs read from secrets backend.
+func (s *JobSecret) Env(name string, values map[string]string) (map[string]string, error) {
+	if s.Expand {
+		env := make(map[string]string, len(values))
+		for k, v := range values {
+			env[name+"_"+envName(k)] = v
+		}
+		return env, nil
+	}
+	value, err := s.Value(values)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{name: value}, nil
+}
+
+// Value returns value of referenced key out of key-value pairs read from
+// secrets backend.
+func (s *JobSecret) Value(values map[string]string) (string, error) {
+	key := s.Key
+	if key == "" {
+		key = DefaultSecretKey
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("Secret's key not found: %s", key)
+	}
+	return value, nil
+}
+
+// envName converts secret's key into valid environment variable name.
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, key)
+}
+
+// JobSecretFile defines secret delivered to job as file.
+type JobSecretFile struct {
+	// Path of file inside container. Relative paths are relative to task's
+	// sandbox.
+	Path string
+	// Secret stored in file (expanding all keys isn't supported).
+	Secret JobSecret
+	// Octal file permissions (e.g. "0400"). Left as set by Mesos if empty.
+	Mode string `json:",omitempty"`
+}
+
+// FileMode returns parsed file permissions. Zero is returned if mode isn't
+// set.
+func (f *JobSecretFile) FileMode() (os.FileMode, error) {
+	if f.Mode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("Invalid file mode: %s", f.Mode)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,57 @@
+package model
+
+import "testing"
+
+func TestSplitSecretBackend(t *testing.T) {
+	tests := []struct {
+		path        string
+		wantBackend string
+		wantPath    string
+	}{
+		{"db", "", "db"},
+		{"file:db", "file", "db"},
+		{"http:db/password", "http", "db/password"},
+		{"vault:db", "vault", "db"},
+		{"none:db", "none", "db"},
+		{"db:password", "", "db:password"},
+		{"chain:db", "", "chain:db"},
+		{"File:db", "", "File:db"},
+		{":db", "", ":db"},
+		{"file:", "file", ""},
+	}
+	for _, tt := range tests {
+		backend, path := SplitSecretBackend(tt.path)
+		if backend != tt.wantBackend || path != tt.wantPath {
+			t.Errorf("SplitSecretBackend(%q) = %q, %q, want %q, %q", tt.path, backend, path, tt.wantBackend, tt.wantPath)
+		}
+	}
+}
+
+func TestBackendPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"db", "g/p/db", false},
+		{"db/password", "g/p/db/password", false},
+		{"file:db", "file:g/p/db", false},
+		{"db:password", "g/p/db:password", false},
+		{"a..b", "g/p/a..b", false},
+		{"../../other/project/db", "", true},
+		{"file:../other/db", "", true},
+		{"db/..", "", true},
+		{"./db", "", true},
+		{"/db", "", true},
+		{"db//password", "", true},
+		{"db/", "", true},
+		{"file:", "", true},
+	}
+	for _, tt := range tests {
+		s := JobSecret{Path: tt.path}
+		got, err := s.BackendPath("g", "p")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("BackendPath(%q) = %q, %v, want %q (error: %v)", tt.path, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
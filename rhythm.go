@@ -50,15 +50,45 @@ func main() {
 		"run-job": func() (cli.Command, error) {
 			return &command.RunJobCommand{BaseCommand: &baseCmd}, nil
 		},
+		"kill-job": func() (cli.Command, error) {
+			return &command.KillJobCommand{BaseCommand: &baseCmd}, nil
+		},
 		"find-jobs": func() (cli.Command, error) {
 			return &command.FindJobsCommand{BaseCommand: &baseCmd}, nil
 		},
 		"read-tasks": func() (cli.Command, error) {
 			return &command.ReadTasksCommand{BaseCommand: &baseCmd}, nil
 		},
+		"read-logs": func() (cli.Command, error) {
+			return &command.ReadLogsCommand{BaseCommand: &baseCmd}, nil
+		},
 		"update-token": func() (cli.Command, error) {
 			return &command.UpdateTokenCommand{BaseCommand: &baseCmd}, nil
 		},
+		"token create": func() (cli.Command, error) {
+			return &command.CreateTokenCommand{BaseCommand: &baseCmd}, nil
+		},
+		"token list": func() (cli.Command, error) {
+			return &command.ListTokensCommand{BaseCommand: &baseCmd}, nil
+		},
+		"token revoke": func() (cli.Command, error) {
+			return &command.RevokeTokenCommand{BaseCommand: &baseCmd}, nil
+		},
+		"validate-config": func() (cli.Command, error) {
+			return &command.ValidateConfigCommand{BaseCommand: &baseCmd}, nil
+		},
+		"migrate": func() (cli.Command, error) {
+			return &command.MigrateCommand{BaseCommand: &baseCmd}, nil
+		},
+		"backup": func() (cli.Command, error) {
+			return &command.BackupCommand{BaseCommand: &baseCmd}, nil
+		},
+		"restore": func() (cli.Command, error) {
+			return &command.RestoreCommand{BaseCommand: &baseCmd}, nil
+		},
+		"copy": func() (cli.Command, error) {
+			return &command.CopyCommand{BaseCommand: &baseCmd}, nil
+		},
 		"client": func() (cli.Command, error) {
 			return &command.ClientCommand{BaseCommand: &baseCmd, Version: version}, nil
 		},
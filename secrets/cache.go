@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mlowicki/rhythm/health"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "secrets_cache_requests",
+	Help: "Number of secrets reads served by cache (hit) or by backend (miss).",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(cacheRequests)
+}
+
+type cacheKey struct {
+	path    string
+	version int
+}
+
+type cacheEntry struct {
+	values  map[string]string
+	expires time.Time
+}
+
+// cache keeps successfully read secrets for ttl so backend isn't queried on
+// every launch of frequently run jobs. Failures aren't cached.
+type cache struct {
+	backend   secrets
+	ttl       time.Duration
+	mut       sync.Mutex
+	entries   map[cacheKey]*cacheEntry
+	lastSweep time.Time
+}
+
+func newCache(backend secrets, ttl time.Duration) *cache {
+	return &cache{
+		backend:   backend,
+		ttl:       ttl,
+		entries:   make(map[cacheKey]*cacheEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (c *cache) Read(path string, version int) (map[string]string, error) {
+	key := cacheKey{path, version}
+	now := time.Now()
+	c.mut.Lock()
+	entry, ok := c.entries[key]
+	c.mut.Unlock()
+	if ok && now.Before(entry.expires) {
+		cacheRequests.WithLabelValues("hit").Inc()
+		return copyValues(entry.values), nil
+	}
+	cacheRequests.WithLabelValues("miss").Inc()
+	values, err := c.backend.Read(path, version)
+	if err != nil {
+		return nil, err
+	}
+	c.mut.Lock()
+	c.entries[key] = &cacheEntry{values: copyValues(values), expires: now.Add(c.ttl)}
+	if now.Sub(c.lastSweep) > c.ttl {
+		c.sweep(now)
+	}
+	c.mut.Unlock()
+	return values, nil
+}
+
+// sweep removes expired entries. Must be called with mutex held.
+func (c *cache) sweep(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.lastSweep = now
+}
+
+// Check returns state of cached backend.
+func (c *cache) Check() health.Check {
+	check := c.backend.Check()
+	c.mut.Lock()
+	size := len(c.entries)
+	c.mut.Unlock()
+	if check.Details == nil {
+		check.Details = make(map[string]string)
+	}
+	check.Details["CachedSecrets"] = fmt.Sprintf("%d", size)
+	return check
+}
+
+func (c *cache) Run() {
+	run(c.backend)
+}
+
+func (c *cache) Close() {
+	closeBackend(c.backend)
+}
+
+func copyValues(values map[string]string) map[string]string {
+	m := make(map[string]string, len(values))
+	for k, v := range values {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mlowicki/rhythm/health"
+	"github.com/mlowicki/rhythm/model"
+)
+
+// chain selects backend by prefix of secret's path (e.g. "file:db"). Paths
+// without prefix are read from default backend.
+type chain struct {
+	def      secrets
+	defName  string
+	backends map[string]secrets
+}
+
+func (c *chain) Read(path string, version int) (map[string]string, error) {
+	name, rest := model.SplitSecretBackend(path)
+	if name == "" {
+		return c.def.Read(path, version)
+	}
+	backend, ok := c.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown secrets backend: %s", name)
+	}
+	return backend.Read(rest, version)
+}
+
+// Check reports unhealthy state if any of backends is unhealthy.
+func (c *chain) Check() health.Check {
+	names := make([]string, 0, len(c.backends))
+	for name := range c.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	check := health.Check{Healthy: true, Details: make(map[string]string)}
+	var failed []string
+	for _, name := range names {
+		res := c.backends[name].Check()
+		for k, v := range res.Details {
+			check.Details[name+"."+k] = v
+		}
+		if res.Healthy {
+			check.Details[name] = "healthy"
+			continue
+		}
+		check.Healthy = false
+		check.Details[name] = "unhealthy"
+		failed = append(failed, fmt.Sprintf("%s: %s", name, res.Message))
+	}
+	check.Message = strings.Join(failed, "; ")
+	check.Details["Default"] = c.defName
+	return check
+}
+
+func (c *chain) Run() {
+	for _, backend := range c.backends {
+		run(backend)
+	}
+}
+
+func (c *chain) Close() {
+	for _, backend := range c.backends {
+		closeBackend(backend)
+	}
+}
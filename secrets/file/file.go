@@ -0,0 +1,165 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
+	"github.com/mlowicki/rhythm/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Client implements secrets backend reading secrets from local (optionally
+// encrypted) JSON file. File is read again if its modification time changes.
+type Client struct {
+	conf    *conf.SecretsFile
+	mut     sync.Mutex
+	secrets map[string]map[string]string
+	modTime time.Time
+	loaded  time.Time
+	err     error
+}
+
+// Read returns key-value pairs of secret under path. Versions aren't
+// supported.
+func (c *Client) Read(path string, version int) (map[string]string, error) {
+	if version != 0 {
+		return nil, errors.New("secret versions aren't supported by file backend")
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	secret, ok := c.secrets[path]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return secret, nil
+}
+
+// Check returns state of the last file load.
+func (c *Client) Check() health.Check {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	details := map[string]string{
+		"Path":    c.conf.Path,
+		"Decrypt": c.conf.Decrypt,
+		"Secrets": fmt.Sprintf("%d", len(c.secrets)),
+	}
+	if !c.loaded.IsZero() {
+		details["Loaded"] = c.loaded.Format(time.RFC3339)
+	}
+	if c.err != nil {
+		return health.Check{Message: c.err.Error(), Details: details}
+	}
+	return health.Check{Healthy: true, Details: details}
+}
+
+// refresh loads file if it has been modified since the last load.
+func (c *Client) refresh() error {
+	info, err := os.Stat(c.conf.Path)
+	if err != nil {
+		c.err = err
+		return err
+	}
+	if c.err == nil && info.ModTime().Equal(c.modTime) {
+		return nil
+	}
+	secrets, err := c.load()
+	if err != nil {
+		c.err = fmt.Errorf("Loading secrets file failed: %s", err)
+		return c.err
+	}
+	c.secrets = secrets
+	c.modTime = info.ModTime()
+	c.loaded = time.Now()
+	c.err = nil
+	log.Infof("Secrets file loaded: %s", c.conf.Path)
+	return nil
+}
+
+func (c *Client) load() (map[string]map[string]string, error) {
+	data, err := c.decrypt()
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Decoding JSON failed: %s", err)
+	}
+	secrets := make(map[string]map[string]string, len(raw))
+	for path, value := range raw {
+		// SOPS adds its metadata to decrypted output.
+		if path == "sops" {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			secrets[path] = map[string]string{model.DefaultSecretKey: v}
+		case map[string]interface{}:
+			secret := make(map[string]string, len(v))
+			for k, kv := range v {
+				s, ok := kv.(string)
+				if !ok {
+					return nil, fmt.Errorf("Secret's key is not string: %s#%s", path, k)
+				}
+				secret[k] = s
+			}
+			secrets[path] = secret
+		default:
+			return nil, fmt.Errorf("Secret is neither string nor object: %s", path)
+		}
+	}
+	return secrets, nil
+}
+
+func (c *Client) decrypt() ([]byte, error) {
+	var cmd *exec.Cmd
+	switch c.conf.Decrypt {
+	case conf.SecretsFileDecryptNone:
+		return ioutil.ReadFile(c.conf.Path)
+	case conf.SecretsFileDecryptSOPS:
+		cmd = exec.Command(c.command(), "--decrypt", "--output-type", "json", c.conf.Path)
+		if c.conf.AgeIdentity != "" {
+			cmd.Env = append(os.Environ(), "SOPS_AGE_KEY_FILE="+c.conf.AgeIdentity)
+		}
+	case conf.SecretsFileDecryptAge:
+		cmd = exec.Command(c.command(), "--decrypt", "--identity", c.conf.AgeIdentity, c.conf.Path)
+	default:
+		return nil, fmt.Errorf("Unknown decryption method: %s", c.conf.Decrypt)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %s: %s", cmd.Path, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (c *Client) command() string {
+	if c.conf.Command != "" {
+		return c.conf.Command
+	}
+	return c.conf.Decrypt
+}
+
+// New creates file secrets backend. File is loaded immediately so invalid
+// file is reported on start (or on configuration reload).
+func New(c *conf.SecretsFile) (*Client, error) {
+	cli := &Client{conf: c}
+	if err := cli.refresh(); err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
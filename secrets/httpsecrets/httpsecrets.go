@@ -0,0 +1,133 @@
+package httpsecrets
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
+	tlsutils "github.com/mlowicki/rhythm/tls"
+)
+
+// maxErrorSize limits how much of error response's body is reported.
+const maxErrorSize = 512
+
+// Client implements secrets backend reading secrets from HTTP server.
+//
+// Secret is read with GET <addr>/<path>[?version=<version>] request. Token
+// (if set) is passed in "Authorization: Bearer <token>" header. Server
+// responds with 200 and {"data": {"<key>": "<value>", ...}} if secret
+// exists or with 404 otherwise.
+type Client struct {
+	client *http.Client
+	addr   string
+	token  string
+	// Result of the last request which hasn't ended with 200 nor 404.
+	mut      sync.Mutex
+	lastErr  error
+	lastRead time.Time
+}
+
+type readResponse struct {
+	Data map[string]string `json:"data"`
+}
+
+// Read returns key-value pairs of secret under path.
+func (c *Client) Read(path string, version int) (map[string]string, error) {
+	secret, err := c.read(path, version)
+	c.mut.Lock()
+	c.lastErr = err
+	if err == errNotFound {
+		c.lastErr = nil
+	}
+	c.lastRead = time.Now()
+	c.mut.Unlock()
+	return secret, err
+}
+
+var errNotFound = errors.New("secret not found")
+
+func (c *Client) read(path string, version int) (map[string]string, error) {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	u := c.addr + "/" + strings.Join(segments, "/")
+	if version != 0 {
+		u += "?version=" + strconv.Itoa(version)
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errNotFound
+	default:
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorSize))
+		return nil, fmt.Errorf("Unexpected response: %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	var payload readResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("Decoding response failed: %s", err)
+	}
+	if payload.Data == nil {
+		return nil, errors.New("Response without data")
+	}
+	return payload.Data, nil
+}
+
+// Check returns result of the last read. Server isn't queried as contract
+// doesn't define health endpoint.
+func (c *Client) Check() health.Check {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	details := map[string]string{"Addr": c.addr}
+	if !c.lastRead.IsZero() {
+		details["LastRead"] = c.lastRead.Format(time.RFC3339)
+	}
+	if c.lastErr != nil {
+		return health.Check{Message: c.lastErr.Error(), Details: details}
+	}
+	return health.Check{Healthy: true, Details: details}
+}
+
+// New creates fresh instance of HTTP secrets backend.
+func New(c *conf.SecretsHTTP) (*Client, error) {
+	tc := &tls.Config{}
+	if c.CACert != "" {
+		pool, err := tlsutils.BuildCertPool(c.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = pool
+	}
+	return &Client{
+		client: &http.Client{
+			Timeout:   c.Timeout,
+			Transport: &http.Transport{TLSClientConfig: tc},
+		},
+		addr:  strings.TrimSuffix(c.Addr, "/"),
+		token: c.Token,
+	}, nil
+}
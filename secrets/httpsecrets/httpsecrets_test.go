@@ -0,0 +1,109 @@
+package httpsecrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/conf"
+)
+
+// stub serves secrets following HTTP backend's contract.
+func stub(t *testing.T) *httptest.Server {
+	secrets := map[string]map[string]string{
+		"/group/project/db":           {"password": "s3cr3t"},
+		"/group/project/db?version=2": {"password": "0ld"},
+		"/group/project/a b":          {"value": "escaped"},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("invalid token\n"))
+			return
+		}
+		key := r.URL.Path
+		if r.URL.RawQuery != "" {
+			key += "?" + r.URL.RawQuery
+		}
+		if key == "/group/project/broken" {
+			w.Write([]byte("{"))
+			return
+		}
+		data, ok := secrets[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+}
+
+func newClient(t *testing.T, addr, token string) *Client {
+	c, err := New(&conf.SecretsHTTP{Addr: addr + "/", Token: token, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRead(t *testing.T) {
+	srv := stub(t)
+	defer srv.Close()
+	c := newClient(t, srv.URL, "token")
+	tests := []struct {
+		path    string
+		version int
+		want    string
+		wantErr bool
+	}{
+		{"group/project/db", 0, "s3cr3t", false},
+		{"group/project/db", 2, "0ld", false},
+		{"group/project/a b", 0, "escaped", false},
+		{"group/project/missing", 0, "", true},
+		{"group/project/broken", 0, "", true},
+	}
+	for _, tt := range tests {
+		values, err := c.Read(tt.path, tt.version)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s (version %d): expected error", tt.path, tt.version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s (version %d): %s", tt.path, tt.version, err)
+			continue
+		}
+		for _, v := range values {
+			if v != tt.want {
+				t.Errorf("%s (version %d): got %q, want %q", tt.path, tt.version, v, tt.want)
+			}
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	srv := stub(t)
+	defer srv.Close()
+	c := newClient(t, srv.URL, "token")
+	if !c.Check().Healthy {
+		t.Error("expected healthy before first read")
+	}
+	c.Read("group/project/missing", 0)
+	if !c.Check().Healthy {
+		t.Error("missing secret shouldn't make backend unhealthy")
+	}
+	c = newClient(t, srv.URL, "wrong")
+	if _, err := c.Read("group/project/db", 0); err == nil {
+		t.Fatal("expected error for invalid token")
+	}
+	check := c.Check()
+	if check.Healthy {
+		t.Error("expected unhealthy after failed read")
+	}
+	if check.Message != "Unexpected response: 401 Unauthorized: invalid token" {
+		t.Errorf("unexpected message: %q", check.Message)
+	}
+}
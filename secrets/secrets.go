@@ -1,37 +1,159 @@
 package secrets
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
+	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/secrets/file"
+	"github.com/mlowicki/rhythm/secrets/httpsecrets"
 	"github.com/mlowicki/rhythm/secrets/vault"
 	log "github.com/sirupsen/logrus"
 )
 
 type secrets interface {
-	Read(string) (string, error)
+	Read(path string, version int) (map[string]string, error)
+	Check() health.Check
 }
 
-// None is a simple secrets backend returning passed path.
+// None is a simple secrets backend returning passed path as secret's value.
 type None struct{}
 
-func (*None) Read(path string) (string, error) {
-	return path, nil
+func (*None) Read(path string, version int) (map[string]string, error) {
+	return map[string]string{model.DefaultSecretKey: path}, nil
 }
 
-// New cretes secrets backend.
-func New(c *conf.Secrets) secrets {
-	var backend secrets
-	switch c.Backend {
+// Check always reports healthy state as there is nothing to check.
+func (*None) Check() health.Check {
+	return health.Check{Healthy: true}
+}
+
+// runner is implemented by backends having background jobs (e.g. renewing
+// authentication token).
+type runner interface {
+	Run()
+	Close()
+}
+
+func run(backend secrets) {
+	if r, ok := backend.(runner); ok {
+		r.Run()
+	}
+}
+
+func closeBackend(backend secrets) {
+	if r, ok := backend.(runner); ok {
+		r.Close()
+	}
+}
+
+// Reloadable is a secrets backend which can be replaced without restarting
+// the server.
+type Reloadable struct {
+	mut     sync.RWMutex
+	backend secrets
+}
+
+func (r *Reloadable) get() secrets {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	return r.backend
+}
+
+// Read returns key-value pairs of secret's version. The latest version is
+// returned if version is zero.
+func (r *Reloadable) Read(path string, version int) (map[string]string, error) {
+	return r.get().Read(path, version)
+}
+
+// Check returns state of the current backend.
+func (r *Reloadable) Check() health.Check {
+	return r.get().Check()
+}
+
+// PrepareReload creates backend out of new configuration. Returned function
+// replaces the current one. Nothing is changed if error is returned.
+func (r *Reloadable) PrepareReload(c *conf.Secrets) (func(), error) {
+	backend, err := newBackend(c)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		run(backend)
+		r.mut.Lock()
+		old := r.backend
+		r.backend = backend
+		r.mut.Unlock()
+		closeBackend(old)
+	}, nil
+}
+
+func newSingleBackend(c *conf.Secrets, name string) (secrets, error) {
+	switch name {
 	case conf.SecretsBackendVault:
-		var err error
-		backend, err = vault.New(&c.Vault)
-		if err != nil {
-			log.Fatal(err)
-		}
+		return vault.New(&c.Vault)
+	case conf.SecretsBackendFile:
+		return file.New(&c.File)
+	case conf.SecretsBackendHTTP:
+		return httpsecrets.New(&c.HTTP)
 	case conf.SecretsBackendNone:
-		backend = &None{}
+		return &None{}, nil
 	default:
-		log.Fatalf("Unknown secrets backend: %s", c.Backend)
+		return nil, fmt.Errorf("Unknown secrets backend: %s", name)
+	}
+}
+
+func newBackend(c *conf.Secrets) (secrets, error) {
+	backend, err := newChain(c)
+	if err != nil {
+		return nil, err
+	}
+	if c.CacheTTL > 0 {
+		return newCache(backend, c.CacheTTL), nil
+	}
+	return backend, nil
+}
+
+func newChain(c *conf.Secrets) (secrets, error) {
+	def, err := newSingleBackend(c, c.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Chain) == 0 {
+		return def, nil
+	}
+	ch := &chain{
+		def:      def,
+		defName:  c.Backend,
+		backends: map[string]secrets{c.Backend: def},
+	}
+	for _, name := range c.Chain {
+		if _, ok := ch.backends[name]; ok {
+			continue
+		}
+		backend, err := newSingleBackend(c, name)
+		if err != nil {
+			ch.Close()
+			return nil, fmt.Errorf("Creating secrets backend %s failed: %s", name, err)
+		}
+		ch.backends[name] = backend
+	}
+	return ch, nil
+}
+
+// New cretes secrets backend.
+func New(c *conf.Secrets) *Reloadable {
+	backend, err := newBackend(c)
+	if err != nil {
+		log.Fatal(err)
 	}
 	log.Printf("Secrets backend: %s", c.Backend)
-	return backend
+	if len(c.Chain) > 0 {
+		log.Printf("Chained secrets backends: %s", strings.Join(c.Chain, ", "))
+	}
+	run(backend)
+	return &Reloadable{backend: backend}
 }
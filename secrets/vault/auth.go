@@ -0,0 +1,263 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/mlowicki/rhythm/conf"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const kubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+var (
+	loginsCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secrets_vault_logins",
+		Help: "Number of Vault logins.",
+	}, []string{"result"})
+	renewalsCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secrets_vault_token_renewals",
+		Help: "Number of Vault token renewals.",
+	}, []string{"result"})
+	tokenExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "secrets_vault_token_expiry_timestamp_seconds",
+		Help: "Time when Vault token expires (0 if it never expires).",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(loginsCount)
+	prometheus.MustRegister(renewalsCount)
+	prometheus.MustRegister(tokenExpiry)
+}
+
+// authState describes current Vault token.
+type authState struct {
+	mut         sync.Mutex
+	loggedIn    bool
+	expiry      time.Time // zero if token never expires
+	lastRenewal time.Time
+	lastErr     error
+}
+
+func (s *authState) set(ttl time.Duration, renewed bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.loggedIn = true
+	s.lastErr = nil
+	if ttl > 0 {
+		s.expiry = time.Now().Add(ttl)
+		tokenExpiry.Set(float64(s.expiry.Unix()))
+	} else {
+		s.expiry = time.Time{}
+		tokenExpiry.Set(0)
+	}
+	if renewed {
+		s.lastRenewal = time.Now()
+	}
+}
+
+func (s *authState) fail(err error) {
+	s.mut.Lock()
+	s.lastErr = err
+	s.mut.Unlock()
+}
+
+// valid returns true if token obtained and not expired yet.
+func (s *authState) valid() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.loggedIn && (s.expiry.IsZero() || s.expiry.After(time.Now()))
+}
+
+func (s *authState) details() map[string]string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	details := map[string]string{"TokenExpiry": "Never", "LastRenewal": "Never"}
+	if !s.loggedIn {
+		details["TokenExpiry"] = "Not logged in"
+	} else if !s.expiry.IsZero() {
+		details["TokenExpiry"] = s.expiry.Format(time.UnixDate)
+	}
+	if !s.lastRenewal.IsZero() {
+		details["LastRenewal"] = s.lastRenewal.Format(time.UnixDate)
+	}
+	if s.lastErr != nil {
+		details["LastError"] = s.lastErr.Error()
+	}
+	return details
+}
+
+// login obtains token using configured auth method and returns its TTL
+// (0 if it never expires) and renewability.
+func (c *Client) login() (time.Duration, bool, error) {
+	if c.auth.Method == conf.SecretsVaultAuthToken {
+		c.c.SetToken(c.token)
+		secret, err := c.c.Auth().Token().LookupSelf()
+		if err != nil {
+			return 0, false, fmt.Errorf("Token lookup failed: %s", err)
+		}
+		return tokenInfo(secret)
+	}
+	data, err := c.loginData()
+	if err != nil {
+		return 0, false, err
+	}
+	mount := c.auth.Mount
+	if mount == "" {
+		mount = c.auth.Method
+	}
+	// Login mustn't be sent with previous (e.g. expired) token.
+	c.c.ClearToken()
+	secret, err := c.c.Logical().Write("auth/"+strings.Trim(mount, "/")+"/login", data)
+	if err != nil {
+		return 0, false, fmt.Errorf("Login failed: %s", err)
+	}
+	if secret == nil || secret.Auth == nil {
+		return 0, false, errors.New("Login failed: no auth info in response")
+	}
+	c.c.SetToken(secret.Auth.ClientToken)
+	ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+	return ttl, secret.Auth.Renewable, nil
+}
+
+func (c *Client) loginData() (map[string]interface{}, error) {
+	switch c.auth.Method {
+	case conf.SecretsVaultAuthAppRole:
+		data := map[string]interface{}{"role_id": c.auth.AppRole.RoleID}
+		if c.auth.AppRole.SecretID != "" {
+			data["secret_id"] = c.auth.AppRole.SecretID
+		}
+		return data, nil
+	case conf.SecretsVaultAuthCert:
+		data := map[string]interface{}{}
+		if c.auth.Cert.Name != "" {
+			data["name"] = c.auth.Cert.Name
+		}
+		return data, nil
+	case conf.SecretsVaultAuthJWT, conf.SecretsVaultAuthKubernetes:
+		path := c.auth.JWT.TokenFile
+		if path == "" {
+			path = kubernetesTokenFile
+		}
+		jwt, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed reading JWT: %s", err)
+		}
+		return map[string]interface{}{
+			"role": c.auth.JWT.Role,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown auth method: %s", c.auth.Method)
+	}
+}
+
+func (c *Client) renew() (time.Duration, bool, error) {
+	secret, err := c.c.Auth().Token().RenewSelf(0)
+	if err != nil {
+		return 0, false, err
+	}
+	if secret != nil && secret.Auth != nil {
+		return time.Duration(secret.Auth.LeaseDuration) * time.Second, secret.Auth.Renewable, nil
+	}
+	return tokenInfo(secret)
+}
+
+func tokenInfo(secret *vault.Secret) (time.Duration, bool, error) {
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return 0, false, err
+	}
+	renewable, err := secret.TokenIsRenewable()
+	if err != nil {
+		return 0, false, err
+	}
+	return ttl, renewable, nil
+}
+
+// Run logs in and starts background loop renewing token before it expires.
+// The first login is done synchronously so secrets can be read as soon as
+// Run returns (unless login fails). Login is retried in background if it
+// fails or token can't be renewed anymore.
+func (c *Client) Run() {
+	ttl, renewable, err := c.tryLogin()
+	go c.maintainToken(ttl, renewable, err)
+}
+
+// tryLogin logs in and records the outcome.
+func (c *Client) tryLogin() (time.Duration, bool, error) {
+	ttl, renewable, err := c.login()
+	if err != nil {
+		loginsCount.WithLabelValues("failure").Inc()
+		c.state.fail(err)
+		log.Errorf("Vault login failed: %s. Retry in %s.", err, c.auth.RetryInterval)
+		return 0, false, err
+	}
+	loginsCount.WithLabelValues("success").Inc()
+	c.state.set(ttl, false)
+	log.Debugf("Logged in to Vault (method: %s, TTL: %s)", c.auth.Method, ttl)
+	return ttl, renewable, nil
+}
+
+// maintainToken renews token obtained by the last login (or retries login if
+// it failed) until client is closed.
+func (c *Client) maintainToken(ttl time.Duration, renewable bool, err error) {
+	for {
+		if err != nil {
+			if !c.sleep(c.auth.RetryInterval) {
+				return
+			}
+			ttl, renewable, err = c.tryLogin()
+			continue
+		}
+		if ttl == 0 {
+			<-c.ctx.Done() // Token never expires.
+			return
+		}
+		for renewable {
+			// Renew when 2/3 of TTL passed.
+			if !c.sleep(ttl * 2 / 3) {
+				return
+			}
+			ttl, renewable, err = c.renew()
+			if err != nil {
+				renewalsCount.WithLabelValues("failure").Inc()
+				c.state.fail(err)
+				log.Errorf("Vault token renewal failed: %s", err)
+				break
+			}
+			renewalsCount.WithLabelValues("success").Inc()
+			c.state.set(ttl, true)
+			log.Debugf("Vault token renewed (TTL: %s)", ttl)
+		}
+		if !renewable && err == nil {
+			// Token can't be extended so log in again before it expires.
+			if !c.sleep(ttl * 2 / 3) {
+				return
+			}
+		}
+		ttl, renewable, err = c.tryLogin()
+	}
+}
+
+// Close stops background loop.
+func (c *Client) Close() {
+	c.cancel()
+}
+
+// sleep waits for d and returns false if client has been closed in the meantime.
+func (c *Client) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// kvMount describes secrets engine mounted under client's root.
+type kvMount struct {
+	// Mount path with trailing slash (e.g. "secret/").
+	path    string
+	version int
+}
+
+// kvMountCache remembers mount detected for client's root so preflight
+// request is sent only once.
+type kvMountCache struct {
+	mut   sync.Mutex
+	mount *kvMount
+}
+
+// mount returns KV mount of client's root. Version is detected the same way
+// as Vault's CLI does it. Vault servers not supporting detection are assumed
+// to use KV v1.
+func (c *Client) mount() (*kvMount, error) {
+	if c.kvVersion == 1 {
+		return &kvMount{version: 1}, nil
+	}
+	c.kv.mut.Lock()
+	defer c.kv.mut.Unlock()
+	if c.kv.mount != nil {
+		return c.kv.mount, nil
+	}
+	secret, err := c.c.Logical().Read("sys/internal/ui/mounts/" + c.root)
+	if err != nil {
+		return nil, fmt.Errorf("Detecting KV version failed: %s", err)
+	}
+	mount := &kvMount{version: 1}
+	if secret != nil {
+		if path, ok := secret.Data["path"].(string); ok {
+			mount.path = path
+		}
+		if opts, ok := secret.Data["options"].(map[string]interface{}); ok {
+			if v, ok := opts["version"].(string); ok && v != "" {
+				version, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid KV version: %s", v)
+				}
+				mount.version = version
+			}
+		}
+	}
+	if c.kvVersion != 0 && c.kvVersion != mount.version {
+		return nil, fmt.Errorf("KV version mismatch: configured %d, detected %d", c.kvVersion, mount.version)
+	}
+	c.kv.mount = mount
+	return mount, nil
+}
+
+// readKV returns key-value pairs of secret under path (relative to root).
+func (c *Client) readKV(path string, version int) (map[string]interface{}, error) {
+	mount, err := c.mount()
+	if err != nil {
+		return nil, err
+	}
+	fullPath := c.root + path
+	if mount.version < 2 {
+		if version != 0 {
+			return nil, errors.New("secret versions are supported only by KV v2")
+		}
+		secret, err := c.c.Logical().Read(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		if secret == nil {
+			return nil, errors.New("secret not found")
+		}
+		return secret.Data, nil
+	}
+	fullPath = mount.path + "data/" + strings.TrimPrefix(fullPath, mount.path)
+	var params map[string][]string
+	if version != 0 {
+		params = map[string][]string{"version": {strconv.Itoa(version)}}
+	}
+	secret, err := c.c.Logical().ReadWithData(fullPath, params)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, errors.New("secret not found")
+	}
+	// Data is nil if version has been deleted or destroyed.
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return data, nil
+}
@@ -1,41 +1,82 @@
 package vault
 
 import (
-	"errors"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	vault "github.com/hashicorp/vault/api"
 	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
 	tlsutils "github.com/mlowicki/rhythm/tls"
 	log "github.com/sirupsen/logrus"
 )
 
 // Client implements Vault client reading secrets with specified prefix.
 type Client struct {
-	c    *vault.Client
-	root string
+	c     *vault.Client
+	root  string
+	token string
+	// KV secrets engine version. Detected if zero.
+	kvVersion int
+	kv        kvMountCache
+	auth      *conf.SecretsVaultAuth
+	state     authState
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
-func (c *Client) Read(path string) (string, error) {
-	secret, err := c.c.Logical().Read(c.root + path)
+// Read returns key-value pairs of secret under path (relative to root).
+// Version can be specified only for KV v2 secrets engine.
+func (c *Client) Read(path string, version int) (map[string]string, error) {
+	data, err := c.readKV(path, version)
 	if err != nil {
-		return "", err
-	}
-	if secret == nil {
-		return "", errors.New("secret not found")
+		return nil, err
 	}
-
-	if value, ok := secret.Data["value"]; ok {
-		switch v := value.(type) {
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		// Other values (e.g. nested objects) are skipped so secrets having
+		// them can still be used as long as such keys aren't referenced.
+		switch v := v.(type) {
 		case string:
-			return v, nil
-		default:
-			return "", errors.New("secret's value is not string")
+			values[k] = v
+		case json.Number:
+			values[k] = v.String()
+		case float64:
+			values[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[k] = strconv.FormatBool(v)
 		}
-	} else {
-		return "", errors.New("secret's value not found")
 	}
+	return values, nil
+}
+
+// Check returns state of Vault server and client's token.
+func (c *Client) Check() health.Check {
+	details := c.state.details()
+	details["AuthMethod"] = c.auth.Method
+	resp, err := c.c.Sys().Health()
+	if err != nil {
+		return health.Check{Message: err.Error(), Details: details}
+	}
+	details["Initialized"] = fmt.Sprintf("%t", resp.Initialized)
+	details["Sealed"] = fmt.Sprintf("%t", resp.Sealed)
+	details["Version"] = resp.Version
+	check := health.Check{
+		Healthy: resp.Initialized && !resp.Sealed,
+		Details: details,
+	}
+	if !check.Healthy {
+		check.Message = "Vault isn't initialized or is sealed"
+	} else if !c.state.valid() {
+		check.Healthy = false
+		check.Message = "No valid token"
+	}
+	return check
 }
 
 // New creates fresh instance of Vault client.
@@ -58,11 +99,29 @@ func New(c *conf.SecretsVault) (*Client, error) {
 		tlsConf := vc.HttpClient.Transport.(*http.Transport).TLSClientConfig
 		tlsConf.RootCAs = pool
 	}
+	if c.Auth.Method == conf.SecretsVaultAuthCert {
+		cert, err := tls.LoadX509KeyPair(c.Auth.Cert.CertFile, c.Auth.Cert.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed loading client certificate: %s", err)
+		}
+		tlsConf := vc.HttpClient.Transport.(*http.Transport).TLSClientConfig
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
 	cli, err := vault.NewClient(vc)
 	if err != nil {
 		return nil, err
 	}
-	cli.SetToken(c.Token)
-	wrapper := &Client{c: cli, root: c.Root}
+	// Token is set by Run.
+	cli.ClearToken()
+	ctx, cancel := context.WithCancel(context.Background())
+	wrapper := &Client{
+		c:         cli,
+		root:      c.Root,
+		token:     c.Token,
+		kvVersion: c.KVVersion,
+		auth:      &c.Auth,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
 	return wrapper, nil
 }
@@ -0,0 +1,184 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/conf"
+)
+
+const testToken = "s.token"
+
+// fakeVault implements parts of Vault HTTP API used by client: AppRole
+// login, token lookup, KV mount detection and reading KV v1 and v2 secrets.
+type fakeVault struct {
+	srv       *httptest.Server
+	mut       sync.Mutex
+	kvVersion int
+	loginErr  bool
+	secrets   map[string]map[string]interface{}
+}
+
+func newFakeVault(t *testing.T, kvVersion int) *fakeVault {
+	f := &fakeVault{kvVersion: kvVersion, secrets: make(map[string]map[string]interface{})}
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mut.Lock()
+		defer f.mut.Unlock()
+		reply := func(v interface{}) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(v)
+		}
+		if r.URL.Path == "/v1/auth/approle/login" {
+			if f.loginErr {
+				w.WriteHeader(http.StatusBadRequest)
+				reply(map[string]interface{}{"errors": []string{"invalid role ID"}})
+				return
+			}
+			reply(map[string]interface{}{
+				"auth": map[string]interface{}{
+					"client_token":   testToken,
+					"lease_duration": 3600,
+					"renewable":      true,
+				},
+			})
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != testToken {
+			w.WriteHeader(http.StatusForbidden)
+			reply(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		switch path := strings.TrimPrefix(r.URL.Path, "/v1/"); {
+		case strings.HasPrefix(path, "sys/internal/ui/mounts/secret/rhythm"):
+			reply(map[string]interface{}{
+				"data": map[string]interface{}{
+					"path":    "secret/",
+					"options": map[string]interface{}{"version": strconv.Itoa(f.kvVersion)},
+				},
+			})
+		case f.kvVersion == 2 && strings.HasPrefix(path, "secret/data/"):
+			data, ok := f.secrets["secret/"+strings.TrimPrefix(path, "secret/data/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				reply(map[string]interface{}{"errors": []string{}})
+				return
+			}
+			reply(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     data,
+					"metadata": map[string]interface{}{"version": 1},
+				},
+			})
+		default:
+			data, ok := f.secrets[path]
+			if f.kvVersion != 1 || !ok {
+				w.WriteHeader(http.StatusNotFound)
+				reply(map[string]interface{}{"errors": []string{}})
+				return
+			}
+			reply(map[string]interface{}{"data": data})
+		}
+	}))
+	return f
+}
+
+func (f *fakeVault) client(t *testing.T, kvVersion int) *Client {
+	c, err := New(&conf.SecretsVault{
+		Addr:      f.srv.URL,
+		Root:      "secret/rhythm/",
+		Timeout:   time.Second,
+		KVVersion: kvVersion,
+		Auth: conf.SecretsVaultAuth{
+			Method:        conf.SecretsVaultAuthAppRole,
+			AppRole:       conf.SecretsVaultAppRole{RoleID: "rhythm"},
+			RetryInterval: time.Hour,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestReadRightAfterRun(t *testing.T) {
+	for _, kvVersion := range []int{1, 2} {
+		f := newFakeVault(t, kvVersion)
+		f.secrets["secret/rhythm/group/project/db"] = map[string]interface{}{"password": "s3cr3t"}
+		// Version 2 is detected.
+		c := f.client(t, kvVersion%2)
+		c.Run()
+		values, err := c.Read("group/project/db", 0)
+		c.Close()
+		f.srv.Close()
+		if err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if values["password"] != "s3cr3t" {
+			t.Errorf("KV v%d: got %q, want %q", kvVersion, values["password"], "s3cr3t")
+		}
+	}
+}
+
+func TestReadWithoutLogin(t *testing.T) {
+	f := newFakeVault(t, 1)
+	defer f.srv.Close()
+	f.secrets["secret/rhythm/group/project/db"] = map[string]interface{}{"password": "s3cr3t"}
+	f.loginErr = true
+	c := f.client(t, 1)
+	c.Run()
+	defer c.Close()
+	if _, err := c.Read("group/project/db", 0); err == nil {
+		t.Error("expected error if login failed")
+	}
+	check := c.Check()
+	if check.Healthy {
+		t.Error("expected unhealthy check if login failed")
+	}
+}
+
+func TestReadMissingSecret(t *testing.T) {
+	f := newFakeVault(t, 2)
+	defer f.srv.Close()
+	c := f.client(t, 2)
+	c.Run()
+	defer c.Close()
+	if _, err := c.Read("group/project/missing", 0); err == nil {
+		t.Error("expected error for missing secret")
+	}
+}
+
+func TestReadNonStringValues(t *testing.T) {
+	f := newFakeVault(t, 1)
+	defer f.srv.Close()
+	f.secrets["secret/rhythm/group/project/db"] = map[string]interface{}{
+		"password": "s3cr3t",
+		"port":     5432,
+		"ratio":    0.5,
+		"tls":      true,
+		"replicas": []string{"db1", "db2"},
+		"options":  map[string]interface{}{"timeout": 10},
+		"comment":  nil,
+	}
+	c := f.client(t, 1)
+	c.Run()
+	defer c.Close()
+	values, err := c.Read("group/project/db", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"password": "s3cr3t", "port": "5432", "ratio": "0.5", "tls": "true"}
+	if len(values) != len(want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+	for k, v := range want {
+		if values[k] != v {
+			t.Errorf("%s: got %q, want %q", k, values[k], v)
+		}
+	}
+}
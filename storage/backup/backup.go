@@ -0,0 +1,192 @@
+package backup
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mlowicki/rhythm/model"
+)
+
+// Version is a version of archive format.
+const Version = 1
+
+// Archive holds the whole Rhythm state.
+type Archive struct {
+	Version       int
+	SchemaVersion int
+	Created       time.Time
+	FrameworkID   string
+	Jobs          []*Job
+	QueuedJobs    []model.JobID
+	APITokens     []*model.APIToken `json:",omitempty"`
+}
+
+// Job holds job's configuration, runtime and history of tasks.
+type Job struct {
+	model.Job
+	Tasks []*model.Task
+}
+
+type source interface {
+	GetSchemaVersion() (int, error)
+	GetFrameworkID() (string, error)
+	GetJobs() ([]*model.Job, error)
+	GetTasks(group, project, id string) ([]*model.Task, error)
+	GetQueuedJobsIDs() ([]model.JobID, error)
+	GetAPITokens() ([]*model.APIToken, error)
+}
+
+type target interface {
+	GetSchemaVersion() (int, error)
+	GetJobs() ([]*model.Job, error)
+	GetTasks(group, project, id string) ([]*model.Task, error)
+	SaveJob(j *model.Job) error
+	AddTask(group, project, id string, task *model.Task) error
+	QueueJob(group, project, id string, traceContext map[string]string) error
+	SetFrameworkID(id string) error
+	SaveAPIToken(token *model.APIToken) error
+}
+
+// Dump reads the whole state from storage.
+func Dump(s source) (*Archive, error) {
+	schemaVersion, err := s.GetSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("Failed getting schema version: %s", err)
+	}
+	fid, err := s.GetFrameworkID()
+	if err != nil {
+		return nil, fmt.Errorf("Failed getting framework ID: %s", err)
+	}
+	jobs, err := s.GetJobs()
+	if err != nil {
+		return nil, fmt.Errorf("Failed getting jobs: %s", err)
+	}
+	queued, err := s.GetQueuedJobsIDs()
+	if err != nil {
+		return nil, fmt.Errorf("Failed getting queued jobs: %s", err)
+	}
+	tokens, err := s.GetAPITokens()
+	if err != nil {
+		return nil, fmt.Errorf("Failed getting API tokens: %s", err)
+	}
+	a := Archive{
+		Version:       Version,
+		SchemaVersion: schemaVersion,
+		Created:       time.Now(),
+		FrameworkID:   fid,
+		Jobs:          make([]*Job, 0, len(jobs)),
+		QueuedJobs:    queued,
+		APITokens:     tokens,
+	}
+	for _, job := range jobs {
+		tasks, err := s.GetTasks(job.Group, job.Project, job.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed getting tasks of %s: %s", job, err)
+		}
+		a.Jobs = append(a.Jobs, &Job{Job: *job, Tasks: tasks})
+	}
+	return &a, nil
+}
+
+// Restore saves state from archive into storage. Storage must not have any
+// jobs unless force is set. Then jobs and API tokens from archive overwrite
+// stored ones and tasks already present are skipped so interrupted restore
+// can be run again.
+func Restore(t target, a *Archive, withFrameworkID, force bool) error {
+	schemaVersion, err := t.GetSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("Failed getting schema version: %s", err)
+	}
+	if a.SchemaVersion > schemaVersion {
+		return fmt.Errorf("Archive schema version (%d) is newer than storage's one (%d)", a.SchemaVersion, schemaVersion)
+	}
+	jobs, err := t.GetJobs()
+	if err != nil {
+		return fmt.Errorf("Failed getting jobs: %s", err)
+	}
+	if len(jobs) > 0 && !force {
+		return errors.New("Storage isn't empty")
+	}
+	if withFrameworkID {
+		err = t.SetFrameworkID(a.FrameworkID)
+		if err != nil {
+			return fmt.Errorf("Failed setting framework ID: %s", err)
+		}
+	}
+	for _, job := range a.Jobs {
+		err = t.SaveJob(&job.Job)
+		if err != nil {
+			return fmt.Errorf("Failed saving job %s: %s", &job.Job, err)
+		}
+		stored := make(map[string]bool)
+		if force {
+			tasks, err := t.GetTasks(job.Group, job.Project, job.ID)
+			if err != nil {
+				return fmt.Errorf("Failed getting tasks of %s: %s", &job.Job, err)
+			}
+			for _, task := range tasks {
+				stored[taskKey(task)] = true
+			}
+		}
+		for _, task := range job.Tasks {
+			if stored[taskKey(task)] {
+				continue
+			}
+			err = t.AddTask(job.Group, job.Project, job.ID, task)
+			if err != nil {
+				return fmt.Errorf("Failed saving task of %s: %s", &job.Job, err)
+			}
+		}
+	}
+	for _, jid := range a.QueuedJobs {
+		err = t.QueueJob(jid.Group, jid.Project, jid.ID, nil)
+		if err != nil {
+			return fmt.Errorf("Failed queueing job %s: %s", &jid, err)
+		}
+	}
+	for _, token := range a.APITokens {
+		err = t.SaveAPIToken(token)
+		if err != nil {
+			return fmt.Errorf("Failed saving API token %s: %s", token.ID, err)
+		}
+	}
+	return nil
+}
+
+// taskKey identifies task within job. Tasks which couldn't be launched don't
+// have ID so time of their end is used as well.
+func taskKey(task *model.Task) string {
+	return fmt.Sprintf("%d@%s", task.End.Unix(), task.TaskID)
+}
+
+// Write encodes archive as gzipped JSON.
+func Write(w io.Writer, a *Archive) error {
+	zw := gzip.NewWriter(w)
+	err := json.NewEncoder(zw).Encode(a)
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Read decodes archive encoded by Write.
+func Read(r io.Reader) (*Archive, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var a Archive
+	err = json.NewDecoder(zr).Decode(&a)
+	if err != nil {
+		return nil, err
+	}
+	if a.Version != Version {
+		return nil, fmt.Errorf("Unsupported archive version: %d", a.Version)
+	}
+	return &a, nil
+}
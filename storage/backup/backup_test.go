@@ -0,0 +1,91 @@
+package backup
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/model"
+)
+
+// memTarget keeps restored state in memory and fails after failAfter tasks.
+type memTarget struct {
+	jobs      map[string]*model.Job
+	tasks     map[string][]*model.Task
+	failAfter int
+}
+
+func newMemTarget() *memTarget {
+	return &memTarget{
+		jobs:      make(map[string]*model.Job),
+		tasks:     make(map[string][]*model.Task),
+		failAfter: -1,
+	}
+}
+
+func (t *memTarget) GetSchemaVersion() (int, error) { return 1, nil }
+
+func (t *memTarget) GetJobs() ([]*model.Job, error) {
+	var jobs []*model.Job
+	for _, job := range t.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (t *memTarget) GetTasks(group, project, id string) ([]*model.Task, error) {
+	return t.tasks[group+":"+project+":"+id], nil
+}
+
+func (t *memTarget) SaveJob(j *model.Job) error {
+	t.jobs[j.Group+":"+j.Project+":"+j.ID] = j
+	return nil
+}
+
+func (t *memTarget) AddTask(group, project, id string, task *model.Task) error {
+	if t.failAfter == 0 {
+		return errors.New("connection lost")
+	}
+	t.failAfter--
+	fqid := group + ":" + project + ":" + id
+	t.tasks[fqid] = append(t.tasks[fqid], task)
+	return nil
+}
+
+func (t *memTarget) QueueJob(group, project, id string, traceContext map[string]string) error {
+	return nil
+}
+
+func (t *memTarget) SetFrameworkID(id string) error { return nil }
+
+func (t *memTarget) SaveAPIToken(token *model.APIToken) error { return nil }
+
+func TestRestoreForceFinishesInterruptedRestore(t *testing.T) {
+	end := time.Unix(1500000000, 0)
+	job := &Job{
+		Job: model.Job{JobConf: model.JobConf{JobID: model.JobID{Group: "a", Project: "b", ID: "c"}}},
+		Tasks: []*model.Task{
+			{TaskID: "t1", End: end},
+			{TaskID: "t2", End: end.Add(time.Minute)},
+			// Tasks which failed to launch don't have ID.
+			{End: end.Add(2 * time.Minute)},
+			{End: end.Add(3 * time.Minute)},
+		},
+	}
+	a := &Archive{Version: Version, SchemaVersion: 1, Jobs: []*Job{job}}
+	target := newMemTarget()
+	target.failAfter = 2
+	if err := Restore(target, a, true, false); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := Restore(target, a, true, false); err == nil {
+		t.Fatal("expected error as storage isn't empty")
+	}
+	target.failAfter = -1
+	if err := Restore(target, a, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if tasks := target.tasks["a:b:c"]; len(tasks) != 4 {
+		t.Fatalf("got %d tasks, want 4", len(tasks))
+	}
+}
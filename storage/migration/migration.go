@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Step changes storage schema from version Version-1 to Version.
+type Step struct {
+	Version     int
+	Description string
+	// Apply performs migration and returns list of made changes. If dryRun
+	// is set then nothing is modified and only planned changes are returned.
+	Apply func(dryRun bool) ([]string, error)
+}
+
+// Backend is a storage which schema can be versioned and migrated.
+type Backend interface {
+	GetSchemaVersion() (int, error)
+	SetSchemaVersion(version int) error
+	MigrationSteps() []Step
+}
+
+// Result describes applied (or planned if run in dry-run mode) migration step.
+type Result struct {
+	Version     int
+	Description string
+	Changes     []string
+}
+
+// Run migrates storage's schema up to target version.
+// Returns error if stored schema is newer than target as it means that it has
+// been written by newer release.
+func Run(b Backend, target int, dryRun bool) ([]Result, error) {
+	current, err := b.GetSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("Failed getting schema version: %s", err)
+	}
+	if current > target {
+		return nil, fmt.Errorf("Unknown schema version: %d (supported up to %d)", current, target)
+	}
+	steps := b.MigrationSteps()
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Version < steps[j].Version })
+	var results []Result
+	version := current
+	for _, step := range steps {
+		if step.Version <= version {
+			continue
+		}
+		if step.Version > target {
+			break
+		}
+		if step.Version != version+1 {
+			return results, fmt.Errorf("Missing migration to schema version %d", version+1)
+		}
+		changes, err := step.Apply(dryRun)
+		if err != nil {
+			return results, fmt.Errorf("Migration to schema version %d failed: %s", step.Version, err)
+		}
+		if !dryRun {
+			err = b.SetSchemaVersion(step.Version)
+			if err != nil {
+				return results, fmt.Errorf("Failed setting schema version: %s", err)
+			}
+		}
+		results = append(results, Result{
+			Version:     step.Version,
+			Description: step.Description,
+			Changes:     changes,
+		})
+		version = step.Version
+	}
+	if version != target {
+		return results, fmt.Errorf("Missing migration to schema version %d", version+1)
+	}
+	return results, nil
+}
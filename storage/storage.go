@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
 	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/storage/migration"
 	"github.com/mlowicki/rhythm/storage/zk"
 	log "github.com/sirupsen/logrus"
 )
@@ -10,6 +15,7 @@ import (
 type storage interface {
 	DeleteJob(group, project, id string) error
 	GetFrameworkID() (string, error)
+	GetSecretsKey() ([]byte, error)
 	GetGroupJobs(group string) ([]*model.Job, error)
 	GetJob(group, project, id string) (*model.Job, error)
 	GetJobs() ([]*model.Job, error)
@@ -22,9 +28,20 @@ type storage interface {
 	SaveJobRuntime(group, project, id string, state *model.JobRuntime) error
 	GetJobConf(group, project, id string) (*model.JobConf, error)
 	SaveJobConf(state *model.JobConf) error
-	QueueJob(group, project, id string) error
+	QueueJob(group, project, id string, traceContext map[string]string) error
+	GetQueuedJobTraceContext(group, project, id string) (map[string]string, error)
 	DequeueJob(group, project, id string) error
 	GetQueuedJobsIDs() ([]model.JobID, error)
+	RequestKill(group, project, id string) error
+	GetKillRequests() ([]model.JobID, error)
+	DeleteKillRequest(group, project, id string) error
+	GetSchemaVersion() (int, error)
+	GetAPIToken(id string) (*model.APIToken, error)
+	GetAPITokens() ([]*model.APIToken, error)
+	SaveAPIToken(token *model.APIToken) error
+	DeleteAPIToken(id string) error
+	Check() health.Check
+	Close(ctx context.Context) error
 }
 
 // New creates fresh instance of storage.
@@ -39,3 +56,47 @@ func New(c *conf.Storage) storage {
 	log.Fatalf("Unknown backend: %s", c.Backend)
 	return nil
 }
+
+// Connect creates storage instance without running any background jobs.
+// Returns error if storage schema isn't the one used by this release.
+func Connect(c *conf.Storage) (storage, error) {
+	if c.Backend != conf.StorageBackendZK {
+		return nil, fmt.Errorf("Unknown backend: %s", c.Backend)
+	}
+	s, err := zk.Connect(&c.ZooKeeper)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version != zk.SchemaVersion {
+		return nil, fmt.Errorf("Schema version is %d but %d is required. Use migrate command.", version, zk.SchemaVersion)
+	}
+	return s, nil
+}
+
+// Migrate brings storage schema to the version used by this release.
+// If dryRun is set then storage isn't modified (not even initialized) and
+// only planned changes are returned.
+func Migrate(c *conf.Storage, dryRun bool) (from int, results []migration.Result, err error) {
+	if c.Backend != conf.StorageBackendZK {
+		return 0, nil, fmt.Errorf("Unknown backend: %s", c.Backend)
+	}
+	connect := zk.Connect
+	if dryRun {
+		connect = zk.ConnectReadOnly
+	}
+	s, err := connect(&c.ZooKeeper)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer s.Close(context.Background())
+	from, err = s.GetSchemaVersion()
+	if err != nil {
+		return 0, nil, err
+	}
+	results, err = s.Migrate(dryRun)
+	return from, results, err
+}
@@ -0,0 +1,95 @@
+package zk
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const apiTokensDir = "apiTokens"
+
+func (s *storage) apiTokenPath(id string) string {
+	return s.dir + "/" + apiTokensDir + "/" + id
+}
+
+// GetAPIToken returns token with given ID or nil if there is no such token.
+func (s *storage) GetAPIToken(id string) (*model.APIToken, error) {
+	payload, _, err := s.conn.Get(s.apiTokenPath(id))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var token model.APIToken
+	err = json.Unmarshal(payload, &token)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetAPITokens returns all tokens sorted by creation time.
+func (s *storage) GetAPITokens() ([]*model.APIToken, error) {
+	ids, _, err := s.conn.Children(s.dir + "/" + apiTokensDir)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+		return nil, err
+	}
+	tokens := make([]*model.APIToken, len(ids))
+	err = forEachParallel(len(ids), func(i int) error {
+		token, err := s.GetAPIToken(ids[i])
+		tokens[i] = token
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Skip tokens deleted while listing.
+	found := tokens[:0]
+	for _, token := range tokens {
+		if token != nil {
+			found = append(found, token)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Created.Before(found[j].Created) })
+	return found, nil
+}
+
+// SaveAPIToken creates or updates token.
+func (s *storage) SaveAPIToken(token *model.APIToken) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	encoded, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	path := s.apiTokenPath(token.ID)
+	_, err = s.conn.Set(path, encoded, -1)
+	if err != nil {
+		if err != zk.ErrNoNode {
+			return err
+		}
+		_, err = s.conn.Create(path, encoded, 0, s.acl(zk.PermAll))
+	}
+	return err
+}
+
+// DeleteAPIToken removes token. It's not an error if token doesn't exist.
+func (s *storage) DeleteAPIToken(id string) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	err := s.conn.Delete(s.apiTokenPath(id), -1)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package zk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	jobsCacheHitsCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "storage_zookeeper_jobs_cache_hits",
+		Help: "Number of jobs list reads served from cache.",
+	})
+	jobsCacheMissesCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "storage_zookeeper_jobs_cache_misses",
+		Help: "Number of jobs list reads served from ZooKeeper.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(jobsCacheHitsCount)
+	prometheus.MustRegister(jobsCacheMissesCount)
+}
+
+// jobsCache is a read-through cache of all jobs shared by storage clients
+// (jobs scheduler, offers tuner, reconciler and API) so that they don't
+// fetch the whole jobs tree from ZooKeeper independently.
+//
+// Cache is invalidated only by writes made through this instance. Changes
+// made by other instances (e.g. API served by follower while leader runs
+// scheduler) become visible after at most ttl.
+type jobsCache struct {
+	ttl time.Duration
+	// Serializes fetches so concurrent misses trigger a single fetch.
+	fetchMut sync.Mutex
+	mut      sync.Mutex
+	jobs     []*model.Job
+	fetched  time.Time
+	// Incremented on every invalidation. Used to detect if fetch raced
+	// with write so its (potentially stale) result shouldn't be cached.
+	gen uint64
+}
+
+func newJobsCache(ttl time.Duration) *jobsCache {
+	return &jobsCache{ttl: ttl}
+}
+
+func (c *jobsCache) lookup() ([]*model.Job, uint64, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.jobs != nil && time.Now().Sub(c.fetched) < c.ttl {
+		return copyJobs(c.jobs), c.gen, true
+	}
+	return nil, c.gen, false
+}
+
+// get returns cached jobs or calls fetch if cache is empty or expired.
+func (c *jobsCache) get(fetch func() ([]*model.Job, error)) ([]*model.Job, error) {
+	if c.ttl <= 0 {
+		jobsCacheMissesCount.Inc()
+		return fetch()
+	}
+	if jobs, _, ok := c.lookup(); ok {
+		jobsCacheHitsCount.Inc()
+		return jobs, nil
+	}
+	c.fetchMut.Lock()
+	defer c.fetchMut.Unlock()
+	jobs, gen, ok := c.lookup()
+	if ok {
+		jobsCacheHitsCount.Inc()
+		return jobs, nil
+	}
+	jobsCacheMissesCount.Inc()
+	jobs, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.mut.Lock()
+	if c.gen == gen {
+		c.jobs = jobs
+		c.fetched = time.Now()
+	}
+	c.mut.Unlock()
+	return copyJobs(jobs), nil
+}
+
+// invalidate drops cached jobs. Must be called after each write.
+func (c *jobsCache) invalidate() {
+	c.mut.Lock()
+	c.jobs = nil
+	c.gen++
+	c.mut.Unlock()
+}
+
+// copyJobs returns deep copies of jobs as clients modify returned jobs (e.g.
+// runtime fields or maps like Env) and such changes mustn't leak into cache.
+func copyJobs(jobs []*model.Job) []*model.Job {
+	copied := make([]*model.Job, len(jobs))
+	for i, job := range jobs {
+		copied[i] = copyJob(job)
+	}
+	return copied
+}
+
+func copyJob(job *model.Job) *model.Job {
+	j := *job
+	j.Env = copyStrings(job.Env)
+	j.Labels = copyStrings(job.Labels)
+	j.SecretsFingerprints = copyStrings(job.SecretsFingerprints)
+	if job.Secrets != nil {
+		j.Secrets = make(map[string]model.JobSecret, len(job.Secrets))
+		for k, v := range job.Secrets {
+			j.Secrets[k] = v
+		}
+	}
+	if job.SecretFiles != nil {
+		j.SecretFiles = append([]model.JobSecretFile(nil), job.SecretFiles...)
+	}
+	if job.Arguments != nil {
+		j.Arguments = append([]string(nil), job.Arguments...)
+	}
+	if job.StaleSecrets != nil {
+		j.StaleSecrets = append([]string(nil), job.StaleSecrets...)
+	}
+	if job.Container.Docker != nil {
+		docker := *job.Container.Docker
+		j.Container.Docker = &docker
+	}
+	if job.Container.Mesos != nil {
+		mesos := *job.Container.Mesos
+		j.Container.Mesos = &mesos
+	}
+	return &j
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,104 @@
+package zk
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/model"
+)
+
+func testJobs(n int) []*model.Job {
+	jobs := make([]*model.Job, n)
+	for i := range jobs {
+		jobs[i] = &model.Job{
+			JobConf: model.JobConf{
+				JobID:     model.JobID{Group: "group", Project: "project", ID: fmt.Sprintf("job%d", i)},
+				Env:       map[string]string{"FOO": "foo", "BAR": "bar"},
+				Secrets:   map[string]model.JobSecret{"DB_PASSWORD": {Path: "db", Key: "password"}},
+				Labels:    map[string]string{"team": "infra"},
+				Arguments: []string{"-v"},
+				Container: model.JobContainer{
+					Type:   model.Docker,
+					Docker: &model.JobDocker{Image: "alpine"},
+				},
+			},
+			JobRuntime: model.JobRuntime{
+				SecretsFingerprints: map[string]string{"DB_PASSWORD": "fp"},
+			},
+		}
+	}
+	return jobs
+}
+
+func TestCopyJobsIsDeep(t *testing.T) {
+	c := newJobsCache(time.Minute)
+	fetch := func() ([]*model.Job, error) { return testJobs(1), nil }
+	jobs, err := c.get(fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := jobs[0]
+	job.State = model.RUNNING
+	job.Env["FOO"] = "changed"
+	job.Secrets["DB_PASSWORD"] = model.JobSecret{Path: "changed"}
+	job.Labels["team"] = "changed"
+	job.SecretsFingerprints["DB_PASSWORD"] = "changed"
+	job.Arguments[0] = "changed"
+	job.Container.Docker.Image = "changed"
+	jobs, err = c.get(fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testJobs(1)[0]
+	got := jobs[0]
+	if got.State != want.State {
+		t.Errorf("State = %v, want %v", got.State, want.State)
+	}
+	if got.Env["FOO"] != want.Env["FOO"] {
+		t.Errorf("Env[FOO] = %q, want %q", got.Env["FOO"], want.Env["FOO"])
+	}
+	if got.Secrets["DB_PASSWORD"] != want.Secrets["DB_PASSWORD"] {
+		t.Errorf("Secrets[DB_PASSWORD] = %v, want %v", got.Secrets["DB_PASSWORD"], want.Secrets["DB_PASSWORD"])
+	}
+	if got.Labels["team"] != want.Labels["team"] {
+		t.Errorf("Labels[team] = %q, want %q", got.Labels["team"], want.Labels["team"])
+	}
+	if got.SecretsFingerprints["DB_PASSWORD"] != want.SecretsFingerprints["DB_PASSWORD"] {
+		t.Errorf("SecretsFingerprints[DB_PASSWORD] = %q, want %q", got.SecretsFingerprints["DB_PASSWORD"], want.SecretsFingerprints["DB_PASSWORD"])
+	}
+	if got.Arguments[0] != want.Arguments[0] {
+		t.Errorf("Arguments[0] = %q, want %q", got.Arguments[0], want.Arguments[0])
+	}
+	if got.Container.Docker.Image != want.Container.Docker.Image {
+		t.Errorf("Container.Docker.Image = %q, want %q", got.Container.Docker.Image, want.Container.Docker.Image)
+	}
+}
+
+func BenchmarkJobsCacheHit10k(b *testing.B) {
+	c := newJobsCache(time.Hour)
+	jobs := testJobs(10000)
+	fetch := func() ([]*model.Job, error) { return jobs, nil }
+	if _, err := c.get(fetch); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.get(fetch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJobsCacheMiss10k(b *testing.B) {
+	c := newJobsCache(time.Hour)
+	jobs := testJobs(10000)
+	fetch := func() ([]*model.Job, error) { return jobs, nil }
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.invalidate()
+		if _, err := c.get(fetch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package zk
+
+import (
+	"strings"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const killRequestsDir = "killRequests"
+
+func (s *storage) killRequestPath(groupID, projectID, jobID string) string {
+	return s.dir + "/" + killRequestsDir + "/" + groupID + ":" + projectID + ":" + jobID
+}
+
+// RequestKill asks scheduler to kill job's running task.
+func (s *storage) RequestKill(groupID, projectID, jobID string) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	_, err := s.conn.Create(s.killRequestPath(groupID, projectID, jobID), []byte{}, 0, s.acl(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		return err
+	}
+	return nil
+}
+
+// GetKillRequests returns IDs of jobs whose tasks should be killed.
+func (s *storage) GetKillRequests() ([]model.JobID, error) {
+	children, _, err := s.conn.Children(s.dir + "/" + killRequestsDir)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []model.JobID
+	for _, child := range children {
+		chunks := strings.Split(child, ":")
+		if len(chunks) != 3 {
+			continue
+		}
+		ids = append(ids, model.JobID{Group: chunks[0], Project: chunks[1], ID: chunks[2]})
+	}
+	return ids, nil
+}
+
+// DeleteKillRequest removes kill request. It's not an error if request
+// doesn't exist.
+func (s *storage) DeleteKillRequest(groupID, projectID, jobID string) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	err := s.conn.Delete(s.killRequestPath(groupID, projectID, jobID), -1)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
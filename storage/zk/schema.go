@@ -0,0 +1,206 @@
+package zk
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/mlowicki/rhythm/storage/migration"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// SchemaVersion is a version of ZooKeeper layout and encoding of stored
+// objects used by this release. It must be bumped (and migration step added)
+// on every incompatible change.
+//
+// Versions:
+//
+//	0 - jobs stored under jobs/<group>:<project>:<id> (no schema node)
+//	1 - jobs stored under jobs/<group>/<project>/<id>
+const SchemaVersion = 1
+
+const schemaDir = "schema"
+
+type schema struct {
+	Version int
+}
+
+// GetSchemaVersion returns version of stored schema.
+func (s *storage) GetSchemaVersion() (int, error) {
+	payload, _, err := s.conn.Get(s.dir + "/" + schemaDir)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var sch schema
+	err = json.Unmarshal(payload, &sch)
+	if err != nil {
+		return 0, err
+	}
+	return sch.Version, nil
+}
+
+// SetSchemaVersion saves version of stored schema.
+func (s *storage) SetSchemaVersion(version int) error {
+	encoded, err := json.Marshal(&schema{Version: version})
+	if err != nil {
+		return err
+	}
+	path := s.dir + "/" + schemaDir
+	_, err = s.conn.Set(path, encoded, -1)
+	if err != nil {
+		if err != zk.ErrNoNode {
+			return err
+		}
+		_, err = s.conn.Create(path, encoded, 0, s.acl(zk.PermAll))
+	}
+	return err
+}
+
+// Migrate brings schema to SchemaVersion. Migration is refused if any server
+// is running as servers of older releases would keep using old schema.
+func (s *storage) Migrate(dryRun bool) ([]migration.Result, error) {
+	if !dryRun {
+		version, err := s.GetSchemaVersion()
+		if err != nil {
+			return nil, fmt.Errorf("Failed getting schema version: %s", err)
+		}
+		if version < SchemaVersion {
+			servers, err := s.runningServers()
+			if err != nil {
+				return nil, fmt.Errorf("Failed checking running servers: %s", err)
+			}
+			if servers > 0 {
+				return nil, fmt.Errorf("Schema version %d requires migration but %d servers are running. Stop all servers (including older releases) first.", version, servers)
+			}
+		}
+	}
+	return migration.Run(s, SchemaVersion, dryRun)
+}
+
+// runningServers returns number of servers connected to storage.
+func (s *storage) runningServers() (int, error) {
+	tickets, _, err := s.conn.Children(s.dir + "/" + tasksCleanupElectionDir)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return len(tickets), nil
+}
+
+// MigrationSteps returns all schema migrations known by ZooKeeper storage.
+func (s *storage) MigrationSteps() []migration.Step {
+	return []migration.Step{
+		{
+			Version:     1,
+			Description: "Move jobs from jobs/<group>:<project>:<id> to jobs/<group>/<project>/<id>",
+			Apply:       s.migrateFlatLayout,
+		},
+	}
+}
+
+// migrateFlatLayout moves jobs stored under flat layout (jobs/<group>:<project>:<id>)
+// used by older versions to layout indexed by group and project
+// (jobs/<group>/<project>/<id>). It's safe to run it concurrently by many
+// instances as every step is idempotent.
+func (s *storage) migrateFlatLayout(dryRun bool) ([]string, error) {
+	defer s.cache.invalidate()
+	base := s.dir + "/" + jobsDir
+	children, _, err := s.conn.Children(base)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			// Storage not initialized yet (possible in dry-run mode).
+			return nil, nil
+		}
+		return nil, err
+	}
+	var changes []string
+	for _, child := range children {
+		if !strings.Contains(child, ":") {
+			continue
+		}
+		jid, err := model.ParseJobID(child)
+		if err != nil {
+			return changes, fmt.Errorf("Invalid job node %s: %s", child, err)
+		}
+		oldPath := base + "/" + child
+		newPath := s.jobPath(jid.Group, jid.Project, jid.ID)
+		if !dryRun {
+			err = s.migrateFlatJob(oldPath, jid)
+			if err != nil {
+				return changes, fmt.Errorf("Failed migrating job %s: %s", jid, err)
+			}
+		}
+		changes = append(changes, fmt.Sprintf("Move %s to %s", oldPath, newPath))
+	}
+	if !dryRun && len(changes) > 0 {
+		log.Infof("Migrated jobs to new layout: %d", len(changes))
+	}
+	return changes, nil
+}
+
+func (s *storage) migrateFlatJob(oldPath string, jid *model.JobID) error {
+	create := func(path string, data []byte) error {
+		_, err := s.conn.Create(path, data, 0, s.acl(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+		return nil
+	}
+	newPath := s.jobPath(jid.Group, jid.Project, jid.ID)
+	conf, _, err := s.conn.Get(oldPath)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil // Migrated by other instance.
+		}
+		return err
+	}
+	err = s.createJobParents(jid.Group, jid.Project)
+	if err != nil {
+		return err
+	}
+	err = create(newPath, conf)
+	if err != nil {
+		return err
+	}
+	runtime, _, err := s.conn.Get(oldPath + "/" + jobRuntimeDir)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	if err == nil {
+		err = create(newPath+"/"+jobRuntimeDir, runtime)
+		if err != nil {
+			return err
+		}
+	}
+	tasks, _, err := s.conn.Children(oldPath + "/" + jobTasksDir)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	if len(tasks) > 0 {
+		err = create(newPath+"/"+jobTasksDir, []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	for _, task := range tasks {
+		payload, _, err := s.conn.Get(oldPath + "/" + jobTasksDir + "/" + task)
+		if err != nil {
+			if err == zk.ErrNoNode {
+				continue
+			}
+			return err
+		}
+		err = create(newPath+"/"+jobTasksDir+"/"+task, payload)
+		if err != nil {
+			return err
+		}
+	}
+	return s.deleteJobTree(oldPath)
+}
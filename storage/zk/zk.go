@@ -2,14 +2,19 @@ package zk
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mlowicki/rhythm/conf"
 	zkcoord "github.com/mlowicki/rhythm/coordinator/zk"
+	"github.com/mlowicki/rhythm/health"
 	"github.com/mlowicki/rhythm/model"
 	"github.com/mlowicki/rhythm/zkutil"
 	"github.com/prometheus/client_golang/prometheus"
@@ -19,6 +24,9 @@ import (
 
 type frameworkState struct {
 	FrameworkID string
+	// Key used to compute fingerprints of secrets tasks have been launched
+	// with. Generated on first use.
+	SecretsKey []byte `json:",omitempty"`
 }
 
 const (
@@ -29,33 +37,37 @@ const (
 	frameworkStateDir = "state"
 )
 
-var tasksCleanupCount = prometheus.NewCounter(prometheus.CounterOpts{
-	Name: "storage_zookeeper_tasks_cleanups",
-	Help: "Number of old tasks cleanups.",
-})
+// Every server (also of older releases) takes part in election of tasks
+// cleanup leader.
+const tasksCleanupElectionDir = "election/tasks_cleanup"
+
+// Maximum number of concurrent ZooKeeper requests.
+const fetchConcurrency = 32
+
+var (
+	tasksCleanupCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "storage_zookeeper_tasks_cleanups",
+		Help: "Number of old tasks cleanups.",
+	})
+	retainedTasksCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "storage_zookeeper_retained_tasks",
+		Help: "Number of tasks kept in storage after last cleanup.",
+	})
+)
 
 func init() {
 	prometheus.MustRegister(tasksCleanupCount)
+	prometheus.MustRegister(retainedTasksCount)
 }
 
 // New creates fresh instance of ZooKeeper-backed storage.
+// Storage schema is migrated to the current version if needed.
 func New(c *conf.StorageZK) (*storage, error) {
-	s := &storage{
-		dir:     "/" + c.Dir,
-		addrs:   c.Addrs,
-		timeout: c.Timeout,
-		taskTTL: c.TaskTTL,
-	}
-	err := s.connect()
-	if err != nil {
-		return nil, err
-	}
-	acl, err := zkutil.AddAuth(s.conn, &c.Auth)
+	s, err := Connect(c)
 	if err != nil {
 		return nil, err
 	}
-	s.acl = acl
-	err = s.init()
+	_, err = s.Migrate(false)
 	if err != nil {
 		return nil, err
 	}
@@ -64,23 +76,127 @@ func New(c *conf.StorageZK) (*storage, error) {
 		Addrs:       c.Addrs,
 		Timeout:     c.Timeout,
 		Auth:        c.Auth,
-		ElectionDir: "election/tasks_cleanup",
+		ElectionDir: tasksCleanupElectionDir,
 	}
 	coord, err := zkcoord.New(coordConf)
 	if err != nil {
 		return nil, err
 	}
+	s.cleanupCoord = coord
 	s.runTasksCleanupScheduler(coord)
 	return s, nil
 }
 
+// Connect creates instance of ZooKeeper-backed storage without running
+// any background jobs nor schema migrations.
+func Connect(c *conf.StorageZK) (*storage, error) {
+	s, err := ConnectReadOnly(c)
+	if err != nil {
+		return nil, err
+	}
+	err = s.init()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ConnectReadOnly creates instance of ZooKeeper-backed storage which doesn't
+// create any nodes on its own (e.g. missing ones in fresh installation). It's
+// up to the caller to not call methods modifying storage.
+func ConnectReadOnly(c *conf.StorageZK) (*storage, error) {
+	s := &storage{
+		dir:          "/" + c.Dir,
+		addrs:        c.Addrs,
+		timeout:      c.Timeout,
+		taskTTL:      c.TaskTTL,
+		cache:        newJobsCache(c.CacheTTL),
+		taskMinCount: c.TaskMinCount,
+		taskMaxCount: c.TaskMaxCount,
+	}
+	err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	acl, err := zkutil.AddAuth(s.client, &c.Auth)
+	if err != nil {
+		return nil, err
+	}
+	s.acl = acl
+	return s, nil
+}
+
 type storage struct {
-	dir     string
-	addrs   []string
-	conn    *zk.Conn
-	acl     func(perms int32) []zk.ACL
-	timeout time.Duration
-	taskTTL time.Duration
+	dir          string
+	addrs        []string
+	client       *zk.Conn
+	conn         nodes
+	acl          func(perms int32) []zk.ACL
+	timeout      time.Duration
+	taskTTL      time.Duration
+	cache        *jobsCache
+	taskMinCount int
+	taskMaxCount int
+	cleanupCoord *zkcoord.Coordinator
+	writesMut    sync.Mutex
+	writes       sync.WaitGroup
+	closed       bool
+}
+
+var errClosed = errors.New("Storage is closed")
+
+// beginWrite registers write so Close can wait until it's finished.
+// Returns error if storage has been closed.
+func (s *storage) beginWrite() error {
+	s.writesMut.Lock()
+	defer s.writesMut.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	s.writes.Add(1)
+	return nil
+}
+
+func (s *storage) endWrite() {
+	s.writes.Done()
+}
+
+func (s *storage) isClosed() bool {
+	s.writesMut.Lock()
+	defer s.writesMut.Unlock()
+	return s.closed
+}
+
+// Close rejects new writes, waits until in-flight ones are finished (or ctx
+// is done) and closes connection to ZooKeeper.
+func (s *storage) Close(ctx context.Context) error {
+	s.writesMut.Lock()
+	s.closed = true
+	s.writesMut.Unlock()
+	if s.cleanupCoord != nil {
+		err := s.cleanupCoord.Close()
+		if err != nil {
+			log.Errorf("Error closing tasks cleanup coordinator: %s", err)
+		}
+	}
+	drained := make(chan struct{})
+	go func() {
+		s.writes.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("Failed draining writes: %s", ctx.Err())
+	}
+	s.client.Close()
+	return err
+}
+
+// Check returns state of connection to ZooKeeper.
+func (s *storage) Check() health.Check {
+	return zkutil.Check(s.client)
 }
 
 func (s *storage) runTasksCleanupScheduler(coord *zkcoord.Coordinator) {
@@ -89,6 +205,9 @@ func (s *storage) runTasksCleanupScheduler(coord *zkcoord.Coordinator) {
 		for {
 			log.Info("Waiting until tasks cleanup leader")
 			ctx := coord.WaitUntilLeader()
+			if s.isClosed() {
+				return
+			}
 			log.Info("Elected as tasks cleanup leader")
 			timer := time.After(interval)
 		inner:
@@ -117,11 +236,16 @@ func (s *storage) connect() error {
 	if err != nil {
 		return err
 	}
-	s.conn = conn
+	s.client = conn
+	s.conn = newLimitedNodes(conn, fetchConcurrency)
 	return nil
 }
 
 func (s *storage) SetFrameworkID(id string) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
 	path := s.dir + "/" + frameworkStateDir
 	payload, stat, err := s.conn.Get(path)
 	if err != nil {
@@ -155,6 +279,49 @@ func (s *storage) GetFrameworkID() (string, error) {
 	return st.FrameworkID, nil
 }
 
+// GetSecretsKey returns key shared by all servers which is used to compute
+// fingerprints of secrets. Key is generated if it doesn't exist yet.
+func (s *storage) GetSecretsKey() ([]byte, error) {
+	path := s.dir + "/" + frameworkStateDir
+	for {
+		payload, stat, err := s.conn.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		st := frameworkState{}
+		err = json.Unmarshal(payload, &st)
+		if err != nil {
+			return nil, err
+		}
+		if len(st.SecretsKey) > 0 {
+			return st.SecretsKey, nil
+		}
+		key := make([]byte, 32)
+		_, err = rand.Read(key)
+		if err != nil {
+			return nil, err
+		}
+		st.SecretsKey = key
+		est, err := json.Marshal(&st)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.beginWrite(); err != nil {
+			return nil, err
+		}
+		_, err = s.conn.Set(path, est, stat.Version)
+		s.endWrite()
+		if err == zk.ErrBadVersion {
+			// State modified concurrently (e.g. key generated by other server).
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
 func (s *storage) init() error {
 	_, err := s.conn.Create(s.dir, []byte{}, 0, s.acl(zk.PermAll))
 	if err != nil && err != zk.ErrNodeExists {
@@ -166,7 +333,13 @@ func (s *storage) init() error {
 		return err
 	}
 	_, err = s.conn.Create(s.dir+"/"+frameworkStateDir, encodedState, 0, s.acl(zk.PermAll))
-	if err != nil && err != zk.ErrNodeExists {
+	if err == nil {
+		// Fresh installation so there is nothing to migrate.
+		err = s.SetSchemaVersion(SchemaVersion)
+		if err != nil {
+			return err
+		}
+	} else if err != zk.ErrNodeExists {
 		return err
 	}
 	_, err = s.conn.Create(s.dir+"/"+jobsDir, []byte{}, 0, s.acl(zk.PermAll))
@@ -177,12 +350,31 @@ func (s *storage) init() error {
 	if err != nil && err != zk.ErrNodeExists {
 		return err
 	}
+	_, err = s.conn.Create(s.dir+"/"+apiTokensDir, []byte{}, 0, s.acl(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		return err
+	}
+	_, err = s.conn.Create(s.dir+"/"+killRequestsDir, []byte{}, 0, s.acl(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		return err
+	}
 	return nil
 }
 
+func (s *storage) groupPath(groupID string) string {
+	return s.dir + "/" + jobsDir + "/" + groupID
+}
+
+func (s *storage) projectPath(groupID, projectID string) string {
+	return s.groupPath(groupID) + "/" + projectID
+}
+
+func (s *storage) jobPath(groupID, projectID, jobID string) string {
+	return s.projectPath(groupID, projectID) + "/" + jobID
+}
+
 func (s *storage) GetJobRuntime(groupID, projectID, jobID string) (*model.JobRuntime, error) {
-	fqid := groupID + ":" + projectID + ":" + jobID
-	jobPath := s.dir + "/" + jobsDir + "/" + fqid + "/" + jobRuntimeDir
+	jobPath := s.jobPath(groupID, projectID, jobID) + "/" + jobRuntimeDir
 	encodedJob, _, err := s.conn.Get(jobPath)
 	if err != nil {
 		if err == zk.ErrNoNode {
@@ -199,9 +391,7 @@ func (s *storage) GetJobRuntime(groupID, projectID, jobID string) (*model.JobRun
 }
 
 func (s *storage) GetJobConf(groupID, projectID, jobID string) (*model.JobConf, error) {
-	fqid := groupID + ":" + projectID + ":" + jobID
-	jobPath := s.dir + "/" + jobsDir + "/" + fqid
-	encodedJob, _, err := s.conn.Get(jobPath)
+	encodedJob, _, err := s.conn.Get(s.jobPath(groupID, projectID, jobID))
 	if err != nil {
 		if err == zk.ErrNoNode {
 			return nil, nil
@@ -236,67 +426,125 @@ func (s *storage) GetJob(groupID, projectID, jobID string) (*model.Job, error) {
 }
 
 func (s *storage) GetGroupJobs(groupID string) ([]*model.Job, error) {
-	jobs, err := s.GetJobs()
+	jids, err := s.getGroupJobsIDs(groupID)
 	if err != nil {
 		return nil, err
 	}
-	filtered := make([]*model.Job, 0, len(jobs))
-	for _, job := range jobs {
-		if job.Group == groupID {
-			filtered = append(filtered, job)
-		}
-	}
-	return filtered, nil
+	return s.getJobsByIDs(jids)
 }
 
 func (s *storage) GetProjectJobs(groupID, projectID string) ([]*model.Job, error) {
-	jobs, err := s.GetJobs()
+	jids, err := s.getProjectJobsIDs(groupID, projectID)
 	if err != nil {
 		return nil, err
 	}
-	filtered := make([]*model.Job, 0, len(jobs))
-	for _, job := range jobs {
-		if job.Group == groupID && job.Project == projectID {
-			filtered = append(filtered, job)
-		}
-	}
-	return filtered, nil
+	return s.getJobsByIDs(jids)
 }
 
 func (s *storage) GetJobs() ([]*model.Job, error) {
-	jobs := []*model.Job{}
-	base := s.dir + "/" + jobsDir
-	children, _, err := s.conn.Children(base)
+	return s.cache.get(func() ([]*model.Job, error) {
+		jids, err := s.getJobsIDs()
+		if err != nil {
+			return nil, err
+		}
+		return s.getJobsByIDs(jids)
+	})
+}
+
+func (s *storage) getJobsIDs() ([]model.JobID, error) {
+	children, _, err := s.conn.Children(s.dir + "/" + jobsDir)
 	if err != nil {
-		return jobs, err
+		return nil, err
 	}
+	groups := make([]string, 0, len(children))
 	for _, child := range children {
-		encodedJobConf, _, err := s.conn.Get(base + "/" + child)
-		if err != nil {
-			return jobs, err
+		// Jobs in flat layout can be written only by server of older
+		// release. They're moved while migrating schema.
+		if strings.Contains(child, ":") {
+			log.Warnf("Skipping job in flat layout (written by older release?): %s", child)
+			continue
 		}
-		var job model.Job
-		err = json.Unmarshal(encodedJobConf, &job)
-		if err != nil {
-			return jobs, err
+		groups = append(groups, child)
+	}
+	idsPerGroup := make([][]model.JobID, len(groups))
+	err = forEachParallel(len(groups), func(i int) error {
+		var err error
+		idsPerGroup[i], err = s.getGroupJobsIDs(groups[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var jids []model.JobID
+	for _, ids := range idsPerGroup {
+		jids = append(jids, ids...)
+	}
+	return jids, nil
+}
+
+func (s *storage) getGroupJobsIDs(groupID string) ([]model.JobID, error) {
+	projects, _, err := s.conn.Children(s.groupPath(groupID))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
 		}
-		encodedJobRuntime, _, err := s.conn.Get(base + "/" + child + "/" + jobRuntimeDir)
-		if err != nil {
-			return jobs, err
+		return nil, err
+	}
+	idsPerProject := make([][]model.JobID, len(projects))
+	err = forEachParallel(len(projects), func(i int) error {
+		var err error
+		idsPerProject[i], err = s.getProjectJobsIDs(groupID, projects[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var jids []model.JobID
+	for _, ids := range idsPerProject {
+		jids = append(jids, ids...)
+	}
+	return jids, nil
+}
+
+func (s *storage) getProjectJobsIDs(groupID, projectID string) ([]model.JobID, error) {
+	children, _, err := s.conn.Children(s.projectPath(groupID, projectID))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
 		}
-		err = json.Unmarshal(encodedJobRuntime, &job)
-		if err != nil {
-			return jobs, err
+		return nil, err
+	}
+	jids := make([]model.JobID, 0, len(children))
+	for _, child := range children {
+		jids = append(jids, model.JobID{Group: groupID, Project: projectID, ID: child})
+	}
+	return jids, nil
+}
+
+// getJobsByIDs fetches jobs in parallel. Jobs removed in the meantime (or
+// not fully created yet) are skipped.
+func (s *storage) getJobsByIDs(jids []model.JobID) ([]*model.Job, error) {
+	fetched := make([]*model.Job, len(jids))
+	err := forEachParallel(len(jids), func(i int) error {
+		var err error
+		fetched[i], err = s.GetJob(jids[i].Group, jids[i].Project, jids[i].ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*model.Job, 0, len(fetched))
+	for _, job := range fetched {
+		if job != nil {
+			jobs = append(jobs, job)
 		}
-		jobs = append(jobs, &job)
 	}
 	return jobs, nil
 }
 
 func (s *storage) GetTasks(groupID, projectID, jobID string) ([]*model.Task, error) {
 	tasks := []*model.Task{}
-	fqid := groupID + ":" + projectID + ":" + jobID
-	base := s.dir + "/" + jobsDir + "/" + fqid + "/" + jobTasksDir
+	base := s.jobPath(groupID, projectID, jobID) + "/" + jobTasksDir
 	children, _, err := s.conn.Children(base)
 	if err != nil {
 		if err == zk.ErrNoNode {
@@ -319,56 +567,128 @@ func (s *storage) GetTasks(groupID, projectID, jobID string) ([]*model.Task, err
 	return tasks, nil
 }
 
+// taskRetention defines which tasks of a job are kept by tasks cleanup.
+type taskRetention struct {
+	minCount int
+	maxCount int
+	maxAge   time.Duration
+}
+
+// expired returns true if task should be deleted. Position 0 denotes the most
+// recent task. maxCount takes precedence over minCount.
+func (r *taskRetention) expired(pos int, end time.Time) bool {
+	if r.maxCount > 0 && pos >= r.maxCount {
+		return true
+	}
+	if pos < r.minCount {
+		return false
+	}
+	return time.Now().Sub(end) > r.maxAge
+}
+
+// jobTaskRetention returns global retention settings overridden by job's ones.
+// Global settings are used if job's configuration is missing (e.g. job has
+// been partially deleted).
+func (s *storage) jobTaskRetention(job *model.JobConf) *taskRetention {
+	r := taskRetention{
+		minCount: s.taskMinCount,
+		maxCount: s.taskMaxCount,
+		maxAge:   s.taskTTL,
+	}
+	if job == nil {
+		return &r
+	}
+	if job.TaskRetention.MinCount > 0 {
+		r.minCount = job.TaskRetention.MinCount
+	}
+	if job.TaskRetention.MaxCount > 0 {
+		r.maxCount = job.TaskRetention.MaxCount
+	}
+	if job.TaskRetention.MaxAge > 0 {
+		r.maxAge = time.Duration(job.TaskRetention.MaxAge) * time.Second
+	}
+	return &r
+}
+
 func (s *storage) tasksCleanup(ctx context.Context) (int64, error) {
 	deleted := int64(0)
-	jobsPath := s.dir + "/" + jobsDir
-	jobIDs, _, err := s.conn.Children(jobsPath)
+	retained := int64(0)
+	// Tasks tree is traversed directly as GetJobs skips jobs without
+	// configuration or runtime node (e.g. partially deleted ones) whose tasks
+	// would be kept forever.
+	jids, err := s.getJobsIDs()
+	if err != nil {
+		return 0, err
+	}
+	jobs, err := s.GetJobs()
 	if err != nil {
 		return 0, err
 	}
-	if ctx.Err() != nil {
-		return deleted, nil
+	confs := make(map[string]*model.JobConf, len(jobs))
+	for _, job := range jobs {
+		confs[job.FQID()] = &job.JobConf
+	}
+	type taskNode struct {
+		key string
+		end time.Time
 	}
-	for _, jobID := range jobIDs {
-		tasksPath := jobsPath + "/" + jobID + "/" + jobTasksDir
+	for i := range jids {
+		if ctx.Err() != nil {
+			return deleted, nil
+		}
+		jid := &jids[i]
+		tasksPath := s.jobPath(jid.Group, jid.Project, jid.ID) + "/" + jobTasksDir
 		keys, _, err := s.conn.Children(tasksPath)
 		if err != nil {
-			log.Errorf("Failed getting tasks IDs: %s", err)
+			if err != zk.ErrNoNode {
+				log.Errorf("Failed getting tasks IDs: %s", err)
+			}
 			continue
 		}
-		if ctx.Err() != nil {
-			return deleted, nil
-		}
+		nodes := make([]taskNode, 0, len(keys))
 		for _, key := range keys {
 			chunks := strings.SplitN(key, "@", 2)
 			timestamp, err := strconv.ParseInt(chunks[0], 10, 64)
 			if err != nil {
 				log.Errorf("Failed parsing task timestamp: %s", err)
+				retained++
 				continue
 			}
-			if time.Now().Sub(time.Unix(timestamp, 0)) > s.taskTTL {
-				err = s.conn.Delete(tasksPath+"/"+key, 0)
-				if err != nil {
-					log.Errorf("Failed removing old task: %s", err)
-					continue
-				}
-				deleted += 1
+			nodes = append(nodes, taskNode{key: key, end: time.Unix(timestamp, 0)})
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].end.After(nodes[j].end) })
+		retention := s.jobTaskRetention(confs[jid.String()])
+		for i, node := range nodes {
+			if !retention.expired(i, node.end) {
+				retained++
+				continue
+			}
+			err = s.conn.Delete(tasksPath+"/"+node.key, 0)
+			if err != nil {
+				log.Errorf("Failed removing old task: %s", err)
+				retained++
+				continue
 			}
+			deleted++
 			if ctx.Err() != nil {
 				return deleted, nil
 			}
 		}
 	}
+	retainedTasksCount.Set(float64(retained))
 	return deleted, nil
 }
 
 func (s *storage) AddTask(groupID, projectID, jobID string, task *model.Task) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
 	encoded, err := json.Marshal(task)
 	if err != nil {
 		return err
 	}
-	fqid := groupID + ":" + projectID + ":" + jobID
-	tasksPath := s.dir + "/" + jobsDir + "/" + fqid + "/" + jobTasksDir
+	tasksPath := s.jobPath(groupID, projectID, jobID) + "/" + jobTasksDir
 	taskPath := fmt.Sprintf("%s/%d@%s", tasksPath, task.End.Unix(), task.TaskID)
 	_, err = s.conn.Create(taskPath, encoded, 0, s.acl(zk.PermAll))
 	if err != nil {
@@ -384,18 +704,37 @@ func (s *storage) AddTask(groupID, projectID, jobID string, task *model.Task) er
 	return err
 }
 
+// createJobParents creates group and project nodes if they don't exist.
+func (s *storage) createJobParents(groupID, projectID string) error {
+	for _, path := range []string{s.groupPath(groupID), s.projectPath(groupID, projectID)} {
+		_, err := s.conn.Create(path, []byte{}, 0, s.acl(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *storage) SaveJobConf(job *model.JobConf) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	defer s.cache.invalidate()
 	encoded, err := json.Marshal(job)
 	if err != nil {
 		return err
 	}
-	fqid := job.Group + ":" + job.Project + ":" + job.ID
-	jobPath := s.dir + "/" + jobsDir + "/" + fqid
+	jobPath := s.jobPath(job.Group, job.Project, job.ID)
 	_, err = s.conn.Set(jobPath, encoded, -1)
 	if err != nil {
 		if err != zk.ErrNoNode {
 			return err
 		}
+		err = s.createJobParents(job.Group, job.Project)
+		if err != nil {
+			return err
+		}
 		_, err = s.conn.Create(jobPath, encoded, 0, s.acl(zk.PermAll))
 		if err != nil {
 			return err
@@ -405,12 +744,16 @@ func (s *storage) SaveJobConf(job *model.JobConf) error {
 }
 
 func (s *storage) SaveJobRuntime(groupID, projectID, jobID string, job *model.JobRuntime) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	defer s.cache.invalidate()
 	encoded, err := json.Marshal(job)
 	if err != nil {
 		return err
 	}
-	fqid := groupID + ":" + projectID + ":" + jobID
-	jobPath := s.dir + "/" + jobsDir + "/" + fqid + "/" + jobRuntimeDir
+	jobPath := s.jobPath(groupID, projectID, jobID) + "/" + jobRuntimeDir
 	_, err = s.conn.Set(jobPath, encoded, -1)
 	if err != nil {
 		if err != zk.ErrNoNode {
@@ -448,6 +791,10 @@ func (s *storage) GetQueuedJobsIDs() ([]model.JobID, error) {
 }
 
 func (s *storage) DequeueJob(groupID, projectID, jobID string) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
 	fqid := groupID + ":" + projectID + ":" + jobID
 	path := s.dir + "/" + queuedJobsDir + "/" + fqid
 	err := s.conn.Delete(path, 0)
@@ -457,19 +804,73 @@ func (s *storage) DequeueJob(groupID, projectID, jobID string) error {
 	return nil
 }
 
-func (s *storage) QueueJob(groupID, projectID, jobID string) error {
+// QueueJob schedules job for immediate run. traceContext identifies span
+// which queued the job (nil if not traced).
+func (s *storage) QueueJob(groupID, projectID, jobID string, traceContext map[string]string) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	var payload []byte
+	if traceContext != nil {
+		var err error
+		payload, err = json.Marshal(traceContext)
+		if err != nil {
+			return err
+		}
+	}
 	fqid := groupID + ":" + projectID + ":" + jobID
 	path := s.dir + "/" + queuedJobsDir + "/" + fqid
-	_, err := s.conn.Create(path, []byte{}, 0, s.acl(zk.PermAll))
+	_, err := s.conn.Create(path, payload, 0, s.acl(zk.PermAll))
 	if err != nil && err != zk.ErrNodeExists {
 		return err
 	}
 	return nil
 }
 
-func (s *storage) DeleteJob(groupID, projectID, jobID string) error {
+// GetQueuedJobTraceContext returns trace context passed while queueing job.
+// Returns nil if job isn't queued or queueing wasn't traced.
+func (s *storage) GetQueuedJobTraceContext(groupID, projectID, jobID string) (map[string]string, error) {
 	fqid := groupID + ":" + projectID + ":" + jobID
-	jobPath := s.dir + "/" + jobsDir + "/" + fqid
+	payload, _, err := s.conn.Get(s.dir + "/" + queuedJobsDir + "/" + fqid)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	var traceContext map[string]string
+	err = json.Unmarshal(payload, &traceContext)
+	if err != nil {
+		return nil, err
+	}
+	return traceContext, nil
+}
+
+func (s *storage) DeleteJob(groupID, projectID, jobID string) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	defer s.cache.invalidate()
+	err := s.deleteJobTree(s.jobPath(groupID, projectID, jobID))
+	if err != nil {
+		return err
+	}
+	// Remove project and group nodes if it was the last job there.
+	for _, path := range []string{s.projectPath(groupID, projectID), s.groupPath(groupID)} {
+		err = s.conn.Delete(path, -1)
+		if err != nil && err != zk.ErrNoNode && err != zk.ErrNotEmpty {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *storage) deleteJobTree(jobPath string) error {
 	// delete tasks
 	tasksPath := jobPath + "/" + jobTasksDir
 	tasks, _, err := s.conn.Children(tasksPath)
@@ -498,3 +899,82 @@ func (s *storage) DeleteJob(groupID, projectID, jobID string) error {
 	}
 	return nil
 }
+
+// nodes is a subset of ZooKeeper client used to read and modify data.
+type nodes interface {
+	Children(path string) ([]string, *zk.Stat, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Set(path string, data []byte, version int32) (*zk.Stat, error)
+	Delete(path string, version int32) error
+}
+
+// limitedNodes bounds number of requests in flight. Slot is held only for
+// the time of single request so nested parallel reads (groups, projects and
+// jobs) share the same limit without risk of deadlock.
+type limitedNodes struct {
+	nodes
+	sem chan struct{}
+}
+
+func newLimitedNodes(n nodes, limit int) *limitedNodes {
+	return &limitedNodes{nodes: n, sem: make(chan struct{}, limit)}
+}
+
+func (l *limitedNodes) acquire() func() {
+	l.sem <- struct{}{}
+	return func() { <-l.sem }
+}
+
+func (l *limitedNodes) Children(path string) ([]string, *zk.Stat, error) {
+	defer l.acquire()()
+	return l.nodes.Children(path)
+}
+
+func (l *limitedNodes) Get(path string) ([]byte, *zk.Stat, error) {
+	defer l.acquire()()
+	return l.nodes.Get(path)
+}
+
+func (l *limitedNodes) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	defer l.acquire()()
+	return l.nodes.Create(path, data, flags, acl)
+}
+
+func (l *limitedNodes) Set(path string, data []byte, version int32) (*zk.Stat, error) {
+	defer l.acquire()()
+	return l.nodes.Set(path, data, version)
+}
+
+func (l *limitedNodes) Delete(path string, version int32) error {
+	defer l.acquire()()
+	return l.nodes.Delete(path, version)
+}
+
+// forEachParallel calls fn for every index from [0, n) using at most
+// fetchConcurrency goroutines. Returns first encountered error. Number of
+// ZooKeeper requests is bounded separately by limitedNodes as calls can be
+// nested.
+func forEachParallel(n int, fn func(i int) error) error {
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, fetchConcurrency)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(i); err != nil {
+				errOnce.Do(func() { firstErr = err })
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,323 @@
+package zk
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mlowicki/rhythm/model"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// fakeNodes keeps ZooKeeper tree in memory. Every request takes latency to
+// simulate round trip to ZooKeeper.
+type fakeNodes struct {
+	mut         sync.Mutex
+	data        map[string][]byte
+	children    map[string]map[string]struct{}
+	latency     time.Duration
+	inFlight    int32
+	maxInFlight int32
+}
+
+func newFakeNodes() *fakeNodes {
+	return &fakeNodes{
+		data:     map[string][]byte{"/": nil},
+		children: map[string]map[string]struct{}{},
+	}
+}
+
+func (f *fakeNodes) request() func() {
+	n := atomic.AddInt32(&f.inFlight, 1)
+	for {
+		max := atomic.LoadInt32(&f.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&f.maxInFlight, max, n) {
+			break
+		}
+	}
+	if f.latency > 0 {
+		time.Sleep(f.latency)
+	}
+	return func() { atomic.AddInt32(&f.inFlight, -1) }
+}
+
+// add creates node along with missing parents.
+func (f *fakeNodes) add(p string, data []byte) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	for p != "/" {
+		if _, ok := f.data[p]; !ok || data != nil {
+			f.data[p] = data
+		}
+		parent := path.Dir(p)
+		if f.children[parent] == nil {
+			f.children[parent] = map[string]struct{}{}
+		}
+		f.children[parent][path.Base(p)] = struct{}{}
+		p, data = parent, nil
+	}
+}
+
+func (f *fakeNodes) Children(p string) ([]string, *zk.Stat, error) {
+	defer f.request()()
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if _, ok := f.data[p]; !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	names := make([]string, 0, len(f.children[p]))
+	for name := range f.children[p] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, &zk.Stat{}, nil
+}
+
+func (f *fakeNodes) Get(p string) ([]byte, *zk.Stat, error) {
+	defer f.request()()
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	data, ok := f.data[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return data, &zk.Stat{}, nil
+}
+
+func (f *fakeNodes) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	defer f.request()()
+	f.mut.Lock()
+	_, ok := f.data[p]
+	f.mut.Unlock()
+	if ok {
+		return "", zk.ErrNodeExists
+	}
+	f.add(p, data)
+	return p, nil
+}
+
+func (f *fakeNodes) Set(p string, data []byte, version int32) (*zk.Stat, error) {
+	defer f.request()()
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if _, ok := f.data[p]; !ok {
+		return nil, zk.ErrNoNode
+	}
+	f.data[p] = data
+	return &zk.Stat{}, nil
+}
+
+func (f *fakeNodes) Delete(p string, version int32) error {
+	defer f.request()()
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if _, ok := f.data[p]; !ok {
+		return zk.ErrNoNode
+	}
+	delete(f.data, p)
+	delete(f.children[path.Dir(p)], path.Base(p))
+	return nil
+}
+
+const testDir = "/rhythm"
+
+// fillJobs stores n jobs spread across groups and projects either in indexed
+// or in flat layout (used by older releases).
+func fillJobs(tb testing.TB, f *fakeNodes, n int, flat bool) {
+	for i := 0; i < n; i++ {
+		jid := model.JobID{
+			Group:   fmt.Sprintf("group%d", i%20),
+			Project: fmt.Sprintf("project%d", i/20%10),
+			ID:      fmt.Sprintf("job%d", i),
+		}
+		job := testJobs(1)[0]
+		job.JobID = jid
+		conf, err := json.Marshal(&job.JobConf)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		runtime, err := json.Marshal(&job.JobRuntime)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		p := testDir + "/" + jobsDir + "/" + jid.Group + "/" + jid.Project + "/" + jid.ID
+		if flat {
+			p = testDir + "/" + jobsDir + "/" + jid.Group + ":" + jid.Project + ":" + jid.ID
+		}
+		f.add(p, conf)
+		f.add(p+"/"+jobRuntimeDir, runtime)
+	}
+}
+
+func testStorage(f *fakeNodes) *storage {
+	return &storage{
+		dir:   testDir,
+		conn:  newLimitedNodes(f, fetchConcurrency),
+		cache: newJobsCache(0),
+	}
+}
+
+// getJobsSequentially reads jobs kept in flat layout one by one the way
+// releases before indexed layout did.
+func getJobsSequentially(s *storage) ([]*model.Job, error) {
+	jobs := []*model.Job{}
+	base := s.dir + "/" + jobsDir
+	children, _, err := s.conn.Children(base)
+	if err != nil {
+		return jobs, err
+	}
+	for _, child := range children {
+		encodedJobConf, _, err := s.conn.Get(base + "/" + child)
+		if err != nil {
+			return jobs, err
+		}
+		var job model.Job
+		err = json.Unmarshal(encodedJobConf, &job)
+		if err != nil {
+			return jobs, err
+		}
+		encodedJobRuntime, _, err := s.conn.Get(base + "/" + child + "/" + jobRuntimeDir)
+		if err != nil {
+			return jobs, err
+		}
+		err = json.Unmarshal(encodedJobRuntime, &job)
+		if err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func TestGetJobsBoundsConcurrentRequests(t *testing.T) {
+	f := newFakeNodes()
+	fillJobs(t, f, 2000, false)
+	f.latency = time.Millisecond
+	jobs, err := testStorage(f).GetJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2000 {
+		t.Fatalf("got %d jobs, want 2000", len(jobs))
+	}
+	if f.maxInFlight > fetchConcurrency {
+		t.Errorf("got %d concurrent requests, limit is %d", f.maxInFlight, fetchConcurrency)
+	}
+	if f.maxInFlight < 2 {
+		t.Errorf("requests weren't sent in parallel")
+	}
+}
+
+func TestGetJobsSkipsFlatLayout(t *testing.T) {
+	f := newFakeNodes()
+	fillJobs(t, f, 100, false)
+	// Job written by server of older release after migration.
+	f.add(testDir+"/"+jobsDir+"/group0:project0:old", []byte("{}"))
+	f.add(testDir+"/"+jobsDir+"/group0:project0:old/"+jobTasksDir+"/task", []byte("{}"))
+	jobs, err := testStorage(f).GetJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 100 {
+		t.Fatalf("got %d jobs, want 100", len(jobs))
+	}
+}
+
+// Latency of single ZooKeeper request used by benchmarks.
+const benchLatency = time.Millisecond
+
+func BenchmarkGetJobs10kSequentialFlat(b *testing.B) {
+	f := newFakeNodes()
+	fillJobs(b, f, 10000, true)
+	f.latency = benchLatency
+	s := testStorage(f)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jobs, err := getJobsSequentially(s)
+		if err != nil || len(jobs) != 10000 {
+			b.Fatalf("got %d jobs: %v", len(jobs), err)
+		}
+	}
+}
+
+func BenchmarkGetJobs10kParallelIndexed(b *testing.B) {
+	f := newFakeNodes()
+	fillJobs(b, f, 10000, false)
+	f.latency = benchLatency
+	s := testStorage(f)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jobs, err := s.GetJobs()
+		if err != nil || len(jobs) != 10000 {
+			b.Fatalf("got %d jobs: %v", len(jobs), err)
+		}
+	}
+}
+
+func BenchmarkGetProjectJobs10kSequentialFlat(b *testing.B) {
+	f := newFakeNodes()
+	fillJobs(b, f, 10000, true)
+	f.latency = benchLatency
+	s := testStorage(f)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Older releases filtered all jobs.
+		jobs, err := getJobsSequentially(s)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var found int
+		for _, job := range jobs {
+			if job.Group == "group1" && job.Project == "project1" {
+				found++
+			}
+		}
+		if found != 50 {
+			b.Fatalf("got %d jobs, want 50", found)
+		}
+	}
+}
+
+func BenchmarkGetProjectJobs10kParallelIndexed(b *testing.B) {
+	f := newFakeNodes()
+	fillJobs(b, f, 10000, false)
+	f.latency = benchLatency
+	s := testStorage(f)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jobs, err := s.GetProjectJobs("group1", "project1")
+		if err != nil || len(jobs) != 50 {
+			b.Fatalf("got %d jobs: %v", len(jobs), err)
+		}
+	}
+}
+
+func TestMigrateRefusedWhileServersRun(t *testing.T) {
+	f := newFakeNodes()
+	fillJobs(t, f, 10, true)
+	f.add(testDir+"/"+tasksCleanupElectionDir+"/0000000001", []byte{})
+	s := testStorage(f)
+	s.acl = func(perms int32) []zk.ACL { return nil }
+	if _, err := s.Migrate(false); err == nil {
+		t.Fatal("expected error while server is running")
+	}
+	if _, err := s.Migrate(true); err != nil {
+		t.Fatalf("dry run: %s", err)
+	}
+	f.Delete(testDir+"/"+tasksCleanupElectionDir+"/0000000001", -1)
+	if _, err := s.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := s.GetJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 10 {
+		t.Fatalf("got %d jobs after migration, want 10", len(jobs))
+	}
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"github.com/mlowicki/rhythm/conf"
+	tlsutils "github.com/mlowicki/rhythm/tls"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mlowicki/rhythm"
+
+var provider *sdktrace.TracerProvider
+
+// New configures tracing backend. Spans are dropped if tracing is disabled.
+func New(c *conf.Tracing, version string) {
+	switch c.Backend {
+	case conf.TracingBackendOTLP:
+		err := initOTLP(c, version)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case conf.TracingBackendNone:
+	default:
+		log.Fatalf("Unknown tracing backend: %s", c.Backend)
+	}
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	log.Printf("Tracing backend: %s", c.Backend)
+}
+
+func initOTLP(c *conf.Tracing, version string) error {
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(c.OTLP.Endpoint),
+		otlptracehttp.WithHeaders(c.OTLP.Headers),
+		otlptracehttp.WithTimeout(c.OTLP.Timeout),
+	}
+	if c.OTLP.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	} else if c.OTLP.CACert != "" {
+		pool, err := tlsutils.BuildCertPool(c.OTLP.CACert)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(&tls.Config{RootCAs: pool}))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "rhythm"),
+		attribute.String("service.version", version),
+	)
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+// Shutdown sends buffered spans.
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Start creates span being a child of span from ctx (if any).
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End finishes span and marks it as failed if err isn't nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// WithJob returns option setting attributes identifying job.
+func WithJob(group, project, id string) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.String("rhythm.job.group", group),
+		attribute.String("rhythm.job.project", project),
+		attribute.String("rhythm.job.id", id),
+	)
+}
+
+// Extract returns context with remote span passed in HTTP headers.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject returns span from ctx serialized so it can be persisted and linked
+// later (e.g. by different instance). Returns nil if there is no span.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Link returns link to span serialized by Inject.
+func Link(carrier map[string]string) trace.Link {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(carrier))
+	return trace.LinkFromContext(ctx)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/mlowicki/rhythm/conf"
+	"github.com/mlowicki/rhythm/health"
 	"github.com/samuel/go-zookeeper/zk"
 )
 
@@ -17,3 +18,16 @@ func AddAuth(conn *zk.Conn, c *conf.ZKAuth) (func(perms int32) []zk.ACL, error)
 	}
 	return nil, fmt.Errorf("Unknown auth scheme: %s", c.Scheme)
 }
+
+// Check returns state of connection to ZooKeeper.
+func Check(conn *zk.Conn) health.Check {
+	state := conn.State()
+	check := health.Check{
+		Healthy: state == zk.StateHasSession,
+		Details: map[string]string{"State": state.String()},
+	}
+	if !check.Healthy {
+		check.Message = "No ZooKeeper session"
+	}
+	return check
+}